@@ -0,0 +1,96 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// NumVirtualNodes is the number of virtual nodes placed on the hash ring for each node.
+const NumVirtualNodes = 128
+
+// ConsistentHash maps keys to nodes by consistent hashing. Each node is placed on the
+// ring as multiple virtual nodes, so that keys are spread evenly and only keys owned by
+// a joining or leaving node are moved.
+type ConsistentHash struct {
+	nodes map[string]struct{}
+	ring  []uint32          // sorted hashes of virtual nodes
+	owner map[uint32]string // virtual node hash -> node
+}
+
+// NewConsistentHash creates a ConsistentHash with nodes.
+func NewConsistentHash(nodes ...string) *ConsistentHash {
+	h := &ConsistentHash{nodes: make(map[string]struct{})}
+	h.Add(nodes...)
+	return h
+}
+
+// Add nodes to the hash ring.
+func (h *ConsistentHash) Add(nodes ...string) {
+	for _, node := range nodes {
+		h.nodes[node] = struct{}{}
+	}
+	h.build()
+}
+
+// Remove a node from the hash ring.
+func (h *ConsistentHash) Remove(node string) {
+	delete(h.nodes, node)
+	h.build()
+}
+
+// Len returns the number of nodes.
+func (h *ConsistentHash) Len() int {
+	return len(h.nodes)
+}
+
+// Get returns the node owning a key. An empty string is returned if there is no node.
+func (h *ConsistentHash) Get(key string) string {
+	if len(h.ring) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(h.ring), func(i int) bool { return h.ring[i] >= hash })
+	if i == len(h.ring) {
+		i = 0
+	}
+	return h.owner[h.ring[i]]
+}
+
+func (h *ConsistentHash) build() {
+	h.ring = make([]uint32, 0, len(h.nodes)*NumVirtualNodes)
+	h.owner = make(map[uint32]string, len(h.nodes)*NumVirtualNodes)
+	for node := range h.nodes {
+		for i := 0; i < NumVirtualNodes; i++ {
+			hash := hashKey(strconv.Itoa(i) + "#" + node)
+			// resolve collisions deterministically
+			if owner, exist := h.owner[hash]; exist {
+				if owner < node {
+					continue
+				}
+			} else {
+				h.ring = append(h.ring, hash)
+			}
+			h.owner[hash] = node
+		}
+	}
+	sort.Slice(h.ring, func(i, j int) bool { return h.ring[i] < h.ring[j] })
+}
+
+func hashKey(key string) uint32 {
+	return crc32.ChecksumIEEE([]byte(key))
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestConsistentHash(t *testing.T) {
+	// empty ring
+	h := NewConsistentHash()
+	assert.Equal(t, "", h.Get("1"))
+	// balanced assignment
+	h.Add("a", "b", "c")
+	assert.Equal(t, 3, h.Len())
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := 0; i < 30000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = h.Get(key)
+		counts[owners[key]]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		assert.InDelta(t, 10000, counts[node], 2500)
+	}
+	// only keys of the new node are moved
+	h.Add("d")
+	moved := 0
+	for key, owner := range owners {
+		newOwner := h.Get(key)
+		if newOwner != owner {
+			assert.Equal(t, "d", newOwner)
+			moved++
+		}
+	}
+	assert.InDelta(t, 7500, moved, 2500)
+	// keys come back after the node leaves
+	h.Remove("d")
+	for key, owner := range owners {
+		assert.Equal(t, owner, h.Get(key))
+	}
+}
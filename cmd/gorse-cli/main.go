@@ -0,0 +1,482 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/cmd/version"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/master"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/ctr"
+	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Methods to search hyper-parameters.
+const (
+	GridSearch   = "grid"
+	RandomSearch = "random"
+	TPESearch    = "tpe"
+)
+
+// Trial is the result of fitting a model with hyper-parameters.
+type Trial struct {
+	Params  model.Params
+	Score   interface{}
+	FitTime float64 `json:",omitempty"` // time to fit the model in seconds
+}
+
+// Report is the output of a command.
+type Report struct {
+	Model   string
+	Dataset string
+	Best    Trial
+	Trials  []Trial `json:",omitempty"` // all trials of a search
+}
+
+var cliCommand = &cobra.Command{
+	Use:   "gorse-cli",
+	Short: "Train and evaluate models of gorse recommender system on files.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// setup logger
+		debugMode, _ := cmd.Flags().GetBool("debug")
+		if debugMode {
+			base.SetDevelopmentLogger()
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		// Show version
+		if showVersion, _ := cmd.Flags().GetBool("version"); showVersion {
+			fmt.Println(version.Name)
+			return
+		}
+		_ = cmd.Help()
+	},
+}
+
+var fitCommand = &cobra.Command{
+	Use:   "fit [model]",
+	Short: "Fit a model with given hyper-parameters and evaluate it.",
+	Long: "Fit a model with given hyper-parameters and evaluate it. Personal ranking models are als, bpr, ccd, fpmc, hmf and knn. " +
+		"The factorization machine for click-through rate prediction is fm.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modelName := args[0]
+		paramsText, _ := cmd.Flags().GetString("params")
+		params, err := parseParams(paramsText)
+		if err != nil {
+			base.Logger().Fatal("failed to parse hyper-parameters", zap.Error(err))
+		}
+		report := Report{Model: modelName}
+		fitStart := time.Now()
+		if modelName == "fm" {
+			trainSet, testSet, name := loadCTRDataset(cmd)
+			report.Dataset = name
+			m := ctr.NewFM(parseTask(cmd), params)
+			report.Best.Score = m.Fit(trainSet, testSet, loadCTRFitConfig(cmd))
+			report.Best.Params = m.GetParams()
+		} else {
+			m, err := pr.NewModel(modelName, params)
+			if err != nil {
+				base.Logger().Fatal("failed to create model", zap.Error(err))
+			}
+			trainSet, testSet, name := loadPRDataset(cmd)
+			report.Dataset = name
+			report.Best.Score = m.Fit(trainSet, testSet, loadPRFitConfig(cmd))
+			report.Best.Params = m.GetParams()
+		}
+		report.Best.FitTime = time.Since(fitStart).Seconds()
+		writeReport(cmd, report)
+	},
+}
+
+var searchCommand = &cobra.Command{
+	Use:   "search [model]",
+	Short: "Search hyper-parameters of a model.",
+	Long: "Search hyper-parameters of a model in its default grid. Given hyper-parameters are fixed during searching. " +
+		"Personal ranking models support grid, random and tpe search. The factorization machine supports grid and random search.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modelName := args[0]
+		paramsText, _ := cmd.Flags().GetString("params")
+		params, err := parseParams(paramsText)
+		if err != nil {
+			base.Logger().Fatal("failed to parse hyper-parameters", zap.Error(err))
+		}
+		method, _ := cmd.Flags().GetString("method")
+		numTrials, _ := cmd.Flags().GetInt("trials")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		report := Report{Model: modelName}
+		if modelName == "fm" {
+			trainSet, testSet, name := loadCTRDataset(cmd)
+			report.Dataset = name
+			m := ctr.NewFM(parseTask(cmd), params)
+			grid := removeFixedParams(m.GetParamsGrid(), params)
+			var r ctr.ParamsSearchResult
+			switch method {
+			case GridSearch:
+				r = ctr.GridSearchCV(m, trainSet, testSet, grid, seed, loadCTRFitConfig(cmd))
+			case RandomSearch:
+				r = ctr.RandomSearchCV(m, trainSet, testSet, grid, numTrials, seed, loadCTRFitConfig(cmd))
+			default:
+				base.Logger().Fatal("unsupported search method", zap.String("method", method))
+			}
+			for i := range r.Params {
+				report.Trials = append(report.Trials, Trial{Params: r.Params[i], Score: r.Scores[i]})
+			}
+			report.Best = Trial{Params: r.BestParams, Score: r.BestScore}
+		} else {
+			m, err := pr.NewModel(modelName, params)
+			if err != nil {
+				base.Logger().Fatal("failed to create model", zap.Error(err))
+			}
+			trainSet, testSet, name := loadPRDataset(cmd)
+			report.Dataset = name
+			grid := removeFixedParams(m.GetParamsGrid(), params)
+			var r pr.ParamsSearchResult
+			switch method {
+			case GridSearch:
+				r = pr.GridSearchCV(m, trainSet, testSet, grid, seed, loadPRFitConfig(cmd))
+			case RandomSearch:
+				r = pr.RandomSearchCV(m, trainSet, testSet, grid, numTrials, seed, loadPRFitConfig(cmd))
+			case TPESearch:
+				r = pr.TPESearchCV(m, trainSet, testSet, grid, numTrials, seed, loadPRFitConfig(cmd), nil)
+			default:
+				base.Logger().Fatal("unsupported search method", zap.String("method", method))
+			}
+			for i := range r.Params {
+				report.Trials = append(report.Trials, Trial{
+					Params:  r.Params[i],
+					Score:   r.Scores[i],
+					FitTime: r.FitTimes[i].Seconds(),
+				})
+			}
+			if len(report.Trials) > 0 {
+				report.Best = report.Trials[r.BestIndex]
+			}
+		}
+		writeReport(cmd, report)
+	},
+}
+
+var exportCommand = &cobra.Command{
+	Use:   "export [users|items]",
+	Short: "Export latent factors of users or items from the local cache of the master node.",
+	Long: "Export latent factors of users or items with their IDs from the local cache of the master node. " +
+		"Factors are exported as CSV, JSONL or NumPy structured arrays of IDs and factors.",
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"users", "items"},
+	Run: func(cmd *cobra.Command, args []string) {
+		cachePath, _ := cmd.Flags().GetString("cache")
+		localCache, err := master.LoadLocalCache(cachePath)
+		if err != nil {
+			base.Logger().Fatal("failed to load local cache", zap.Error(err))
+		}
+		if localCache.Model == nil {
+			base.Logger().Fatal("model not found in local cache", zap.String("cache", cachePath))
+		}
+		embedding, ok := localCache.Model.(pr.Embedding)
+		if !ok {
+			base.Logger().Fatal("model doesn't have latent factors", zap.String("model", localCache.ModelName))
+		}
+		export := pr.ExportUserFactors
+		if args[0] == "items" {
+			export = pr.ExportItemFactors
+		}
+		format, _ := cmd.Flags().GetString("format")
+		w := io.Writer(os.Stdout)
+		if output, _ := cmd.Flags().GetString("output"); output != "" {
+			file, err := os.Create(output)
+			if err != nil {
+				base.Logger().Fatal("failed to create file", zap.Error(err))
+			}
+			defer file.Close()
+			w = file
+		}
+		if err = export(w, embedding, format); err != nil {
+			base.Logger().Fatal("failed to export latent factors", zap.Error(err))
+		}
+	},
+}
+
+// RetrainReport is the output of the retrain command.
+type RetrainReport struct {
+	Model            string
+	Version          string
+	Seed             int64
+	DataSet          pr.Fingerprint
+	Score            pr.Score
+	ExpectedChecksum string
+	Checksum         string
+	Reproduced       bool
+}
+
+var retrainCommand = &cobra.Command{
+	Use:   "retrain [version]",
+	Short: "Retrain a version of the model from a data snapshot.",
+	Long: "Retrain a version of the model from a snapshot of the data store by the recorded seed, " +
+		"hyper-parameters and config. Metadata of the version is read from the data store, or from the " +
+		"local cache of the master node if the version isn't given. The command fails if the snapshot " +
+		"doesn't match the fingerprint of the training data or the retrained model doesn't match the " +
+		"recorded checksum.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cachePath, _ := cmd.Flags().GetString("cache")
+		localCache, err := master.LoadLocalCache(cachePath)
+		if err != nil {
+			base.Logger().Fatal("failed to load local cache", zap.Error(err))
+		}
+		meta := localCache.ModelMeta
+		database, _ := cmd.Flags().GetString("database")
+		if database == "" && meta.Config != "" {
+			// use the data store recorded in the local cache
+			var cachedConfig config.Config
+			if err = json.Unmarshal([]byte(meta.Config), &cachedConfig); err != nil {
+				base.Logger().Fatal("failed to parse recorded config", zap.Error(err))
+			}
+			database = cachedConfig.Database.DataStore
+		}
+		if database == "" {
+			base.Logger().Fatal("data store not found in local cache", zap.String("cache", cachePath))
+		}
+		dataStore, err := data.Open(database)
+		if err != nil {
+			base.Logger().Fatal("failed to connect data database", zap.Error(err))
+		}
+		defer dataStore.Close()
+		if len(args) > 0 {
+			// load metadata of the version from the data store
+			if meta, err = master.LoadModelMeta(dataStore, args[0]); err != nil {
+				base.Logger().Fatal("failed to load model metadata",
+					zap.String("version", args[0]), zap.Error(err))
+			}
+		} else if meta.Checksum == "" {
+			base.Logger().Fatal("model metadata not found in local cache", zap.String("cache", cachePath))
+		}
+		if meta.GorseVersion != version.Name {
+			base.Logger().Warn("model was fitted by another version of gorse",
+				zap.String("gorse_version", meta.GorseVersion))
+		}
+		// load data snapshot
+		var cfg config.Config
+		if err = json.Unmarshal([]byte(meta.Config), &cfg); err != nil {
+			base.Logger().Fatal("failed to parse recorded config", zap.Error(err))
+		}
+		dataSet, _, _, err := pr.LoadDataFromDatabase(dataStore, cfg.Database.PositiveFeedbackType,
+			cfg.Database.ItemTTL, cfg.Database.PositiveFeedbackTTL)
+		if err != nil {
+			base.Logger().Fatal("failed to load dataset", zap.Error(err))
+		}
+		if fingerprint := dataSet.Fingerprint(); fingerprint != meta.DataSet {
+			base.Logger().Fatal("data snapshot doesn't match the training data",
+				zap.Any("expected", meta.DataSet),
+				zap.Any("actual", fingerprint))
+		}
+		// retrain model
+		prModel, score, err := master.FitModel(dataSet, &meta)
+		if err != nil {
+			base.Logger().Fatal("failed to fit model", zap.Error(err))
+		}
+		report := RetrainReport{
+			Model:            meta.Name,
+			Version:          base.Hex(meta.Version),
+			Seed:             meta.Seed,
+			DataSet:          meta.DataSet,
+			Score:            score,
+			ExpectedChecksum: meta.Checksum,
+			Checksum:         pr.Checksum(prModel),
+		}
+		report.Reproduced = report.Checksum == report.ExpectedChecksum
+		text, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			base.Logger().Fatal("failed to encode report", zap.Error(err))
+		}
+		fmt.Println(string(text))
+		if !report.Reproduced {
+			base.Logger().Fatal("retrained model doesn't match the recorded checksum")
+		}
+	},
+}
+
+func init() {
+	cliCommand.PersistentFlags().Bool("debug", false, "use debug log mode")
+	cliCommand.Flags().BoolP("version", "v", false, "gorse version")
+	for _, command := range []*cobra.Command{fitCommand, searchCommand} {
+		// dataset
+		command.Flags().String("builtin", "", "name of the built-in dataset")
+		command.Flags().String("csv", "", "feedback file in CSV format (personal ranking models only)")
+		command.Flags().String("sep", ",", "separator of the CSV file")
+		command.Flags().Bool("header", false, "the CSV file has a header")
+		command.Flags().Int("test-users", 0, "number of users sampled to test (0 means all users)")
+		command.Flags().String("train-libfm", "", "training set in LibFM format (factorization machines only)")
+		command.Flags().String("test-libfm", "", "test set in LibFM format (factorization machines only)")
+		command.Flags().String("task", string(ctr.FMClassification), "task of factorization machines (c for classification and r for regression)")
+		// model
+		command.Flags().StringP("params", "p", "", "hyper-parameters in JSON (e.g. {\"NFactors\": 16})")
+		command.Flags().Int64("seed", 0, "random seed")
+		command.Flags().IntP("jobs", "j", 1, "number of jobs")
+		command.Flags().Int("verbose", 10, "evaluate every verbose epochs")
+		command.Flags().Int("top-k", 10, "length of recommendation lists to evaluate (personal ranking models only)")
+		command.Flags().Int("candidates", 100, "number of candidates to evaluate (personal ranking models only)")
+		// output
+		command.Flags().StringP("output", "o", "", "write the report in JSON to the file instead of stdout")
+	}
+	searchCommand.Flags().String("method", TPESearch, "method to search hyper-parameters (grid/random/tpe)")
+	searchCommand.Flags().Int("trials", 10, "number of trials of random search and tpe search")
+	exportCommand.Flags().String("cache", filepath.Join(os.TempDir(), "gorse-master"), "path of the local cache of the master node")
+	exportCommand.Flags().String("format", pr.CSVFormat, "format of latent factors (csv/jsonl/npy)")
+	exportCommand.Flags().StringP("output", "o", "", "write latent factors to the file instead of stdout")
+	retrainCommand.Flags().String("cache", filepath.Join(os.TempDir(), "gorse-master"), "path of the local cache of the master node")
+	retrainCommand.Flags().String("database", "", "data store of the snapshot (the recorded data store by default)")
+	cliCommand.AddCommand(fitCommand, searchCommand, exportCommand, retrainCommand)
+}
+
+// parseParams parses hyper-parameters in JSON. Whole numbers are parsed as integers since
+// integer hyper-parameters are read as int.
+func parseParams(text string) (model.Params, error) {
+	params := model.Params{}
+	if text == "" {
+		return params, nil
+	}
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewBufferString(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if i, err := number.Int64(); err == nil {
+				value = int(i)
+			} else if f, err := number.Float64(); err == nil {
+				value = f
+			} else {
+				return nil, err
+			}
+		}
+		params[model.ParamName(name)] = value
+	}
+	return params, nil
+}
+
+// removeFixedParams removes given hyper-parameters from the grid.
+func removeFixedParams(grid model.ParamsGrid, params model.Params) model.ParamsGrid {
+	for name := range params {
+		delete(grid, name)
+	}
+	return grid
+}
+
+// loadPRDataset loads the training set and the test set for personal ranking models.
+func loadPRDataset(cmd *cobra.Command) (*pr.DataSet, *pr.DataSet, string) {
+	if name, _ := cmd.Flags().GetString("builtin"); name != "" {
+		trainSet, testSet, err := pr.LoadDataFromBuiltIn(name)
+		if err != nil {
+			base.Logger().Fatal("failed to load built-in dataset", zap.Error(err))
+		}
+		return trainSet, testSet, name
+	}
+	if path, _ := cmd.Flags().GetString("csv"); path != "" {
+		sep, _ := cmd.Flags().GetString("sep")
+		header, _ := cmd.Flags().GetBool("header")
+		numTestUsers, _ := cmd.Flags().GetInt("test-users")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		trainSet, testSet := pr.LoadDataFromCSV(path, sep, header).Split(numTestUsers, seed)
+		return trainSet, testSet, path
+	}
+	base.Logger().Fatal("dataset is required (--builtin or --csv)")
+	return nil, nil, ""
+}
+
+// loadCTRDataset loads the training set and the test set for factorization machines.
+func loadCTRDataset(cmd *cobra.Command) (*ctr.Dataset, *ctr.Dataset, string) {
+	if name, _ := cmd.Flags().GetString("builtin"); name != "" {
+		trainSet, testSet, err := ctr.LoadDataFromBuiltIn(name)
+		if err != nil {
+			base.Logger().Fatal("failed to load built-in dataset", zap.Error(err))
+		}
+		return trainSet, testSet, name
+	}
+	trainPath, _ := cmd.Flags().GetString("train-libfm")
+	testPath, _ := cmd.Flags().GetString("test-libfm")
+	if trainPath != "" && testPath != "" {
+		trainSet, testSet, err := ctr.LoadDataFromLibFM(trainPath, testPath)
+		if err != nil {
+			base.Logger().Fatal("failed to load LibFM files", zap.Error(err))
+		}
+		return trainSet, testSet, trainPath
+	}
+	base.Logger().Fatal("dataset is required (--builtin or --train-libfm and --test-libfm)")
+	return nil, nil, ""
+}
+
+func loadPRFitConfig(cmd *cobra.Command) *pr.FitConfig {
+	config := (*pr.FitConfig)(nil).LoadDefaultIfNil()
+	config.Jobs, _ = cmd.Flags().GetInt("jobs")
+	config.Verbose, _ = cmd.Flags().GetInt("verbose")
+	config.TopK, _ = cmd.Flags().GetInt("top-k")
+	config.Candidates, _ = cmd.Flags().GetInt("candidates")
+	return config
+}
+
+func loadCTRFitConfig(cmd *cobra.Command) *ctr.FitConfig {
+	config := (*ctr.FitConfig)(nil).LoadDefaultIfNil()
+	config.Jobs, _ = cmd.Flags().GetInt("jobs")
+	config.Verbose, _ = cmd.Flags().GetInt("verbose")
+	return config
+}
+
+func parseTask(cmd *cobra.Command) ctr.FMTask {
+	task, _ := cmd.Flags().GetString("task")
+	switch ctr.FMTask(task) {
+	case ctr.FMClassification, ctr.FMRegression:
+		return ctr.FMTask(task)
+	}
+	base.Logger().Fatal("unknown task", zap.String("task", task))
+	return ""
+}
+
+// writeReport prints the report in JSON or writes it to the output file.
+func writeReport(cmd *cobra.Command, report Report) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		base.Logger().Fatal("failed to encode report", zap.Error(err))
+	}
+	if output, _ := cmd.Flags().GetString("output"); output != "" {
+		if err = ioutil.WriteFile(output, data, 0644); err != nil {
+			base.Logger().Fatal("failed to write report", zap.Error(err))
+		}
+		base.Logger().Info("write report", zap.String("output", output))
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func main() {
+	if err := cliCommand.Execute(); err != nil {
+		base.Logger().Fatal("failed to execute", zap.Error(err))
+	}
+}
@@ -15,6 +15,9 @@
 package config
 
 import (
+	"crypto/md5"
+	"encoding/binary"
+
 	"github.com/BurntSushi/toml"
 )
 
@@ -24,6 +27,8 @@ type Config struct {
 	Master    MasterConfig    `toml:"master"`
 	Server    ServerConfig    `toml:"server"`
 	Recommend RecommendConfig `toml:"recommend"`
+	// Experiment splits users into variants with different recommendation strategies.
+	Experiment ExperimentConfig `toml:"experiment"`
 }
 
 func (config *Config) LoadDefaultIfNil() *Config {
@@ -40,14 +45,16 @@ func (config *Config) LoadDefaultIfNil() *Config {
 
 // DatabaseConfig is the configuration for the database.
 type DatabaseConfig struct {
-	DataStore            string   `toml:"data_store"`              // database for data store
-	CacheStore           string   `toml:"cache_store"`             // database for cache store
-	AutoInsertUser       bool     `toml:"auto_insert_user"`        // insert new users while inserting feedback
-	AutoInsertItem       bool     `toml:"auto_insert_item"`        // insert new items while inserting feedback
-	CacheSize            int      `toml:"cache_size"`              // cache size for intermediate recommendation
-	PositiveFeedbackType []string `toml:"positive_feedback_types"` // positive feedback type
-	PositiveFeedbackTTL  uint     `toml:"positive_feedback_ttl"`
-	ItemTTL              uint     `toml:"item_ttl"`
+	DataStore              string   `toml:"data_store"`              // database for data store
+	CacheStore             string   `toml:"cache_store"`             // database for cache store
+	AutoInsertUser         bool     `toml:"auto_insert_user"`        // insert new users while inserting feedback
+	AutoInsertItem         bool     `toml:"auto_insert_item"`        // insert new items while inserting feedback
+	CacheSize              int      `toml:"cache_size"`              // cache size for intermediate recommendation
+	PositiveFeedbackType   []string `toml:"positive_feedback_types"` // positive feedback type
+	PositiveFeedbackTTL    uint     `toml:"positive_feedback_ttl"`
+	ReadFeedbackType       []string `toml:"read_feedback_types"`       // feedback types of items shown to users
+	ConversionFeedbackType []string `toml:"conversion_feedback_types"` // feedback types of conversions
+	ItemTTL                uint     `toml:"item_ttl"`
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
@@ -90,13 +97,64 @@ func (config *MasterConfig) LoadDefaultIfNil() *MasterConfig {
 }
 
 type RecommendConfig struct {
-	PopularWindow      int    `toml:"popular_window"`
-	FitPeriod          int    `toml:"fit_period"`
-	MaxRecommendPeriod int    `toml:"max_recommend_period"`
-	SearchPeriod       int    `toml:"search_period"`
-	SearchEpoch        int    `toml:"search_epoch"`
-	SearchTrials       int    `toml:"search_trials"`
-	FallbackRecommend  string `toml:"fallback_recommend"`
+	PopularWindow      int     `toml:"popular_window"`
+	TrendingWindow     int     `toml:"trending_window"` // time window of trending items (days)
+	FitPeriod          int     `toml:"fit_period"`
+	FullSimilarPeriod  int     `toml:"full_similar_period"` // time period for full rebuild of similar items (minutes)
+	MaxRecommendPeriod int     `toml:"max_recommend_period"`
+	SearchPeriod       int     `toml:"search_period"`
+	SearchEpoch        int     `toml:"search_epoch"`
+	SearchTrials       int     `toml:"search_trials"`
+	FallbackRecommend  string  `toml:"fallback_recommend"`
+	SessionSize        int     `toml:"session_size"`   // number of recent items kept in session
+	SessionWeight      float32 `toml:"session_weight"` // weight of session-based recommendation
+	// Pipeline lists candidate sources for recommendation. If it's empty, the pipeline is
+	// collaborative → session → similar → cold_start → fallback.
+	Pipeline []StageConfig `toml:"pipeline"`
+	// Rank is the rank stage of the pipeline:
+	//  "none": sources fill recommendations in order.
+	//  "weighted": sources with positive weights are merged by weighted scores, then other sources fill in order.
+	Rank string `toml:"rank"`
+	// Diversity is the re-ranking stage of the pipeline:
+	//  "none": no re-ranking.
+	//  "similarity": maximal marginal relevance over item similarity.
+	//  "label": maximal marginal relevance over label overlap.
+	Diversity       string  `toml:"diversity"`
+	DiversityLambda float32 `toml:"diversity_lambda"` // trade-off between relevance and diversity
+	LabelCap        int     `toml:"label_cap"`        // max number of items per label (0 means no limit)
+	MetricWindow    int     `toml:"metric_window"`    // time window of online metrics (days)
+	// SplitMethod is how feedback is split into training and test sets for model fitting and searching:
+	//  "random": hold out a random feedback of each user.
+	//  "time": hold out the latest feedback by the ratio of TestRatio.
+	//  "leave_last_out": hold out the latest feedback of each user.
+	SplitMethod string  `toml:"split_method"`
+	TestRatio   float32 `toml:"test_ratio"` // ratio of feedback held out by the time split
+	Patience    int     `toml:"patience"`   // number of evaluations without improvement before early stopping (0 means never)
+	MinDelta    float32 `toml:"min_delta"`  // minimum increase of NDCG counted as improvement by early stopping
+	// RandomState is the seed to split feedback and fit models. A random seed is generated for
+	// each fitting if it's 0. Seeds are recorded in metadata of models anyway.
+	RandomState int64 `toml:"random_state"`
+	// Objective is weights of metrics maximized by model search. NDCG is the objective if no weight is set.
+	Objective ObjectiveConfig `toml:"objective"`
+}
+
+// ObjectiveConfig is weights of metrics in the objective of model search. Weights should be
+// negative if lower values are better.
+type ObjectiveConfig struct {
+	NDCG      float32 `toml:"ndcg"`
+	Precision float32 `toml:"precision"`
+	Recall    float32 `toml:"recall"`
+	Coverage  float32 `toml:"coverage"`  // fraction of items recommended
+	Diversity float32 `toml:"diversity"` // intra-list diversity by item labels
+	Novelty   float32 `toml:"novelty"`   // self-information of recommended items
+	Gini      float32 `toml:"gini"`      // Gini index of item exposures
+}
+
+// StageConfig is the configuration for a candidate source in the recommendation pipeline.
+type StageConfig struct {
+	Source string  `toml:"source"` // collaborative/session/sequential/similar/similar_users/cold_start/subscribe/popular/latest/trending/label_popular
+	Quota  int     `toml:"quota"`  // max number of items from this source (0 means no limit)
+	Weight float32 `toml:"weight"` // weight of this source in the weighted rank stage
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
@@ -104,29 +162,100 @@ func (config *RecommendConfig) LoadDefaultIfNil() *RecommendConfig {
 	if config == nil {
 		return &RecommendConfig{
 			PopularWindow:      1,
+			TrendingWindow:     1,
 			FitPeriod:          60,
+			FullSimilarPeriod:  1440,
 			MaxRecommendPeriod: 1,
 			SearchPeriod:       60,
 			SearchEpoch:        100,
 			SearchTrials:       10,
 			FallbackRecommend:  "latest",
+			SessionSize:        10,
+			SessionWeight:      0.5,
+			Rank:               "weighted",
+			Diversity:          "none",
+			DiversityLambda:    0.7,
+			MetricWindow:       1,
+			SplitMethod:        "random",
+			TestRatio:          0.2,
+			Patience:           0,
+			MinDelta:           0,
+			RandomState:        0,
 		}
 	}
 	return config
 }
 
+// GetPipeline returns candidate sources for recommendation. The default pipeline is built
+// if no source is declared.
+func (config *RecommendConfig) GetPipeline() []StageConfig {
+	if len(config.Pipeline) > 0 {
+		return config.Pipeline
+	}
+	pipeline := []StageConfig{{Source: "collaborative", Weight: 1 - config.SessionWeight}}
+	if config.SessionWeight > 0 {
+		pipeline = append(pipeline, StageConfig{Source: "session", Weight: config.SessionWeight})
+	}
+	return append(pipeline, StageConfig{Source: "similar"}, StageConfig{Source: "cold_start"},
+		StageConfig{Source: config.FallbackRecommend})
+}
+
+// ExperimentConfig is the configuration for an A/B test. Users are assigned to variants by
+// hashing user IDs with the salt, so that a user always sees the same variant.
+type ExperimentConfig struct {
+	Name     string          `toml:"name"`
+	Salt     string          `toml:"salt"`    // salt for user bucketing
+	Variants []VariantConfig `toml:"variant"` // the experiment is disabled if there is no variant
+}
+
+// VariantConfig is the configuration for a variant in an A/B test. Empty or zero settings are
+// inherited from the recommend section.
+type VariantConfig struct {
+	Name            string        `toml:"name"`
+	Traffic         float32       `toml:"traffic"` // share of users assigned to this variant
+	Rank            string        `toml:"rank"`
+	Pipeline        []StageConfig `toml:"pipeline"`
+	Diversity       string        `toml:"diversity"`
+	DiversityLambda float32       `toml:"diversity_lambda"`
+	LabelCap        int           `toml:"label_cap"`
+}
+
+// Assign a user to a variant. Shares of users are proportional to traffic of variants. Nil is
+// returned if the experiment is disabled.
+func (config *ExperimentConfig) Assign(userId string) *VariantConfig {
+	var total float32
+	for _, variant := range config.Variants {
+		total += variant.Traffic
+	}
+	if total <= 0 {
+		return nil
+	}
+	hash := md5.Sum([]byte(config.Salt + "/" + userId))
+	bucket := float32(float64(binary.BigEndian.Uint64(hash[:8])) / (1 << 64) * float64(total))
+	for i := range config.Variants {
+		bucket -= config.Variants[i].Traffic
+		if bucket < 0 {
+			return &config.Variants[i]
+		}
+	}
+	return &config.Variants[len(config.Variants)-1]
+}
+
 // ServerConfig is the configuration for the server.
 type ServerConfig struct {
-	APIKey   string `toml:"api_key"`
-	DefaultN int    `toml:"default_n"`
+	APIKey        string `toml:"api_key"`
+	DefaultN      int    `toml:"default_n"`
+	ImpressionLog bool   `toml:"impression_log"` // log items returned by recommendation
+	ImpressionTTL int    `toml:"impression_ttl"` // days to keep impressions, 0 means forever
 }
 
 // LoadDefaultIfNil loads default settings if config is nil.
 func (config *ServerConfig) LoadDefaultIfNil() *ServerConfig {
 	if config == nil {
 		return &ServerConfig{
-			APIKey:   "",
-			DefaultN: 10,
+			APIKey:        "",
+			DefaultN:      10,
+			ImpressionTTL: 30,
 		}
 	}
 	return config
@@ -176,14 +305,23 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("server", "default_n") {
 		config.Server.DefaultN = defaultServerConfig.DefaultN
 	}
+	if !meta.IsDefined("server", "impression_ttl") {
+		config.Server.ImpressionTTL = defaultServerConfig.ImpressionTTL
+	}
 	// Default recommend config
 	defaultRecommendConfig := *(*RecommendConfig)(nil).LoadDefaultIfNil()
 	if !meta.IsDefined("recommend", "popular_window") {
 		config.Recommend.PopularWindow = defaultRecommendConfig.PopularWindow
 	}
+	if !meta.IsDefined("recommend", "trending_window") {
+		config.Recommend.TrendingWindow = defaultRecommendConfig.TrendingWindow
+	}
 	if !meta.IsDefined("recommend", "fit_period") {
 		config.Recommend.FitPeriod = defaultRecommendConfig.FitPeriod
 	}
+	if !meta.IsDefined("recommend", "full_similar_period") {
+		config.Recommend.FullSimilarPeriod = defaultRecommendConfig.FullSimilarPeriod
+	}
 	if !meta.IsDefined("recommend", "max_recommend_period") {
 		config.Recommend.MaxRecommendPeriod = defaultRecommendConfig.MaxRecommendPeriod
 	}
@@ -199,6 +337,39 @@ func (config *Config) FillDefault(meta toml.MetaData) {
 	if !meta.IsDefined("recommend", "fallback_recommend") {
 		config.Recommend.FallbackRecommend = defaultRecommendConfig.FallbackRecommend
 	}
+	if !meta.IsDefined("recommend", "session_size") {
+		config.Recommend.SessionSize = defaultRecommendConfig.SessionSize
+	}
+	if !meta.IsDefined("recommend", "session_weight") {
+		config.Recommend.SessionWeight = defaultRecommendConfig.SessionWeight
+	}
+	if !meta.IsDefined("recommend", "rank") {
+		config.Recommend.Rank = defaultRecommendConfig.Rank
+	}
+	if !meta.IsDefined("recommend", "diversity") {
+		config.Recommend.Diversity = defaultRecommendConfig.Diversity
+	}
+	if !meta.IsDefined("recommend", "diversity_lambda") {
+		config.Recommend.DiversityLambda = defaultRecommendConfig.DiversityLambda
+	}
+	if !meta.IsDefined("recommend", "metric_window") {
+		config.Recommend.MetricWindow = defaultRecommendConfig.MetricWindow
+	}
+	if !meta.IsDefined("recommend", "split_method") {
+		config.Recommend.SplitMethod = defaultRecommendConfig.SplitMethod
+	}
+	if !meta.IsDefined("recommend", "test_ratio") {
+		config.Recommend.TestRatio = defaultRecommendConfig.TestRatio
+	}
+	if !meta.IsDefined("recommend", "patience") {
+		config.Recommend.Patience = defaultRecommendConfig.Patience
+	}
+	if !meta.IsDefined("recommend", "min_delta") {
+		config.Recommend.MinDelta = defaultRecommendConfig.MinDelta
+	}
+	if !meta.IsDefined("recommend", "random_state") {
+		config.Recommend.RandomState = defaultRecommendConfig.RandomState
+	}
 }
 
 // LoadConfig loads configuration from toml file.
@@ -14,6 +14,7 @@
 package config
 
 import (
+	"strconv"
 	"testing"
 
 	"github.com/BurntSushi/toml"
@@ -32,6 +33,8 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, []string{"star", "fork"}, config.Database.PositiveFeedbackType)
 	assert.Equal(t, uint(998), config.Database.PositiveFeedbackTTL)
 	assert.Equal(t, uint(999), config.Database.ItemTTL)
+	assert.Equal(t, []string{"read"}, config.Database.ReadFeedbackType)
+	assert.Equal(t, []string{"buy"}, config.Database.ConversionFeedbackType)
 
 	// master configuration
 	assert.Equal(t, 8086, config.Master.Port)
@@ -45,14 +48,44 @@ func TestLoadConfig(t *testing.T) {
 	// server configuration
 	assert.Equal(t, 128, config.Server.DefaultN)
 	assert.Equal(t, "p@ssword", config.Server.APIKey)
+	assert.True(t, config.Server.ImpressionLog)
+	assert.Equal(t, 7, config.Server.ImpressionTTL)
 
 	// recommend configuration
 	assert.Equal(t, 12, config.Recommend.PopularWindow)
 	assert.Equal(t, 66, config.Recommend.FitPeriod)
+	assert.Equal(t, 720, config.Recommend.FullSimilarPeriod)
 	assert.Equal(t, 88, config.Recommend.SearchPeriod)
 	assert.Equal(t, 102, config.Recommend.SearchEpoch)
 	assert.Equal(t, 9, config.Recommend.SearchTrials)
 	assert.Equal(t, "latest", config.Recommend.FallbackRecommend)
+	assert.Equal(t, 20, config.Recommend.SessionSize)
+	assert.Equal(t, float32(0.3), config.Recommend.SessionWeight)
+	assert.Equal(t, 2, config.Recommend.TrendingWindow)
+	assert.Equal(t, "none", config.Recommend.Rank)
+	assert.Equal(t, "label", config.Recommend.Diversity)
+	assert.Equal(t, float32(0.6), config.Recommend.DiversityLambda)
+	assert.Equal(t, 3, config.Recommend.LabelCap)
+	assert.Equal(t, 7, config.Recommend.MetricWindow)
+	assert.Equal(t, "time", config.Recommend.SplitMethod)
+	assert.Equal(t, float32(0.1), config.Recommend.TestRatio)
+	assert.Equal(t, 3, config.Recommend.Patience)
+	assert.Equal(t, float32(0.001), config.Recommend.MinDelta)
+	assert.Equal(t, int64(42), config.Recommend.RandomState)
+	assert.Equal(t, []StageConfig{
+		{Source: "collaborative", Quota: 6, Weight: 0.7},
+		{Source: "trending", Quota: 4},
+	}, config.Recommend.Pipeline)
+	assert.Equal(t, config.Recommend.Pipeline, config.Recommend.GetPipeline())
+	assert.Equal(t, ObjectiveConfig{NDCG: 1, Coverage: 0.2, Gini: -0.1}, config.Recommend.Objective)
+
+	// experiment configuration
+	assert.Equal(t, "diversity", config.Experiment.Name)
+	assert.Equal(t, "2021", config.Experiment.Salt)
+	assert.Equal(t, []VariantConfig{
+		{Name: "control", Traffic: 0.5},
+		{Name: "treatment", Traffic: 0.5, Diversity: "similarity"},
+	}, config.Experiment.Variants)
 }
 
 func TestConfig_FillDefault(t *testing.T) {
@@ -62,3 +95,53 @@ func TestConfig_FillDefault(t *testing.T) {
 	config.FillDefault(meta)
 	assert.Equal(t, *(*Config)(nil).LoadDefaultIfNil(), config)
 }
+
+func TestRecommendConfig_GetPipeline(t *testing.T) {
+	config := (*RecommendConfig)(nil).LoadDefaultIfNil()
+	assert.Equal(t, []StageConfig{
+		{Source: "collaborative", Weight: 0.5},
+		{Source: "session", Weight: 0.5},
+		{Source: "similar"},
+		{Source: "cold_start"},
+		{Source: "latest"},
+	}, config.GetPipeline())
+	config.SessionWeight = 0
+	assert.Equal(t, []StageConfig{
+		{Source: "collaborative", Weight: 1},
+		{Source: "similar"},
+		{Source: "cold_start"},
+		{Source: "latest"},
+	}, config.GetPipeline())
+}
+
+func TestExperimentConfig_Assign(t *testing.T) {
+	// disabled experiment
+	var config ExperimentConfig
+	assert.Nil(t, config.Assign("0"))
+	// split traffic
+	config = ExperimentConfig{
+		Salt: "salt",
+		Variants: []VariantConfig{
+			{Name: "a", Traffic: 1},
+			{Name: "b", Traffic: 3},
+		},
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		variant := config.Assign(strconv.Itoa(i))
+		counts[variant.Name]++
+		// assignment is deterministic
+		assert.Equal(t, variant, config.Assign(strconv.Itoa(i)))
+	}
+	assert.InDelta(t, 2500, counts["a"], 300)
+	assert.InDelta(t, 7500, counts["b"], 300)
+	// salt reshuffles users
+	moved := 0
+	salted := ExperimentConfig{Salt: "pepper", Variants: config.Variants}
+	for i := 0; i < 10000; i++ {
+		if config.Assign(strconv.Itoa(i)).Name != salted.Assign(strconv.Itoa(i)).Name {
+			moved++
+		}
+	}
+	assert.Greater(t, moved, 2000)
+}
@@ -2,10 +2,18 @@ package master
 
 import (
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
 )
 
 type LocalCache struct {
@@ -15,6 +23,126 @@ type LocalCache struct {
 	Model        pr.Model
 	ModelScore   pr.Score
 	UserIndex    base.Index
+	ModelMeta    ModelMeta
+}
+
+// ModelMeta records how a version of the personal ranking model was fitted. A model could be
+// fitted again bit-for-bit by FitModel given the metadata and a dataset with the same fingerprint.
+type ModelMeta struct {
+	Name         string         // name of the model
+	Version      int64          // version of the model
+	Params       model.Params   // hyper-parameters of the model
+	Seed         int64          // seed to split the dataset and fit the model
+	DataSet      pr.Fingerprint // fingerprint of the dataset
+	Config       string         // configuration in JSON
+	GorseVersion string         // version of gorse
+	Checksum     string         // checksum of the fitted model
+	FitTime      time.Time      // time when the fitting started
+}
+
+// modelMetaRecord is the metadata of a model stored in the data store. Hyper-parameters are stored
+// with their types since numbers are decoded as float64 from JSON.
+type modelMetaRecord struct {
+	ModelMeta
+	Params []typedParam
+}
+
+type typedParam struct {
+	Name  model.ParamName
+	Type  string
+	Value string
+}
+
+func encodeParams(params model.Params) ([]typedParam, error) {
+	typedParams := make([]typedParam, 0, len(params))
+	for name, value := range params {
+		param := typedParam{Name: name}
+		switch value := value.(type) {
+		case int:
+			param.Type, param.Value = "int", strconv.Itoa(value)
+		case int64:
+			param.Type, param.Value = "int64", strconv.FormatInt(value, 10)
+		case float32:
+			param.Type, param.Value = "float32", strconv.FormatFloat(float64(value), 'g', -1, 32)
+		case float64:
+			param.Type, param.Value = "float64", strconv.FormatFloat(value, 'g', -1, 64)
+		case string:
+			param.Type, param.Value = "string", value
+		case bool:
+			param.Type, param.Value = "bool", strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("unsupported type %T of hyper-parameter %v", value, name)
+		}
+		typedParams = append(typedParams, param)
+	}
+	sort.Slice(typedParams, func(i, j int) bool {
+		return typedParams[i].Name < typedParams[j].Name
+	})
+	return typedParams, nil
+}
+
+func decodeParams(typedParams []typedParam) (model.Params, error) {
+	params := make(model.Params, len(typedParams))
+	for _, param := range typedParams {
+		var value interface{}
+		var err error
+		switch param.Type {
+		case "int":
+			value, err = strconv.Atoi(param.Value)
+		case "int64":
+			value, err = strconv.ParseInt(param.Value, 10, 64)
+		case "float32":
+			var f float64
+			f, err = strconv.ParseFloat(param.Value, 32)
+			value = float32(f)
+		case "float64":
+			value, err = strconv.ParseFloat(param.Value, 64)
+		case "string":
+			value = param.Value
+		case "bool":
+			value, err = strconv.ParseBool(param.Value)
+		default:
+			err = fmt.Errorf("unsupported type %v of hyper-parameter %v", param.Type, param.Name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		params[param.Name] = value
+	}
+	return params, nil
+}
+
+// SaveModelMeta records metadata of a version of the model to the data store.
+func SaveModelMeta(dataStore data.Database, meta ModelMeta) error {
+	params, err := encodeParams(meta.Params)
+	if err != nil {
+		return err
+	}
+	text, err := json.Marshal(modelMetaRecord{ModelMeta: meta, Params: params})
+	if err != nil {
+		return err
+	}
+	return dataStore.InsertModelMeta(data.ModelMeta{
+		Version:   base.Hex(meta.Version),
+		Meta:      string(text),
+		Timestamp: meta.FitTime,
+	})
+}
+
+// LoadModelMeta loads metadata of a version (in hex) of the model from the data store.
+func LoadModelMeta(dataStore data.Database, version string) (ModelMeta, error) {
+	var record modelMetaRecord
+	meta, err := dataStore.GetModelMeta(version)
+	if err != nil {
+		return ModelMeta{}, err
+	}
+	if err = json.Unmarshal([]byte(meta.Meta), &record); err != nil {
+		return ModelMeta{}, err
+	}
+	if record.ModelMeta.Params, err = decodeParams(record.Params); err != nil {
+		return ModelMeta{}, err
+	}
+	return record.ModelMeta, nil
 }
 
 func LoadLocalCache(path string) (*LocalCache, error) {
@@ -64,6 +192,11 @@ func LoadLocalCache(path string) (*LocalCache, error) {
 	if err != nil {
 		return state, err
 	}
+	// 6. model metadata (absent in caches written by previous versions)
+	err = decoder.Decode(&state.ModelMeta)
+	if err != nil && err != io.EOF {
+		return state, err
+	}
 	return state, nil
 }
 
@@ -103,5 +236,10 @@ func (c *LocalCache) WriteLocalCache() error {
 		return err
 	}
 	// 5. user index
-	return encoder.Encode(c.UserIndex)
+	err = encoder.Encode(c.UserIndex)
+	if err != nil {
+		return err
+	}
+	// 6. model metadata
+	return encoder.Encode(c.ModelMeta)
 }
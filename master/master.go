@@ -62,9 +62,20 @@ type Master struct {
 	prModelName string
 	prVersion   int64
 	prScore     pr.Score
+	prMeta      ModelMeta
 	prMutex     sync.Mutex
 	prSearcher  *pr.ModelSearcher
 
+	// sequential model
+	sequentialModel   pr.Model
+	sequentialVersion int64
+	sequentialMutex   sync.Mutex
+
+	// similar items
+	similarUserChecksums map[string]uint64 // checksums of feedback of users at the last collection
+	similarItemChecksums map[string]uint64 // checksums of feedback of items at the last collection
+	lastFullSimilarTime  time.Time
+
 	// factorization machine
 	//fmModel    ctr.FactorizationMachine
 	//ctrVersion int64
@@ -78,13 +89,14 @@ func NewMaster(cfg *config.Config) *Master {
 	return &Master{
 		nodesInfo: make(map[string]*Node),
 		// init versions
-		prVersion: rand.Int63(),
+		prVersion:         rand.Int63(),
+		sequentialVersion: rand.Int63(),
 		// ctrVersion:       rand.Int63(),
 		userIndexVersion: rand.Int63(),
 		// default model
 		prModelName: "bpr",
 		prModel:     pr.NewBPR(nil),
-		prSearcher:  pr.NewModelSearcher(cfg.Recommend.SearchEpoch, cfg.Recommend.SearchTrials),
+		prSearcher:  pr.NewModelSearcher(cfg.Recommend.SearchEpoch, cfg.Recommend.SearchTrials, pr.Objective(cfg.Recommend.Objective)),
 		RestServer: server.RestServer{
 			GorseConfig: cfg,
 			HttpHost:    cfg.Master.HttpHost,
@@ -113,6 +125,8 @@ func (m *Master) Serve() {
 		m.prModelName = m.localCache.ModelName
 		m.prVersion = m.localCache.ModelVersion
 		m.prScore = m.localCache.ModelScore
+		m.prMeta = m.localCache.ModelMeta
+		m.SetPRModel(m.localCache.Model)
 	}
 
 	// create cluster meta cache
@@ -166,9 +180,11 @@ func (m *Master) Serve() {
 func (m *Master) FitLoop() {
 	defer base.CheckPanic()
 	lastNumUsers, lastNumItems, lastNumFeedback := 0, 0, 0
-	var bestName string
+	var bestName, prModelName string
 	var bestModel pr.Model
 	var bestScore pr.Score
+	var prParams model.Params
+	objective := pr.Objective(m.GorseConfig.Recommend.Objective)
 	for {
 		// download dataset
 		base.Logger().Info("load dataset for model fit", zap.Strings("feedback_types", m.GorseConfig.Database.PositiveFeedbackType))
@@ -197,8 +213,8 @@ func (m *Master) FitLoop() {
 		bestName, bestModel, bestScore = m.prSearcher.GetBestModel()
 		m.prMutex.Lock()
 		if bestName != "" &&
-			(bestName != m.prModelName || bestModel.GetParams().ToString() != m.prModel.GetParams().ToString()) &&
-			(bestScore.NDCG > m.prScore.NDCG) {
+			(bestName != m.prModelName || !sameParams(bestModel.GetParams(), m.prModel.GetParams())) &&
+			(objective.Of(bestScore) > objective.Of(m.prScore)) {
 			// 1. best model must have been found.
 			// 2. best model must be different from current model
 			// 3. best model must perform better than current model
@@ -212,6 +228,7 @@ func (m *Master) FitLoop() {
 			m.prMutex.Unlock()
 			goto sleep
 		}
+		prModelName, prParams = m.prModelName, m.prModel.GetParams()
 		m.prMutex.Unlock()
 		lastNumUsers, lastNumItems, lastNumFeedback = dataSet.UserCount(), dataSet.ItemCount(), dataSet.Count()
 		// update user index
@@ -220,11 +237,25 @@ func (m *Master) FitLoop() {
 		m.userIndexVersion++
 		m.userIndexMutex.Unlock()
 		// fit model
-		m.fitPRModel(dataSet, m.prModel)
+		m.fitPRModel(dataSet, prModelName, prParams)
+		// fit sequential model
+		m.fitSequentialModel(dataSet)
 		// collect similar items
 		m.similar(items, dataSet, model.SimilarityDot)
+		// collect similar users
+		m.similarUsers(dataSet, model.SimilarityDot)
 		// collect popular items
 		m.popItem(items, feedbacks)
+		// collect popular items by user labels
+		m.userLabelPopular(feedbacks)
+		// collect trending items
+		m.trending(items, feedbacks)
+		// evaluate experiment
+		m.experiment(feedbacks)
+		// remove expired impressions
+		m.expireImpressions()
+		// evaluate online metrics
+		m.onlineMetrics(items, feedbacks)
 		// collect latest items
 		m.latest(items)
 		// sleep
@@ -233,12 +264,23 @@ func (m *Master) FitLoop() {
 	}
 }
 
+// sameParams checks whether hyper-parameters are the same except the random state, since the
+// random state of a fitted model is the seed recorded in its metadata.
+func sameParams(a, b model.Params) bool {
+	a, b = a.Copy(), b.Copy()
+	delete(a, model.RandomState)
+	delete(b, model.RandomState)
+	return a.ToString() == b.ToString()
+}
+
 // SearchLoop searches optimal recommendation model in background. It never modifies variables other than prSearcher.
 func (m *Master) SearchLoop() {
 	defer base.CheckPanic()
 	lastNumUsers, lastNumItems, lastNumFeedback := 0, 0, 0
+	m.warmStartSearcher()
 	for {
 		var trainSet, valSet *pr.DataSet
+		var seed int64
 		// download dataset
 		base.Logger().Info("load dataset for model search", zap.Strings("feedback_types", m.GorseConfig.Database.PositiveFeedbackType))
 		dataSet, _, _, err := pr.LoadDataFromDatabase(m.DataStore, m.GorseConfig.Database.PositiveFeedbackType,
@@ -257,12 +299,87 @@ func (m *Master) SearchLoop() {
 			goto sleep
 		}
 		// start search
-		trainSet, valSet = dataSet.Split(0, 0)
-		err = m.prSearcher.Fit(trainSet, valSet)
+		seed = m.randomState()
+		trainSet, valSet = split(dataSet, &m.GorseConfig.Recommend, seed)
+		err = m.prSearcher.Fit(trainSet, valSet, seed)
 		if err != nil {
 			base.Logger().Error("failed to search model", zap.Error(err))
+		} else {
+			m.saveTrials(m.prSearcher.GetTrials())
 		}
 	sleep:
 		time.Sleep(time.Duration(m.GorseConfig.Recommend.SearchPeriod) * time.Minute)
 	}
 }
+
+// numRecentTrials is the number of recent trials loaded for warm start and the leaderboard.
+const numRecentTrials = 1000
+
+// warmStartSearcher loads previous trials of model search from the data store.
+func (m *Master) warmStartSearcher() {
+	trials, err := m.DataStore.GetTrials(numRecentTrials)
+	if err != nil {
+		base.Logger().Error("failed to load trials", zap.Error(err))
+		return
+	}
+	prTrials := make([]pr.Trial, len(trials))
+	// trials are added from old to new
+	for i, trial := range trials {
+		prTrials[len(trials)-1-i] = fromDataTrial(trial)
+	}
+	m.prSearcher.WarmStart(prTrials)
+	base.Logger().Info("warm start model searcher", zap.Int("n_trials", len(trials)))
+}
+
+// saveTrials saves trials of model search to the data store.
+func (m *Master) saveTrials(trials []pr.Trial) {
+	timestamp := time.Now()
+	for i, trial := range trials {
+		trialId := fmt.Sprintf("%x-%d", timestamp.UnixNano(), i)
+		if err := m.DataStore.InsertTrial(toDataTrial(trialId, trial, timestamp)); err != nil {
+			base.Logger().Error("failed to insert trial", zap.Error(err))
+		}
+	}
+}
+
+func toDataTrial(trialId string, trial pr.Trial, timestamp time.Time) data.Trial {
+	params := make(map[string]interface{}, len(trial.Params))
+	for name, value := range trial.Params {
+		params[string(name)] = value
+	}
+	return data.Trial{
+		TrialId:   trialId,
+		Model:     trial.Model,
+		Params:    params,
+		NDCG:      trial.Score.NDCG,
+		Precision: trial.Score.Precision,
+		Recall:    trial.Score.Recall,
+		Coverage:  trial.Score.Coverage,
+		Diversity: trial.Score.Diversity,
+		Novelty:   trial.Score.Novelty,
+		Gini:      trial.Score.Gini,
+		FitTime:   float32(trial.FitTime.Seconds()),
+		Timestamp: timestamp,
+	}
+}
+
+func fromDataTrial(trial data.Trial) pr.Trial {
+	params := make(model.Params, len(trial.Params))
+	for name, value := range trial.Params {
+		params[model.ParamName(name)] = value
+	}
+	return pr.Trial{
+		Model:  trial.Model,
+		Params: params,
+		Score: pr.Score{
+			NDCG:      trial.NDCG,
+			Precision: trial.Precision,
+			Recall:    trial.Recall,
+			Coverage:  trial.Coverage,
+			Diversity: trial.Diversity,
+			Novelty:   trial.Novelty,
+			Gini:      trial.Gini,
+		},
+		FitTime: time.Duration(float64(trial.FitTime) * float64(time.Second)),
+	}
+}
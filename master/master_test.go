@@ -14,14 +14,22 @@
 package master
 
 import (
+	"context"
+	"fmt"
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/protocol"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
@@ -166,6 +174,62 @@ func TestMaster_CollectPopItem(t *testing.T) {
 	}, popular)
 }
 
+func TestMaster_CollectTrending(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Recommend.TrendingWindow = 1
+	// collect trending
+	items := []data.Item{
+		{"0", time.Now(), []string{"even"}, ""},
+		{"1", time.Now(), []string{"odd"}, ""},
+		{"2", time.Now(), []string{"even"}, ""},
+		{"3", time.Now(), []string{"odd"}, ""},
+	}
+	feedbacks := make([]data.Feedback, 0)
+	for i := 0; i < 4; i++ {
+		// feedback in the latest window
+		for j := 0; j < 10; j++ {
+			feedbacks = append(feedbacks, data.Feedback{
+				FeedbackKey: data.FeedbackKey{ItemId: strconv.Itoa(i), UserId: strconv.Itoa(j)},
+				Timestamp:   time.Now().Add(-time.Hour),
+			})
+		}
+		// feedback in the previous window
+		for j := 0; j < 3*i; j++ {
+			feedbacks = append(feedbacks, data.Feedback{
+				FeedbackKey: data.FeedbackKey{ItemId: strconv.Itoa(i), UserId: strconv.Itoa(j)},
+				Timestamp:   time.Now().Add(-time.Hour * 36),
+			})
+		}
+		// feedback out of windows
+		for j := 0; j < 100; j++ {
+			feedbacks = append(feedbacks, data.Feedback{
+				FeedbackKey: data.FeedbackKey{ItemId: strconv.Itoa(i), UserId: strconv.Itoa(j)},
+				Timestamp:   time.Now().AddDate(-1, 0, 0),
+			})
+		}
+	}
+	m.trending(items, feedbacks)
+	// check trending items
+	trending, err := m.CacheStore.GetScores(cache.TrendingItems, "", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{ItemId: "0", Score: 10},
+		{ItemId: "1", Score: 7},
+		{ItemId: "2", Score: 4},
+	}, trending)
+	trending, err = m.CacheStore.GetScores(cache.TrendingItems, "odd", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{
+		{ItemId: "1", Score: 7},
+		{ItemId: "3", Score: 1},
+	}, trending)
+}
+
 func TestMaster_FitCFModel(t *testing.T) {
 	// create mock master
 	m := newMockMaster(t)
@@ -213,3 +277,431 @@ func TestMaster_FitCFModel(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"8", "7", "6"}, cache.RemoveScores(similar))
 }
+
+func TestMaster_CollectSimilarIncremental(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.FitJobs = 4
+	m.GorseConfig.Recommend.FullSimilarPeriod = 60
+	// user 0 and 1 give feedback to items 0 and 1, user 2 and 3 give feedback to items 2 and 3
+	feedbacks := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "0", ItemId: "0"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "0", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "1", ItemId: "0"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "1", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "2", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "2", ItemId: "3"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "3", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "3", ItemId: "3"}},
+	}
+	err := m.DataStore.BatchInsertFeedback(feedbacks, true, true)
+	assert.Nil(t, err)
+	dataset, _, _, err := pr.LoadDataFromDatabase(m.DataStore, []string{"FeedbackType"}, 0, 0)
+	assert.Nil(t, err)
+	// the first collection is a full rebuild
+	m.similar(nil, dataset, model.SimilarityDot)
+	similar, err := m.CacheStore.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"1", 2}}, similar)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "2", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"3", 2}}, similar)
+	// mark neighbors of item 2 to detect recomputation
+	err = m.CacheStore.SetScores(cache.SimilarItems, "2", []cache.ScoredItem{{"mark", 0}})
+	assert.Nil(t, err)
+	// user 0 gives feedback to item 4, so that only items 0, 1 and 4 are updated
+	err = m.DataStore.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "0", ItemId: "4"}},
+	}, true, true)
+	assert.Nil(t, err)
+	dataset, _, _, err = pr.LoadDataFromDatabase(m.DataStore, []string{"FeedbackType"}, 0, 0)
+	assert.Nil(t, err)
+	m.similar(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"1", 2}, {"4", 1}}, similar)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "4", 0, 100)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []cache.ScoredItem{{"0", 1}, {"1", 1}}, similar)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "2", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"mark", 0}}, similar)
+	// all items are updated in a full rebuild
+	m.lastFullSimilarTime = time.Now().Add(-time.Hour)
+	m.similar(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "2", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"3", 2}}, similar)
+	// user 0 moves from item 4 to item 2 and user 3 moves from item 2 to item 4, so that
+	// feedback counts of all users and items are unchanged
+	_, err = m.DataStore.DeleteUserItemFeedback("0", "4", nil)
+	assert.Nil(t, err)
+	_, err = m.DataStore.DeleteUserItemFeedback("3", "2", nil)
+	assert.Nil(t, err)
+	err = m.DataStore.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "0", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "3", ItemId: "4"}},
+	}, true, true)
+	assert.Nil(t, err)
+	dataset, _, _, err = pr.LoadDataFromDatabase(m.DataStore, []string{"FeedbackType"}, 0, 0)
+	assert.Nil(t, err)
+	m.similar(nil, dataset, model.SimilarityDot)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "4", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"3", 1}}, similar)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "2", 0, 100)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []cache.ScoredItem{{"0", 1}, {"1", 1}, {"3", 1}}, similar)
+	// user 4 gives feedback to item 0, so that cosine similarities to item 0 are updated
+	m.lastFullSimilarTime = time.Now().Add(-time.Hour)
+	m.similar(nil, dataset, model.SimilarityCosine)
+	err = m.DataStore.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "FeedbackType", UserId: "4", ItemId: "0"}},
+	}, true, true)
+	assert.Nil(t, err)
+	dataset, _, _, err = pr.LoadDataFromDatabase(m.DataStore, []string{"FeedbackType"}, 0, 0)
+	assert.Nil(t, err)
+	m.similar(nil, dataset, model.SimilarityCosine)
+	similar, err = m.CacheStore.GetScores(cache.SimilarItems, "1", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, "0", similar[0].ItemId)
+	assert.InDelta(t, 2/math.Sqrt(6), similar[0].Score, 1e-5)
+}
+
+func TestMaster_CollectSimilarUsers(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Master.FitJobs = 4
+	// user i gives feedback to items 0, 1, ..., i
+	feedbacks := make([]data.Feedback, 0)
+	for i := 0; i < 10; i++ {
+		for j := 0; j <= i; j++ {
+			feedbacks = append(feedbacks, data.Feedback{
+				FeedbackKey: data.FeedbackKey{
+					ItemId:       strconv.Itoa(j),
+					UserId:       strconv.Itoa(i),
+					FeedbackType: "FeedbackType",
+				},
+				Timestamp: time.Now(),
+			})
+		}
+	}
+	err := m.DataStore.BatchInsertFeedback(feedbacks, true, true)
+	assert.Nil(t, err)
+	dataset, _, _, err := pr.LoadDataFromDatabase(m.DataStore, []string{"FeedbackType"}, 0, 0)
+	assert.Nil(t, err)
+	// similar users (common items)
+	m.similarUsers(dataset, model.SimilarityDot)
+	similar, err := m.CacheStore.GetScores(cache.SimilarUsers, "9", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"8", 9}, {"7", 8}, {"6", 7}}, similar)
+	similar, err = m.CacheStore.GetScores(cache.SimilarUsers, "0", 0, 100)
+	assert.Nil(t, err)
+	assert.Len(t, similar, 3)
+	for _, user := range similar {
+		assert.Equal(t, float32(1), user.Score)
+	}
+}
+
+func TestMaster_Experiment(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.ReadFeedbackType = []string{"read"}
+	m.GorseConfig.Experiment = config.ExperimentConfig{
+		Name: "test",
+		Variants: []config.VariantConfig{
+			{Name: "a", Traffic: 1},
+			{Name: "b", Traffic: 1},
+		},
+	}
+	// insert read feedback
+	feedbacks := make([]data.Feedback, 0)
+	numShown, numClicked := make(map[string]int), make(map[string]int)
+	for i := 0; i < 20; i++ {
+		userId := strconv.Itoa(i)
+		variant := m.GorseConfig.Experiment.Assign(userId).Name
+		for j := 0; j < 5; j++ {
+			itemId := strconv.Itoa(j)
+			err := m.DataStore.InsertFeedback(data.Feedback{
+				FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: userId, ItemId: itemId},
+				Timestamp:   time.Now(),
+			}, true, true)
+			assert.Nil(t, err)
+			numShown[variant]++
+			// users in variant a click more items
+			if (variant == "a" && j < 3) || (variant == "b" && j < 1) {
+				feedbacks = append(feedbacks, data.Feedback{
+					FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: userId, ItemId: itemId},
+					Timestamp:   time.Now(),
+				})
+				numClicked[variant]++
+			}
+		}
+	}
+	m.experiment(feedbacks)
+	// check measurements
+	measurements, err := m.DataStore.GetMeasurements(CTRMeasurement("test", "a"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(measurements))
+	assert.Equal(t, float32(0.6), measurements[0].Value)
+	assert.Equal(t, fmt.Sprintf("%d/%d", numClicked["a"], numShown["a"]), measurements[0].Comment)
+	measurements, err = m.DataStore.GetMeasurements(CTRMeasurement("test", "b"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(measurements))
+	assert.Equal(t, float32(0.2), measurements[0].Value)
+	assert.Equal(t, fmt.Sprintf("%d/%d", numClicked["b"], numShown["b"]), measurements[0].Comment)
+}
+
+func TestMaster_OnlineMetrics(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.ConversionFeedbackType = []string{"buy"}
+	m.GorseConfig.Recommend.MetricWindow = 1
+	// insert impressions
+	items := []data.Item{
+		{ItemId: "1", Labels: []string{"a"}},
+		{ItemId: "2", Labels: []string{"a"}},
+		{ItemId: "3", Labels: []string{"b"}},
+		{ItemId: "4", Labels: []string{"b"}},
+	}
+	shown := time.Now().Add(-time.Hour)
+	err := m.DataStore.InsertImpressions([]data.Impression{
+		{RequestId: "0", UserId: "0", ItemId: "1", Position: 1, Source: "collaborative", Timestamp: shown},
+		{RequestId: "0", UserId: "0", ItemId: "2", Position: 2, Source: "collaborative", Timestamp: shown},
+		{RequestId: "0", UserId: "0", ItemId: "3", Position: 3, Source: "popular", Timestamp: shown},
+		{RequestId: "1", UserId: "1", ItemId: "1", Position: 1, Source: "collaborative", Timestamp: shown},
+		{RequestId: "1", UserId: "1", ItemId: "3", Position: 2, Source: "popular", Timestamp: shown},
+		// impressions out of the window
+		{RequestId: "2", UserId: "2", ItemId: "4", Position: 1, Source: "latest", Timestamp: time.Now().AddDate(0, 0, -3)},
+	}, 0)
+	assert.Nil(t, err)
+	// insert feedback
+	feedbacks := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "3"}, Timestamp: time.Now()},
+		// feedback before impressions
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "2"}, Timestamp: time.Now().Add(-2 * time.Hour)},
+	}
+	err = m.DataStore.InsertFeedback(data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "buy", UserId: "0", ItemId: "1"},
+		Timestamp:   time.Now(),
+	}, true, true)
+	assert.Nil(t, err)
+	m.onlineMetrics(items, feedbacks)
+	// check measurements
+	expected := map[string]float32{
+		OnlineMeasurement(OnlineCTR, "", ""):                           0.4,
+		OnlineMeasurement(OnlineConversion, "", ""):                    0.2,
+		OnlineMeasurement(OnlineCoverage, "", ""):                      0.75,
+		OnlineMeasurement(OnlineCTR, "source", "collaborative"):        float32(1) / 3,
+		OnlineMeasurement(OnlineConversion, "source", "collaborative"): float32(1) / 3,
+		OnlineMeasurement(OnlineCoverage, "source", "collaborative"):   0.5,
+		OnlineMeasurement(OnlineCTR, "source", "popular"):              0.5,
+		OnlineMeasurement(OnlineConversion, "source", "popular"):       0,
+		OnlineMeasurement(OnlineCoverage, "source", "popular"):         0.25,
+		OnlineMeasurement(OnlineCTR, "label", "a"):                     float32(1) / 3,
+		OnlineMeasurement(OnlineCoverage, "label", "a"):                1,
+		OnlineMeasurement(OnlineCTR, "label", "b"):                     0.5,
+		OnlineMeasurement(OnlineCoverage, "label", "b"):                0.5,
+	}
+	for name, value := range expected {
+		measurements, err := m.DataStore.GetMeasurements(name, 1)
+		assert.Nil(t, err)
+		if assert.Equal(t, 1, len(measurements), name) {
+			assert.InDelta(t, value, measurements[0].Value, 1e-6, name)
+		}
+	}
+	names, err := m.CacheStore.GetList(cache.OnlineMetrics, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 15, len(names))
+}
+
+func TestMaster_CollectUserLabelPopular(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	// create config
+	m.GorseConfig = &config.Config{}
+	m.GorseConfig.Database.CacheSize = 3
+	m.GorseConfig.Recommend.PopularWindow = 1
+	// insert users
+	for _, user := range []data.User{
+		{UserId: "0", Labels: []string{"a"}},
+		{UserId: "1", Labels: []string{"a", "b"}},
+		{UserId: "2"},
+	} {
+		err := m.DataStore.InsertUser(user)
+		assert.Nil(t, err)
+	}
+	feedbacks := []data.Feedback{
+		{FeedbackKey: data.FeedbackKey{UserId: "0", ItemId: "1"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{UserId: "0", ItemId: "2"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{UserId: "1", ItemId: "2"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{UserId: "1", ItemId: "3"}, Timestamp: time.Now()},
+		{FeedbackKey: data.FeedbackKey{UserId: "2", ItemId: "4"}, Timestamp: time.Now()},
+		// feedback out of the window
+		{FeedbackKey: data.FeedbackKey{UserId: "1", ItemId: "4"}, Timestamp: time.Now().AddDate(0, 0, -2)},
+	}
+	m.userLabelPopular(feedbacks)
+	// check popular items
+	popular, err := m.CacheStore.GetScores(cache.UserLabelPopularItems, "a", 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(popular))
+	assert.Equal(t, cache.ScoredItem{ItemId: "2", Score: 2}, popular[0])
+	assert.ElementsMatch(t, []cache.ScoredItem{{ItemId: "1", Score: 1}, {ItemId: "3", Score: 1}}, popular[1:])
+	popular, err = m.CacheStore.GetScores(cache.UserLabelPopularItems, "b", 0, 100)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []cache.ScoredItem{{ItemId: "2", Score: 1}, {ItemId: "3", Score: 1}}, popular)
+}
+
+func TestMaster_InsertLearningCurve(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	fitStart := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.insertLearningCurve([]pr.EpochScore{
+		{Epoch: 0, NDCG: 0.1, Precision: 0.2, Recall: 0.3},
+		{Epoch: 10, NDCG: 0.4, Precision: 0.5, Recall: 0.6},
+	}, 1, fitStart)
+	measurements, err := m.DataStore.GetMeasurements(LearningCurveMeasurement("NDCG@10", 1), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(measurements))
+	assert.Equal(t, "NDCG@10@curve:1", measurements[0].Name)
+	assert.Equal(t, float32(0.4), measurements[0].Value)
+	assert.Equal(t, "epoch 10", measurements[0].Comment)
+	assert.Equal(t, float32(0.1), measurements[1].Value)
+	assert.Equal(t, "epoch 0", measurements[1].Comment)
+	measurements, err = m.DataStore.GetMeasurements(LearningCurveMeasurement("Recall@10", 1), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(measurements))
+	assert.Equal(t, float32(0.6), measurements[0].Value)
+}
+
+func TestMaster_WarmStartSearcher(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	m.prSearcher = pr.NewModelSearcher(1, 1, pr.Objective{})
+	trials := []pr.Trial{
+		{Model: "bpr", Params: model.Params{model.NFactors: 8, model.Lr: 0.01}, Score: pr.Score{NDCG: 0.1}, FitTime: time.Second},
+		{Model: "ccd", Params: model.Params{model.NFactors: 16, model.Reg: 0.1}, Score: pr.Score{NDCG: 0.2}, FitTime: time.Minute},
+	}
+	m.saveTrials(trials)
+	saved, err := m.DataStore.GetTrials(10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(saved))
+	// numbers are loaded as floats
+	for _, trial := range saved {
+		switch trial.Model {
+		case "bpr":
+			assert.Equal(t, map[string]interface{}{string(model.NFactors): float64(8), string(model.Lr): 0.01}, trial.Params)
+			assert.Equal(t, float32(0.1), trial.NDCG)
+			assert.Equal(t, float32(1), trial.FitTime)
+			assert.Equal(t, trials[0].FitTime, fromDataTrial(trial).FitTime)
+		case "ccd":
+			assert.Equal(t, map[string]interface{}{string(model.NFactors): float64(16), string(model.Reg): 0.1}, trial.Params)
+			assert.Equal(t, float32(0.2), trial.NDCG)
+			assert.Equal(t, float32(60), trial.FitTime)
+		default:
+			t.Fatalf("unexpected model %v", trial.Model)
+		}
+	}
+	m.warmStartSearcher()
+}
+
+func TestMaster_FitPRModel(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Recommend.RandomState = 7
+	dir, err := ioutil.TempDir("", "gorse-master")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	m.localCache = &LocalCache{path: filepath.Join(dir, "cache")}
+	// create dataset
+	dataSet := pr.NewMapIndexDataset()
+	for u := 0; u < 10; u++ {
+		for i := 0; i < 5; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(u), strconv.Itoa(i+u%2*5), time.Unix(int64(i), 0), true)
+		}
+	}
+	m.userIndex = dataSet.UserIndex
+	// fit model
+	m.fitPRModel(dataSet, "bpr", model.Params{model.NEpochs: 5})
+	assert.Equal(t, "bpr", m.prMeta.Name)
+	assert.Equal(t, m.prVersion, m.prMeta.Version)
+	assert.Equal(t, int64(7), m.prMeta.Seed)
+	assert.Equal(t, dataSet.Fingerprint(), m.prMeta.DataSet)
+	assert.Equal(t, pr.Checksum(m.prModel), m.prMeta.Checksum)
+	assert.Equal(t, int64(7), m.prModel.GetParams().GetInt64(model.RandomState, 0))
+	// load metadata from local cache
+	localCache, err := LoadLocalCache(filepath.Join(dir, "cache"))
+	assert.Nil(t, err)
+	assert.Equal(t, m.prMeta.Checksum, localCache.ModelMeta.Checksum)
+	assert.Equal(t, m.prMeta.Config, localCache.ModelMeta.Config)
+	// fit again by metadata
+	prModel, _, err := FitModel(dataSet, &localCache.ModelMeta)
+	assert.Nil(t, err)
+	assert.Equal(t, m.prMeta.Checksum, pr.Checksum(prModel))
+	// load metadata of previous versions from data store
+	prevMeta := m.prMeta
+	m.fitPRModel(dataSet, "als", model.Params{model.NEpochs: 5})
+	meta, err := LoadModelMeta(m.DataStore, base.Hex(prevMeta.Version))
+	assert.Nil(t, err)
+	assert.Equal(t, "bpr", meta.Name)
+	assert.Equal(t, prevMeta.Params, meta.Params)
+	assert.Equal(t, prevMeta.Checksum, meta.Checksum)
+	assert.Equal(t, prevMeta.DataSet, meta.DataSet)
+	// fit again by metadata from data store
+	prModel, _, err = FitModel(dataSet, &meta)
+	assert.Nil(t, err)
+	assert.Equal(t, prevMeta.Checksum, pr.Checksum(prModel))
+	meta, err = LoadModelMeta(m.DataStore, base.Hex(m.prMeta.Version))
+	assert.Nil(t, err)
+	assert.Equal(t, "als", meta.Name)
+	assert.Equal(t, m.prMeta.Checksum, meta.Checksum)
+}
+
+func TestMaster_FitSequentialModel(t *testing.T) {
+	// create mock master
+	m := newMockMaster(t)
+	defer m.Close()
+	m.GorseConfig = (*config.Config)(nil).LoadDefaultIfNil()
+	m.GorseConfig.Recommend.RandomState = 7
+	// create dataset
+	dataSet := pr.NewMapIndexDataset()
+	for u := 0; u < 10; u++ {
+		for i := 0; i < 5; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(u), strconv.Itoa(i+u%2*5), time.Unix(int64(i), 0), true)
+		}
+	}
+	// skip if the sequential source isn't used
+	m.fitSequentialModel(dataSet)
+	assert.Nil(t, m.sequentialModel)
+	// fit sequential model
+	m.GorseConfig.Recommend.Pipeline = []config.StageConfig{{Source: "sequential"}}
+	m.fitSequentialModel(dataSet)
+	assert.IsType(t, &pr.FPMC{}, m.sequentialModel)
+	// pull sequential model
+	response, err := m.GetSequentialModel(context.Background(), &protocol.NodeInfo{NodeType: protocol.NodeType_ServerNode})
+	assert.Nil(t, err)
+	assert.Equal(t, m.sequentialVersion, response.Version)
+	sequentialModel, err := pr.DecodeModel(response.Name, response.Model)
+	assert.Nil(t, err)
+	assert.Equal(t, pr.Checksum(m.sequentialModel), pr.Checksum(sequentialModel))
+}
@@ -1,15 +1,21 @@
 package master
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/chewxy/math32"
 	"github.com/scylladb/go-set"
 	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/cmd/version"
+	"github.com/zhenghaoz/gorse/config"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/server"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
+	"hash/fnv"
+	"math/rand"
 	"sort"
 	"time"
 )
@@ -55,6 +61,359 @@ func (m *Master) popItem(items []data.Item, feedback []data.Feedback) {
 	}
 }
 
+// userLabelPopular updates popular items among users with each label, which are used to
+// recommend items to new users by their labels.
+func (m *Master) userLabelPopular(feedback []data.Feedback) {
+	base.Logger().Info("collect popular items by user labels", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	// load user labels
+	userLabels := make(map[string][]string)
+	const batchSize = 1024
+	cursor := ""
+	for {
+		var users []data.User
+		var err error
+		cursor, users, err = m.DataStore.GetUsers(cursor, batchSize)
+		if err != nil {
+			base.Logger().Error("failed to load users", zap.Error(err))
+			return
+		}
+		for _, user := range users {
+			if len(user.Labels) > 0 {
+				userLabels[user.UserId] = user.Labels
+			}
+		}
+		if cursor == "" {
+			break
+		}
+	}
+	// count feedback
+	timeWindowLimit := time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.PopularWindow)
+	count := make(map[string]map[string]int)
+	for _, fb := range feedback {
+		if !fb.Timestamp.After(timeWindowLimit) {
+			continue
+		}
+		for _, label := range userLabels[fb.UserId] {
+			if _, exist := count[label]; !exist {
+				count[label] = make(map[string]int)
+			}
+			count[label][fb.ItemId]++
+		}
+	}
+	// write back
+	for label, itemCount := range count {
+		popItems := base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+		for itemId, f := range itemCount {
+			popItems.Push(itemId, float32(f))
+		}
+		result, scores := popItems.PopAll()
+		if err := m.CacheStore.SetScores(cache.UserLabelPopularItems, label, cache.CreateScoredItems(result, scores)); err != nil {
+			base.Logger().Error("failed to cache popular items by user labels", zap.Error(err))
+		}
+	}
+}
+
+// trending updates trending items. The trending score of an item is the amount of feedback
+// in the latest trending window minus the amount of feedback in the previous trending window.
+func (m *Master) trending(items []data.Item, feedback []data.Feedback) {
+	base.Logger().Info("collect trending items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	// create item mapping
+	itemMap := make(map[string]data.Item)
+	for _, item := range items {
+		itemMap[item.ItemId] = item
+	}
+	// count feedback
+	currentWindowLimit := time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.TrendingWindow)
+	previousWindowLimit := currentWindowLimit.AddDate(0, 0, -m.GorseConfig.Recommend.TrendingWindow)
+	count := make(map[string]int)
+	for _, fb := range feedback {
+		if fb.Timestamp.After(currentWindowLimit) {
+			count[fb.ItemId]++
+		} else if fb.Timestamp.After(previousWindowLimit) {
+			count[fb.ItemId]--
+		}
+	}
+	// collect trending items
+	trendingItems := make(map[string]*base.TopKStringFilter)
+	trendingItems[""] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+	for itemId, f := range count {
+		if f <= 0 {
+			continue
+		}
+		trendingItems[""].Push(itemId, float32(f))
+		item := itemMap[itemId]
+		for _, label := range item.Labels {
+			if _, exists := trendingItems[label]; !exists {
+				trendingItems[label] = base.NewTopKStringFilter(m.GorseConfig.Database.CacheSize)
+			}
+			trendingItems[label].Push(itemId, float32(f))
+		}
+	}
+	// write back
+	for label, topItems := range trendingItems {
+		result, scores := topItems.PopAll()
+		if err := m.CacheStore.SetScores(cache.TrendingItems, label, cache.CreateScoredItems(result, scores)); err != nil {
+			base.Logger().Error("failed to cache trending items", zap.Error(err))
+		}
+	}
+	if err := m.CacheStore.SetString(cache.GlobalMeta, cache.CollectTrendingTime, base.Now()); err != nil {
+		base.Logger().Error("failed to cache trending items", zap.Error(err))
+	}
+}
+
+// CTRMeasurement is the name of the measurement for click-through rate of a variant in an experiment.
+func CTRMeasurement(experiment, variant string) string {
+	return fmt.Sprintf("CTR@%s:%s", experiment, variant)
+}
+
+// experiment evaluates variants of the experiment. The click-through rate of a variant is the
+// fraction of items shown to its users (read feedback) that received positive feedback.
+func (m *Master) experiment(feedback []data.Feedback) {
+	experiment := m.GorseConfig.Experiment
+	if len(experiment.Variants) == 0 || len(m.GorseConfig.Database.ReadFeedbackType) == 0 {
+		return
+	}
+	base.Logger().Info("evaluate experiment", zap.String("name", experiment.Name))
+	var timeLimit *time.Time
+	if m.GorseConfig.Database.PositiveFeedbackTTL > 0 {
+		temp := time.Now().AddDate(0, 0, -int(m.GorseConfig.Database.PositiveFeedbackTTL))
+		timeLimit = &temp
+	}
+	type userItem struct {
+		userId string
+		itemId string
+	}
+	clicked := make(map[userItem]struct{}, len(feedback))
+	for _, fb := range feedback {
+		clicked[userItem{fb.UserId, fb.ItemId}] = struct{}{}
+	}
+	// load read feedback
+	readFeedback, err := m.loadFeedback(m.GorseConfig.Database.ReadFeedbackType, timeLimit)
+	if err != nil {
+		base.Logger().Error("failed to load read feedback", zap.Error(err))
+		return
+	}
+	shown := make(map[userItem]struct{}, len(readFeedback))
+	for _, fb := range readFeedback {
+		shown[userItem{fb.UserId, fb.ItemId}] = struct{}{}
+	}
+	// count by variants
+	numShown := make(map[string]int)
+	numClicked := make(map[string]int)
+	for key := range shown {
+		variant := experiment.Assign(key.userId)
+		numShown[variant.Name]++
+		if _, exist := clicked[key]; exist {
+			numClicked[variant.Name]++
+		}
+	}
+	// write back
+	timestamp := time.Now()
+	for _, variant := range experiment.Variants {
+		var ctr float32
+		if numShown[variant.Name] > 0 {
+			ctr = float32(numClicked[variant.Name]) / float32(numShown[variant.Name])
+		}
+		if err := m.DataStore.InsertMeasurement(data.Measurement{
+			Name:      CTRMeasurement(experiment.Name, variant.Name),
+			Timestamp: timestamp,
+			Value:     ctr,
+			Comment:   fmt.Sprintf("%d/%d", numClicked[variant.Name], numShown[variant.Name]),
+		}); err != nil {
+			base.Logger().Error("failed to insert measurement", zap.Error(err))
+		}
+		base.Logger().Info("evaluate variant", zap.String("experiment", experiment.Name),
+			zap.String("variant", variant.Name), zap.Float32("ctr", ctr),
+			zap.Int("n_shown", numShown[variant.Name]), zap.Int("n_clicked", numClicked[variant.Name]))
+	}
+}
+
+// Names of online metrics.
+const (
+	OnlineCTR        = "OnlineCTR"
+	OnlineConversion = "OnlineConversion"
+	OnlineCoverage   = "OnlineCoverage"
+)
+
+// OnlineMeasurement is the name of the measurement for an online metric. Metrics over all
+// impressions are named by the metric, otherwise the dimension (source or label) and its
+// value are appended.
+func OnlineMeasurement(metric, dimension, value string) string {
+	if dimension == "" {
+		return metric
+	}
+	return fmt.Sprintf("%s@%s:%s", metric, dimension, value)
+}
+
+// onlineStats accumulates online statistics of impressions.
+type onlineStats struct {
+	numImpressions int
+	numClicks      int
+	numConversions int
+	items          map[string]struct{}
+}
+
+func (stats *onlineStats) add(itemId string, clicked, converted bool) {
+	stats.numImpressions++
+	if clicked {
+		stats.numClicks++
+	}
+	if converted {
+		stats.numConversions++
+	}
+	stats.items[itemId] = struct{}{}
+}
+
+// expireImpressions deletes impressions older than the impression TTL.
+func (m *Master) expireImpressions() {
+	if m.GorseConfig.Server.ImpressionTTL <= 0 {
+		return
+	}
+	timeLimit := time.Now().AddDate(0, 0, -m.GorseConfig.Server.ImpressionTTL)
+	if err := m.DataStore.DeleteImpressions(timeLimit); err != nil {
+		base.Logger().Error("failed to delete expired impressions", zap.Error(err))
+	}
+}
+
+// onlineMetrics evaluates impressions in the metric window. An impression is clicked (converted)
+// if the user gives positive (conversion) feedback to the item after the impression. For all
+// impressions, impressions from each source and impressions of each label:
+// 1. CTR is the fraction of clicked impressions.
+// 2. Conversion is the fraction of converted impressions.
+// 3. Coverage is the fraction of items (with the label) ever shown.
+func (m *Master) onlineMetrics(items []data.Item, feedback []data.Feedback) {
+	base.Logger().Info("evaluate online metrics", zap.Int("metric_window", m.GorseConfig.Recommend.MetricWindow))
+	timeLimit := time.Now().AddDate(0, 0, -m.GorseConfig.Recommend.MetricWindow)
+	type userItem struct {
+		userId string
+		itemId string
+	}
+	// index latest feedback
+	clicked := make(map[userItem]time.Time)
+	for _, fb := range feedback {
+		key := userItem{fb.UserId, fb.ItemId}
+		if fb.Timestamp.After(clicked[key]) {
+			clicked[key] = fb.Timestamp
+		}
+	}
+	converted := make(map[userItem]time.Time)
+	if len(m.GorseConfig.Database.ConversionFeedbackType) > 0 {
+		conversions, err := m.loadFeedback(m.GorseConfig.Database.ConversionFeedbackType, &timeLimit)
+		if err != nil {
+			base.Logger().Error("failed to load conversion feedback", zap.Error(err))
+			return
+		}
+		for _, fb := range conversions {
+			key := userItem{fb.UserId, fb.ItemId}
+			if fb.Timestamp.After(converted[key]) {
+				converted[key] = fb.Timestamp
+			}
+		}
+	}
+	// count items
+	itemLabels := make(map[string][]string, len(items))
+	numLabelItems := make(map[string]int)
+	for _, item := range items {
+		itemLabels[item.ItemId] = item.Labels
+		for _, label := range item.Labels {
+			numLabelItems[label]++
+		}
+	}
+	// count impressions
+	stats := make(map[[2]string]*onlineStats)
+	getStats := func(dimension, value string) *onlineStats {
+		key := [2]string{dimension, value}
+		if _, exist := stats[key]; !exist {
+			stats[key] = &onlineStats{items: make(map[string]struct{})}
+		}
+		return stats[key]
+	}
+	const batchSize = 1024
+	cursor := ""
+	for {
+		var impressions []data.Impression
+		var err error
+		cursor, impressions, err = m.DataStore.GetImpressions(cursor, batchSize, &timeLimit)
+		if err != nil {
+			base.Logger().Error("failed to load impressions", zap.Error(err))
+			return
+		}
+		for _, impression := range impressions {
+			key := userItem{impression.UserId, impression.ItemId}
+			isClicked := !clicked[key].Before(impression.Timestamp)
+			isConverted := !converted[key].Before(impression.Timestamp)
+			getStats("", "").add(impression.ItemId, isClicked, isConverted)
+			getStats("source", impression.Source).add(impression.ItemId, isClicked, isConverted)
+			for _, label := range itemLabels[impression.ItemId] {
+				getStats("label", label).add(impression.ItemId, isClicked, isConverted)
+			}
+		}
+		if cursor == "" {
+			break
+		}
+	}
+	// write back
+	timestamp := time.Now()
+	names := make([]string, 0, len(stats)*3)
+	for key, stat := range stats {
+		numItems := len(items)
+		if key[0] == "label" {
+			numItems = numLabelItems[key[1]]
+		}
+		values := map[string]float32{
+			OnlineCTR:      float32(stat.numClicks) / float32(stat.numImpressions),
+			OnlineCoverage: float32(len(stat.items)) / float32(numItems),
+		}
+		if len(m.GorseConfig.Database.ConversionFeedbackType) > 0 {
+			values[OnlineConversion] = float32(stat.numConversions) / float32(stat.numImpressions)
+		}
+		if numItems == 0 {
+			values[OnlineCoverage] = 0
+		}
+		for metric, value := range values {
+			name := OnlineMeasurement(metric, key[0], key[1])
+			if err := m.DataStore.InsertMeasurement(data.Measurement{
+				Name:      name,
+				Timestamp: timestamp,
+				Value:     value,
+				Comment:   fmt.Sprintf("%d impressions", stat.numImpressions),
+			}); err != nil {
+				base.Logger().Error("failed to insert measurement", zap.Error(err))
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if err := m.CacheStore.ClearList(cache.OnlineMetrics, ""); err != nil {
+		base.Logger().Error("failed to cache online metrics", zap.Error(err))
+	}
+	if err := m.CacheStore.AppendList(cache.OnlineMetrics, "", names...); err != nil {
+		base.Logger().Error("failed to cache online metrics", zap.Error(err))
+	}
+}
+
+// loadFeedback loads feedback of given types after the time limit.
+func (m *Master) loadFeedback(feedbackTypes []string, timeLimit *time.Time) ([]data.Feedback, error) {
+	const batchSize = 1024
+	feedback := make([]data.Feedback, 0)
+	for _, feedbackType := range feedbackTypes {
+		cursor := ""
+		for {
+			var batch []data.Feedback
+			var err error
+			cursor, batch, err = m.DataStore.GetFeedback(cursor, batchSize, &feedbackType, timeLimit)
+			if err != nil {
+				return nil, err
+			}
+			feedback = append(feedback, batch...)
+			if cursor == "" {
+				break
+			}
+		}
+	}
+	return feedback, nil
+}
+
 // latest updates latest items.
 func (m *Master) latest(items []data.Item) {
 	base.Logger().Info("collect latest items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
@@ -82,9 +441,55 @@ func (m *Master) latest(items []data.Item) {
 	}
 }
 
-// similar updates neighbors for the database.
+// similar updates neighbors of items. Since similarities between items only change if users
+// give feedback to them, only items touched by users whose feedback changed since the last
+// collection, items whose feedback changed and items co-occurring with them (their norms
+// change) are updated. Changes are detected by checksums of feedback. All items are updated
+// in a full rebuild, which runs periodically to catch up changes missed by checksums.
 func (m *Master) similar(items []data.Item, dataset *pr.DataSet, similarity string) {
-	base.Logger().Info("collect similar items", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	// 1. find dirty items
+	userChecksums := make(map[string]uint64, dataset.UserCount())
+	for userIndex, feedbacks := range dataset.UserFeedback {
+		userChecksums[dataset.UserIndex.ToName(userIndex)] = checksumNames(dataset.ItemIndex, feedbacks)
+	}
+	itemChecksums := make(map[string]uint64, dataset.ItemCount())
+	for itemIndex, feedbacks := range dataset.ItemFeedback {
+		itemChecksums[dataset.ItemIndex.ToName(itemIndex)] = checksumNames(dataset.UserIndex, feedbacks)
+	}
+	fullRebuild := m.similarUserChecksums == nil ||
+		time.Since(m.lastFullSimilarTime) >= time.Duration(m.GorseConfig.Recommend.FullSimilarPeriod)*time.Minute
+	var dirtyItems []int
+	if fullRebuild {
+		dirtyItems = make([]int, dataset.ItemCount())
+		for i := range dirtyItems {
+			dirtyItems[i] = i
+		}
+	} else {
+		dirtySet := set.NewIntSet()
+		for userIndex, feedbacks := range dataset.UserFeedback {
+			name := dataset.UserIndex.ToName(userIndex)
+			if checksum, exist := m.similarUserChecksums[name]; !exist || checksum != userChecksums[name] {
+				dirtySet.Add(feedbacks...)
+			}
+		}
+		for itemIndex, feedbacks := range dataset.ItemFeedback {
+			name := dataset.ItemIndex.ToName(itemIndex)
+			if checksum, exist := m.similarItemChecksums[name]; !exist || checksum != itemChecksums[name] {
+				// co-occurring items
+				for _, userIndex := range feedbacks {
+					dirtySet.Add(dataset.UserFeedback[userIndex]...)
+				}
+				dirtySet.Add(itemIndex)
+			}
+		}
+		dirtyItems = dirtySet.List()
+		sort.Ints(dirtyItems)
+	}
+	base.Logger().Info("collect similar items",
+		zap.Int("n_cache", m.GorseConfig.Database.CacheSize),
+		zap.Bool("full_rebuild", fullRebuild),
+		zap.Int("n_dirty_items", len(dirtyItems)),
+		zap.Int("n_items", dataset.ItemCount()))
 	// create progress tracker
 	completed := make(chan []interface{}, 1000)
 	go func() {
@@ -100,7 +505,7 @@ func (m *Master) similar(items []data.Item, dataset *pr.DataSet, similarity stri
 			case <-ticker.C:
 				base.Logger().Debug("collect similar items",
 					zap.Int("n_complete_items", completedCount),
-					zap.Int("n_items", dataset.ItemCount()))
+					zap.Int("n_dirty_items", len(dirtyItems)))
 			}
 		}
 	}()
@@ -110,8 +515,10 @@ func (m *Master) similar(items []data.Item, dataset *pr.DataSet, similarity stri
 		sort.Ints(feedbacks)
 	}
 
-	if err := base.Parallel(dataset.ItemCount(), m.GorseConfig.Master.FitJobs, func(workerId, jobId int) error {
-		users := dataset.ItemFeedback[jobId]
+	// 2. update neighbors of dirty items
+	if err := base.Parallel(len(dirtyItems), m.GorseConfig.Master.FitJobs, func(workerId, jobId int) error {
+		itemIndex := dirtyItems[jobId]
+		users := dataset.ItemFeedback[itemIndex]
 		// Collect candidates
 		itemSet := set.NewIntSet()
 		for _, u := range users {
@@ -119,12 +526,12 @@ func (m *Master) similar(items []data.Item, dataset *pr.DataSet, similarity stri
 		}
 		// Ranking
 		nearItems := base.NewTopKFilter(m.GorseConfig.Database.CacheSize)
-		for j := range itemSet.List() {
-			if j != jobId {
+		for _, j := range itemSet.List() {
+			if j != itemIndex {
 				var score float32
-				score = dotInt(dataset.ItemFeedback[jobId], dataset.ItemFeedback[j])
+				score = dotInt(dataset.ItemFeedback[itemIndex], dataset.ItemFeedback[j])
 				if similarity == model.SimilarityCosine {
-					score /= math32.Sqrt(float32(len(dataset.ItemFeedback[jobId])))
+					score /= math32.Sqrt(float32(len(dataset.ItemFeedback[itemIndex])))
 					score /= math32.Sqrt(float32(len(dataset.ItemFeedback[j])))
 				}
 				nearItems.Push(j, score)
@@ -135,20 +542,109 @@ func (m *Master) similar(items []data.Item, dataset *pr.DataSet, similarity stri
 		for i := range recommends {
 			recommends[i] = dataset.ItemIndex.ToName(elem[i])
 		}
-		if err := m.CacheStore.SetScores(cache.SimilarItems, dataset.ItemIndex.ToName(jobId), cache.CreateScoredItems(recommends, scores)); err != nil {
+		if err := m.CacheStore.SetScores(cache.SimilarItems, dataset.ItemIndex.ToName(itemIndex), cache.CreateScoredItems(recommends, scores)); err != nil {
 			return err
 		}
 		completed <- nil
 		return nil
 	}); err != nil {
 		base.Logger().Error("failed to cache similar items", zap.Error(err))
+		close(completed)
+		return
 	}
 	close(completed)
+	// 3. save feedback checksums
+	m.similarUserChecksums, m.similarItemChecksums = userChecksums, itemChecksums
+	if fullRebuild {
+		m.lastFullSimilarTime = time.Now()
+	}
 	if err := m.CacheStore.SetString(cache.GlobalMeta, cache.CollectSimilarTime, base.Now()); err != nil {
 		base.Logger().Error("failed to cache similar items", zap.Error(err))
 	}
 }
 
+// checksumNames computes the FNV-1a checksum of names of indices regardless of their order.
+func checksumNames(index base.Index, indices []int) uint64 {
+	names := make([]string, len(indices))
+	for i, idx := range indices {
+		names[i] = index.ToName(idx)
+	}
+	sort.Strings(names)
+	h := fnv.New64a()
+	for _, name := range names {
+		_, _ = h.Write([]byte(name))
+		_, _ = h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// similarUsers updates neighbors of users. Users are similar if they have given feedback to
+// common items.
+func (m *Master) similarUsers(dataset *pr.DataSet, similarity string) {
+	base.Logger().Info("collect similar users", zap.Int("n_cache", m.GorseConfig.Database.CacheSize))
+	// create progress tracker
+	completed := make(chan []interface{}, 1000)
+	go func() {
+		completedCount := 0
+		ticker := time.NewTicker(time.Second)
+		for {
+			select {
+			case _, ok := <-completed:
+				if !ok {
+					return
+				}
+				completedCount++
+			case <-ticker.C:
+				base.Logger().Debug("collect similar users",
+					zap.Int("n_complete_users", completedCount),
+					zap.Int("n_users", dataset.UserCount()))
+			}
+		}
+	}()
+
+	// pre-ranking
+	for _, feedbacks := range dataset.UserFeedback {
+		sort.Ints(feedbacks)
+	}
+
+	if err := base.Parallel(dataset.UserCount(), m.GorseConfig.Master.FitJobs, func(workerId, jobId int) error {
+		items := dataset.UserFeedback[jobId]
+		// Collect candidates
+		userSet := set.NewIntSet()
+		for _, i := range items {
+			userSet.Add(dataset.ItemFeedback[i]...)
+		}
+		// Ranking
+		nearUsers := base.NewTopKFilter(m.GorseConfig.Database.CacheSize)
+		for _, v := range userSet.List() {
+			if v != jobId {
+				score := dotInt(dataset.UserFeedback[jobId], dataset.UserFeedback[v])
+				if similarity == model.SimilarityCosine {
+					score /= math32.Sqrt(float32(len(dataset.UserFeedback[jobId])))
+					score /= math32.Sqrt(float32(len(dataset.UserFeedback[v])))
+				}
+				nearUsers.Push(v, score)
+			}
+		}
+		elem, scores := nearUsers.PopAll()
+		neighbors := make([]string, len(elem))
+		for i := range neighbors {
+			neighbors[i] = dataset.UserIndex.ToName(elem[i])
+		}
+		if err := m.CacheStore.SetScores(cache.SimilarUsers, dataset.UserIndex.ToName(jobId), cache.CreateScoredItems(neighbors, scores)); err != nil {
+			return err
+		}
+		completed <- nil
+		return nil
+	}); err != nil {
+		base.Logger().Error("failed to cache similar users", zap.Error(err))
+	}
+	close(completed)
+	if err := m.CacheStore.SetString(cache.GlobalMeta, cache.CollectSimilarUsersTime, base.Now()); err != nil {
+		base.Logger().Error("failed to cache similar users", zap.Error(err))
+	}
+}
+
 func dotString(a, b []string) float32 {
 	i, j, sum := 0, 0, float32(0)
 	for i < len(a) && j < len(b) {
@@ -181,19 +677,176 @@ func dotInt(a, b []int) float32 {
 	return sum
 }
 
-func (m *Master) fitPRModel(dataSet *pr.DataSet, prModel pr.Model) {
-	base.Logger().Info("fit personal ranking model", zap.Int("n_jobs", m.GorseConfig.Master.FitJobs))
+// Methods to split dataset into training and test sets.
+const (
+	RandomSplit       = "random"
+	TimeSplit         = "time"
+	LeaveLastOutSplit = "leave_last_out"
+)
+
+// split dataset into training and test sets by the split method in config.
+func split(dataSet *pr.DataSet, cfg *config.RecommendConfig, seed int64) (*pr.DataSet, *pr.DataSet) {
+	switch cfg.SplitMethod {
+	case TimeSplit:
+		return dataSet.SplitByTime(dataSet.TimeQuantile(1 - cfg.TestRatio))
+	case LeaveLastOutSplit:
+		return dataSet.SplitLatest(0, seed)
+	case RandomSplit, "":
+	default:
+		base.Logger().Warn("unknown split method, use random split instead",
+			zap.String("split_method", cfg.SplitMethod))
+	}
+	return dataSet.Split(0, seed)
+}
+
+// randomState returns the seed in config, or a random seed if it's 0.
+func (m *Master) randomState() int64 {
+	if m.GorseConfig.Recommend.RandomState != 0 {
+		return m.GorseConfig.Recommend.RandomState
+	}
+	return rand.Int63()
+}
+
+// FitModel fits a new personal ranking model from scratch by its metadata. The dataset is split by
+// the seed and the split method in the recorded config. Models are fitted by a single job, so that
+// SGD based models are reproducible as well.
+func FitModel(dataSet *pr.DataSet, meta *ModelMeta) (pr.Model, pr.Score, error) {
+	var cfg config.Config
+	if err := json.Unmarshal([]byte(meta.Config), &cfg); err != nil {
+		return nil, pr.Score{}, err
+	}
+	prModel, err := pr.NewModel(meta.Name, meta.Params.Overwrite(model.Params{model.RandomState: meta.Seed}))
+	if err != nil {
+		return nil, pr.Score{}, err
+	}
+	trainSet, testSet := split(dataSet, &cfg.Recommend, meta.Seed)
+	fitConfig := (*pr.FitConfig)(nil).LoadDefaultIfNil()
+	fitConfig.Jobs = 1
+	fitConfig.Patience = cfg.Recommend.Patience
+	fitConfig.MinDelta = cfg.Recommend.MinDelta
+	score := prModel.Fit(trainSet, testSet, fitConfig)
+	return prModel, score, nil
+}
+
+// LearningCurveMeasurement is the name of the measurement for a metric at epochs during fitting
+// a version of the personal ranking model.
+func LearningCurveMeasurement(metric string, version int64) string {
+	return fmt.Sprintf("%s@curve:%x", metric, version)
+}
+
+// insertLearningCurve inserts scores at epochs as measurements. Timestamps of measurements are
+// the start time of fitting plus epochs in seconds, so that points are ordered by epochs.
+func (m *Master) insertLearningCurve(curve []pr.EpochScore, version int64, fitStart time.Time) {
+	fitStart = fitStart.Truncate(time.Second)
+	for _, point := range curve {
+		timestamp := fitStart.Add(time.Duration(point.Epoch) * time.Second)
+		comment := fmt.Sprintf("epoch %d", point.Epoch)
+		for metric, value := range map[string]float32{
+			"NDCG@10":      point.NDCG,
+			"Precision@10": point.Precision,
+			"Recall@10":    point.Recall,
+		} {
+			if err := m.DataStore.InsertMeasurement(data.Measurement{
+				Name:      LearningCurveMeasurement(metric, version),
+				Timestamp: timestamp,
+				Value:     value,
+				Comment:   comment,
+			}); err != nil {
+				base.Logger().Error("failed to insert measurement", zap.Error(err))
+			}
+		}
+	}
+}
+
+// sequentialModelName is the name of the model used by the sequential recommendation source.
+const sequentialModelName = "fpmc"
+
+// fitSequentialModel fits the model used by the sequential recommendation source, which is trained
+// separately from the searched personal ranking model. The latest feedback of each user is held
+// out for validation. Nothing is fitted unless the sequential source is in the pipeline.
+func (m *Master) fitSequentialModel(dataSet *pr.DataSet) {
+	hasSequentialSource := false
+	for _, stage := range m.GorseConfig.Recommend.Pipeline {
+		if stage.Source == server.SequentialSource {
+			hasSequentialSource = true
+		}
+	}
+	if !hasSequentialSource {
+		return
+	}
+	seed := m.randomState()
+	base.Logger().Info("fit sequential model",
+		zap.String("model_name", sequentialModelName),
+		zap.Int64("seed", seed))
+	sequentialModel, err := pr.NewModel(sequentialModelName, model.Params{model.RandomState: seed})
+	if err != nil {
+		base.Logger().Error("failed to create sequential model", zap.Error(err))
+		return
+	}
+	trainSet, testSet := dataSet.SplitLatest(0, seed)
+	fitConfig := (*pr.FitConfig)(nil).LoadDefaultIfNil()
+	fitConfig.Jobs = m.GorseConfig.Master.FitJobs
+	fitConfig.Patience = m.GorseConfig.Recommend.Patience
+	fitConfig.MinDelta = m.GorseConfig.Recommend.MinDelta
+	score := sequentialModel.Fit(trainSet, testSet, fitConfig)
+	m.sequentialMutex.Lock()
+	m.sequentialModel = sequentialModel
+	m.sequentialVersion++
+	version := m.sequentialVersion
+	m.sequentialMutex.Unlock()
+	// serve the model by the embedded RESTful server
+	m.SetSequentialModel(sequentialModel)
+	base.Logger().Info("fit sequential model complete",
+		zap.String("version", base.Hex(version)),
+		zap.Float32("NDCG", score.NDCG))
+}
+
+// fitPRModel fits a new personal ranking model with the name and hyper-parameters. The seed, the
+// fingerprint of the dataset and the config are recorded in metadata of the model.
+func (m *Master) fitPRModel(dataSet *pr.DataSet, name string, params model.Params) {
+	configJSON, err := json.Marshal(m.GorseConfig)
+	if err != nil {
+		base.Logger().Error("failed to marshal config", zap.Error(err))
+		return
+	}
+	meta := ModelMeta{
+		Name:         name,
+		Params:       params,
+		Seed:         m.randomState(),
+		DataSet:      dataSet.Fingerprint(),
+		Config:       string(configJSON),
+		GorseVersion: version.Name,
+		FitTime:      time.Now(),
+	}
+	base.Logger().Info("fit personal ranking model",
+		zap.String("model_name", name),
+		zap.Int64("seed", meta.Seed),
+		zap.String("split_method", m.GorseConfig.Recommend.SplitMethod))
 	// training model
-	trainSet, testSet := dataSet.Split(0, 0)
-	score := prModel.Fit(trainSet, testSet, nil)
+	fitStart := time.Now()
+	prModel, score, err := FitModel(dataSet, &meta)
+	if err != nil {
+		base.Logger().Error("failed to fit personal ranking model", zap.Error(err))
+		return
+	}
+	meta.Params = prModel.GetParams()
+	meta.Checksum = pr.Checksum(prModel)
 	// update match model
 	m.prMutex.Lock()
 	m.prModel = prModel
+	m.prModelName = name
 	m.prVersion++
 	m.prScore = score
+	meta.Version = m.prVersion
+	m.prMeta = meta
 	m.prMutex.Unlock()
+	// serve the model by the embedded RESTful server
+	m.SetPRModel(prModel)
 	base.Logger().Info("fit personal ranking model complete",
 		zap.String("version", fmt.Sprintf("%x", m.prVersion)))
+	if err := SaveModelMeta(m.DataStore, meta); err != nil {
+		base.Logger().Error("failed to insert model metadata", zap.Error(err))
+	}
 	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "NDCG@10", Value: score.NDCG, Timestamp: time.Now()}); err != nil {
 		base.Logger().Error("failed to insert measurement", zap.Error(err))
 	}
@@ -203,6 +856,19 @@ func (m *Master) fitPRModel(dataSet *pr.DataSet, prModel pr.Model) {
 	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "Precision@10", Value: score.Precision, Timestamp: time.Now()}); err != nil {
 		base.Logger().Error("failed to insert measurement", zap.Error(err))
 	}
+	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "Coverage@10", Value: score.Coverage, Timestamp: time.Now()}); err != nil {
+		base.Logger().Error("failed to insert measurement", zap.Error(err))
+	}
+	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "Diversity@10", Value: score.Diversity, Timestamp: time.Now()}); err != nil {
+		base.Logger().Error("failed to insert measurement", zap.Error(err))
+	}
+	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "Novelty@10", Value: score.Novelty, Timestamp: time.Now()}); err != nil {
+		base.Logger().Error("failed to insert measurement", zap.Error(err))
+	}
+	if err := m.DataStore.InsertMeasurement(data.Measurement{Name: "Gini@10", Value: score.Gini, Timestamp: time.Now()}); err != nil {
+		base.Logger().Error("failed to insert measurement", zap.Error(err))
+	}
+	m.insertLearningCurve(score.Curve, m.prVersion, fitStart)
 	if err := m.CacheStore.SetString(cache.GlobalMeta, cache.FitMatrixFactorizationTime, base.Now()); err != nil {
 		base.Logger().Error("failed to write meta", zap.Error(err))
 	}
@@ -215,6 +881,7 @@ func (m *Master) fitPRModel(dataSet *pr.DataSet, prModel pr.Model) {
 	m.localCache.Model = prModel
 	m.localCache.ModelScore = score
 	m.localCache.UserIndex = m.userIndex
+	m.localCache.ModelMeta = meta
 	if err := m.localCache.WriteLocalCache(); err != nil {
 		base.Logger().Error("failed to write local cache", zap.Error(err))
 	} else {
@@ -222,6 +889,7 @@ func (m *Master) fitPRModel(dataSet *pr.DataSet, prModel pr.Model) {
 			zap.String("model_name", m.localCache.ModelName),
 			zap.String("model_version", base.Hex(m.localCache.ModelVersion)),
 			zap.Float32("model_score", m.localCache.ModelScore.NDCG),
+			zap.String("checksum", m.localCache.ModelMeta.Checksum),
 			zap.Any("params", m.localCache.Model.GetParams()))
 	}
 }
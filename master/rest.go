@@ -24,6 +24,7 @@ import (
 	"github.com/rakyll/statik/fs"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/pr"
 	"github.com/zhenghaoz/gorse/server"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
@@ -31,6 +32,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -89,6 +91,20 @@ func (m *Master) CreateWebService() {
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]data.Item{}))
+	ws.Route(ws.GET("/dashboard/online").To(m.getOnlineMetrics).
+		Doc("Get latest online metrics.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
+		Writes([]data.Measurement{}))
+	ws.Route(ws.GET("/dashboard/leaderboard").To(m.getLeaderboard).
+		Doc("Get best trials of model search.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
+		Param(ws.QueryParameter("n", "number of returned trials").DataType("int")).
+		Param(ws.QueryParameter("model", "name of the model").DataType("string")).
+		Writes([]Trial{}))
+	ws.Route(ws.GET("/dashboard/model").To(m.getModelMeta).
+		Doc("Get metadata of the personal ranking model.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
+		Writes(ModelMeta{}))
 	ws.Route(ws.GET("/dashboard/recommend/{user-id}").To(m.getRecommend).
 		Doc("Get recommendation for user.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"dashboard"}).
@@ -127,6 +143,8 @@ func (m *Master) StartHttpServer() {
 	http.Handle("/", http.FileServer(&SinglePageAppFileSystem{statikFS}))
 	http.HandleFunc("/api/bulk/items", m.importExportItems)
 	http.HandleFunc("/api/bulk/feedback", m.importExportFeedback)
+	http.HandleFunc("/api/bulk/user_factors", m.exportUserFactors)
+	http.HandleFunc("/api/bulk/item_factors", m.exportItemFactors)
 	m.RestServer.StartHttpServer()
 }
 
@@ -136,14 +154,31 @@ func (m *Master) getCluster(request *restful.Request, response *restful.Response
 	servers := make([]*Node, 0)
 	m.nodesInfoMutex.Lock()
 	for _, info := range m.nodesInfo {
+		node := *info
 		switch info.Type {
 		case WorkerNode:
-			workers = append(workers, info)
+			workers = append(workers, &node)
 		case ServerNode:
-			servers = append(servers, info)
+			servers = append(servers, &node)
 		}
 	}
 	m.nodesInfoMutex.Unlock()
+	// assign users to workers
+	ring := base.NewConsistentHash()
+	for _, worker := range workers {
+		ring.Add(worker.Name)
+	}
+	workingUsers := make(map[string]int)
+	m.userIndexMutex.Lock()
+	if m.userIndex != nil {
+		for _, userId := range m.userIndex.GetNames() {
+			workingUsers[ring.Get(userId)]++
+		}
+	}
+	m.userIndexMutex.Unlock()
+	for _, worker := range workers {
+		worker.WorkingUsers = workingUsers[worker.Name]
+	}
 	// return nodes
 	nodes := make([]*Node, 0)
 	nodes = append(nodes, workers...)
@@ -151,6 +186,69 @@ func (m *Master) getCluster(request *restful.Request, response *restful.Response
 	server.Ok(response, nodes)
 }
 
+func (m *Master) getOnlineMetrics(request *restful.Request, response *restful.Response) {
+	names, err := m.CacheStore.GetList(cache.OnlineMetrics, "")
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	metrics := make([]data.Measurement, 0, len(names))
+	for _, name := range names {
+		measurements, err := m.DataStore.GetMeasurements(name, 1)
+		if err != nil {
+			server.InternalServerError(response, err)
+			return
+		}
+		metrics = append(metrics, measurements...)
+	}
+	server.Ok(response, metrics)
+}
+
+// Trial is a trial of model search with its objective.
+type Trial struct {
+	data.Trial
+	Objective float32
+}
+
+func (m *Master) getLeaderboard(request *restful.Request, response *restful.Response) {
+	n, err := server.ParseInt(request, "n", m.GorseConfig.Server.DefaultN)
+	if err != nil {
+		server.BadRequest(response, err)
+		return
+	}
+	modelName := request.QueryParameter("model")
+	trials, err := m.DataStore.GetTrials(numRecentTrials)
+	if err != nil {
+		server.InternalServerError(response, err)
+		return
+	}
+	// rank trials by the objective
+	objective := pr.Objective(m.GorseConfig.Recommend.Objective)
+	leaderboard := make([]Trial, 0, len(trials))
+	for _, trial := range trials {
+		if modelName == "" || trial.Model == modelName {
+			leaderboard = append(leaderboard, Trial{
+				Trial:     trial,
+				Objective: objective.Of(fromDataTrial(trial).Score),
+			})
+		}
+	}
+	sort.SliceStable(leaderboard, func(i, j int) bool {
+		return leaderboard[i].Objective > leaderboard[j].Objective
+	})
+	if len(leaderboard) > n {
+		leaderboard = leaderboard[:n]
+	}
+	server.Ok(response, leaderboard)
+}
+
+func (m *Master) getModelMeta(request *restful.Request, response *restful.Response) {
+	m.prMutex.Lock()
+	meta := m.prMeta
+	m.prMutex.Unlock()
+	server.Ok(response, meta)
+}
+
 func (m *Master) getConfig(request *restful.Request, response *restful.Response) {
 	server.Ok(response, m.GorseConfig)
 }
@@ -261,7 +359,7 @@ func (m *Master) getRecommend(request *restful.Request, response *restful.Respon
 		server.BadRequest(response, err)
 		return
 	}
-	results, err := m.Recommend(userId, n)
+	results, err := m.Recommend(userId, n, nil)
 	if err != nil {
 		server.InternalServerError(response, err)
 		return
@@ -353,6 +451,50 @@ func (m *Master) getNeighbors(request *restful.Request, response *restful.Respon
 	m.getList(cache.SimilarItems, itemId, request, response)
 }
 
+func (m *Master) exportUserFactors(response http.ResponseWriter, request *http.Request) {
+	m.exportFactors(response, request, "user_factors", pr.ExportUserFactors)
+}
+
+func (m *Master) exportItemFactors(response http.ResponseWriter, request *http.Request) {
+	m.exportFactors(response, request, "item_factors", pr.ExportItemFactors)
+}
+
+// exportFactors exports latent factors of the personal ranking model in the format of csv (default),
+// jsonl or npy.
+func (m *Master) exportFactors(response http.ResponseWriter, request *http.Request, fileName string,
+	export func(io.Writer, pr.Embedding, string) error) {
+	if request.Method != http.MethodGet {
+		response.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	exportFormat := formValue(request, "format", pr.CSVFormat)
+	var contentType string
+	switch exportFormat {
+	case pr.CSVFormat:
+		contentType = "text/csv"
+	case pr.JSONLFormat:
+		contentType = "application/x-ndjson"
+	case pr.NPYFormat:
+		contentType = "application/octet-stream"
+	default:
+		server.BadRequest(restful.NewResponse(response), fmt.Errorf("unknown format %v", exportFormat))
+		return
+	}
+	m.prMutex.Lock()
+	prModel := m.prModel
+	m.prMutex.Unlock()
+	embedding, ok := prModel.(pr.Embedding)
+	if !ok || embedding.GetUserIndex() == nil {
+		server.PageNotFound(restful.NewResponse(response), fmt.Errorf("latent factors not found"))
+		return
+	}
+	response.Header().Set("Content-Type", contentType)
+	response.Header().Set("Content-Disposition", fmt.Sprintf("attachment;filename=%s.%s", fileName, exportFormat))
+	if err := export(response, embedding, exportFormat); err != nil {
+		server.InternalServerError(restful.NewResponse(response), err)
+	}
+}
+
 func (m *Master) importExportItems(response http.ResponseWriter, request *http.Request) {
 	switch request.Method {
 	case http.MethodGet:
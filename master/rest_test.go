@@ -21,13 +21,20 @@ import (
 	"github.com/emicklei/go-restful/v3"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/pr"
 	"github.com/zhenghaoz/gorse/server"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -129,6 +136,46 @@ func TestMaster_ExportFeedback(t *testing.T) {
 		"share,1,4,0001-01-01 00:00:00 +0000 UTC\r\n", w.Body.String())
 }
 
+func TestMaster_ExportFactors(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// no latent factors
+	s.master.prModel = pr.NewKNN(nil)
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	w := httptest.NewRecorder()
+	s.master.exportUserFactors(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	// export user factors
+	bpr := pr.NewBPR(nil)
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.UserIndex.Add("1")
+	bpr.ItemIndex = base.NewMapIndex()
+	bpr.ItemIndex.Add("2")
+	bpr.UserFactor = [][]float32{{1, 2}}
+	bpr.ItemFactor = [][]float32{{3, 4}}
+	s.master.prModel = bpr
+	req = httptest.NewRequest("GET", "https://example.com/", nil)
+	w = httptest.NewRecorder()
+	s.master.exportUserFactors(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=user_factors.csv", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "user_id,factor_0,factor_1\r\n1,1,2\r\n", w.Body.String())
+	// export item factors
+	req = httptest.NewRequest("GET", "https://example.com/?format=jsonl", nil)
+	w = httptest.NewRecorder()
+	s.master.exportItemFactors(w, req)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment;filename=item_factors.jsonl", w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "{\"Id\":\"2\",\"Factor\":[3,4]}\n", w.Body.String())
+	// unknown format
+	req = httptest.NewRequest("GET", "https://example.com/?format=xml", nil)
+	w = httptest.NewRecorder()
+	s.master.exportItemFactors(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
 func TestMaster_ImportItems(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
@@ -267,18 +314,27 @@ func TestMaster_GetCluster(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
 	// add nodes
-	serverNode := &Node{"alan turnin", ServerNode, "192.168.1.100", 1080}
-	workerNode := &Node{"dennis ritchie", WorkerNode, "192.168.1.101", 1081}
+	serverNode := &Node{Name: "alan turnin", Type: ServerNode, IP: "192.168.1.100", HttpPort: 1080}
+	workerNode := &Node{Name: "dennis ritchie", Type: WorkerNode, IP: "192.168.1.101", HttpPort: 1081}
 	s.master.nodesInfo = make(map[string]*Node)
 	s.master.nodesInfo["alan turning"] = serverNode
 	s.master.nodesInfo["dennis ritchie"] = workerNode
+	// add users
+	userIndex := base.NewMapIndex()
+	userIndex.Add("0")
+	userIndex.Add("1")
+	userIndex.Add("2")
+	s.master.userIndex = userIndex
 	// get nodes
 	apitest.New().
 		Handler(s.handler).
 		Get("/api/dashboard/cluster").
 		Expect(t).
 		Status(http.StatusOK).
-		Body(marshal(t, []*Node{workerNode, serverNode})).
+		Body(marshal(t, []*Node{
+			{Name: "dennis ritchie", Type: WorkerNode, IP: "192.168.1.101", HttpPort: 1081, WorkingUsers: 3},
+			serverNode,
+		})).
 		End()
 }
 
@@ -454,3 +510,122 @@ func TestServer_GetRecommends(t *testing.T) {
 		})).
 		End()
 }
+
+func TestMaster_GetOnlineMetrics(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert online metrics
+	measurements := []data.Measurement{
+		{Name: OnlineCTR, Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), Value: 0.1},
+		{Name: OnlineCTR, Timestamp: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Value: 0.2},
+		{Name: OnlineCoverage, Timestamp: time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), Value: 0.3},
+	}
+	for _, measurement := range measurements {
+		err := s.dataStoreClient.InsertMeasurement(measurement)
+		assert.Nil(t, err)
+	}
+	err := s.cacheStoreClient.AppendList(cache.OnlineMetrics, "", OnlineCTR, OnlineCoverage)
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/online").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []data.Measurement{measurements[1], measurements[2]})).
+		End()
+}
+
+func TestMaster_GetLeaderboard(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert trials
+	trials := []data.Trial{
+		{TrialId: "0", Model: "bpr", Params: map[string]interface{}{"lr": 0.01}, NDCG: 0.1,
+			Timestamp: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{TrialId: "1", Model: "als", Params: map[string]interface{}{"reg": 0.1}, NDCG: 0.3,
+			Timestamp: time.Date(2000, 1, 1, 0, 0, 1, 0, time.UTC)},
+		{TrialId: "2", Model: "bpr", Params: map[string]interface{}{"lr": 0.1}, NDCG: 0.2,
+			Timestamp: time.Date(2000, 1, 1, 0, 0, 2, 0, time.UTC)},
+	}
+	for _, trial := range trials {
+		err := s.dataStoreClient.InsertTrial(trial)
+		assert.Nil(t, err)
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/leaderboard").
+		QueryParams(map[string]string{"n": "2"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Trial{
+			{Trial: trials[1], Objective: 0.3},
+			{Trial: trials[2], Objective: 0.2},
+		})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/leaderboard").
+		QueryParams(map[string]string{"model": "bpr"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Trial{
+			{Trial: trials[2], Objective: 0.2},
+			{Trial: trials[0], Objective: 0.1},
+		})).
+		End()
+}
+
+func TestMaster_GetModelMeta(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.master.prMeta = ModelMeta{
+		Name:     "bpr",
+		Version:  1,
+		Seed:     7,
+		DataSet:  pr.Fingerprint{NumUsers: 1, NumItems: 2, NumFeedback: 3, Checksum: "abc"},
+		Checksum: "def",
+		FitTime:  time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/dashboard/model").
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, s.master.prMeta)).
+		End()
+}
+
+func TestMaster_Score(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// register APIs of the embedded server
+	s.master.RestServer.CreateWebService()
+	dir, err := ioutil.TempDir("", "gorse-master")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s.master.localCache = &LocalCache{path: filepath.Join(dir, "cache")}
+	// model not available
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/0").
+		JSON([]string{"0", "1"}).
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		End()
+	// fitted models are served by the master
+	dataSet := pr.NewMapIndexDataset()
+	for u := 0; u < 10; u++ {
+		for i := 0; i < 5; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(u), strconv.Itoa(i+u%2*5), time.Unix(int64(i), 0), true)
+		}
+	}
+	s.master.userIndex = dataSet.UserIndex
+	s.master.fitPRModel(dataSet, "bpr", model.Params{model.NEpochs: 5})
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/0").
+		JSON([]string{"0", "1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
@@ -15,10 +15,11 @@ import (
 )
 
 type Node struct {
-	Name     string
-	Type     string
-	IP       string
-	HttpPort int64
+	Name         string
+	Type         string
+	IP           string
+	HttpPort     int64
+	WorkingUsers int // number of users assigned to a worker
 }
 
 func NewNode(ctx context.Context, nodeInfo *protocol.NodeInfo) *Node {
@@ -67,6 +68,13 @@ func (m *Master) GetMeta(ctx context.Context, nodeInfo *protocol.NodeInfo) (*pro
 		prVersion = m.prVersion
 	}
 	m.prMutex.Unlock()
+	// save sequential version
+	m.sequentialMutex.Lock()
+	var sequentialVersion int64
+	if m.sequentialModel != nil {
+		sequentialVersion = m.sequentialVersion
+	}
+	m.sequentialMutex.Unlock()
 	// save fm version
 	//m.fmMutex.Lock()
 	//var fmVersion int64
@@ -91,10 +99,11 @@ func (m *Master) GetMeta(ctx context.Context, nodeInfo *protocol.NodeInfo) (*pro
 		Config:           string(s),
 		UserIndexVersion: userIndexVersion,
 		//FmVersion:        fmVersion,
-		PrVersion: prVersion,
-		Me:        nodeInfo.NodeName,
-		Workers:   workers,
-		Servers:   servers,
+		PrVersion:         prVersion,
+		SequentialVersion: sequentialVersion,
+		Me:                nodeInfo.NodeName,
+		Workers:           workers,
+		Servers:           servers,
 	}, nil
 }
 
@@ -117,6 +126,25 @@ func (m *Master) GetPRModel(context.Context, *protocol.NodeInfo) (*protocol.Mode
 	}, nil
 }
 
+func (m *Master) GetSequentialModel(context.Context, *protocol.NodeInfo) (*protocol.Model, error) {
+	m.sequentialMutex.Lock()
+	defer m.sequentialMutex.Unlock()
+	// skip empty model
+	if m.sequentialModel == nil {
+		return &protocol.Model{Version: 0}, nil
+	}
+	// encode model
+	modelData, err := pr.EncodeModel(m.sequentialModel)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.Model{
+		Name:    sequentialModelName,
+		Version: m.sequentialVersion,
+		Model:   modelData,
+	}, nil
+}
+
 //func (m *Master) GetFactorizationMachine(context.Context, *protocol.NodeInfo) (*protocol.Model, error) {
 //	m.fmMutex.Lock()
 //	defer m.fmMutex.Unlock()
@@ -167,6 +195,7 @@ func (m *Master) nodeUp(key string, value interface{}) {
 	m.nodesInfoMutex.Lock()
 	defer m.nodesInfoMutex.Unlock()
 	m.nodesInfo[key] = node
+	m.updateWorkers()
 }
 
 func (m *Master) nodeDown(key string, value interface{}) {
@@ -178,4 +207,17 @@ func (m *Master) nodeDown(key string, value interface{}) {
 	m.nodesInfoMutex.Lock()
 	defer m.nodesInfoMutex.Unlock()
 	delete(m.nodesInfo, key)
+	m.updateWorkers()
+}
+
+// updateWorkers passes workers to the RESTful server, so that active users inserting feedback via
+// the master are published to their workers. It must be called with nodesInfoMutex locked.
+func (m *Master) updateWorkers() {
+	workers := make([]string, 0)
+	for name, info := range m.nodesInfo {
+		if info.Type == WorkerNode {
+			workers = append(workers, name)
+		}
+	}
+	m.SetWorkers(workers)
 }
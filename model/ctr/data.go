@@ -109,6 +109,12 @@ func LoadDataFromBuiltIn(name string) (train *Dataset, test *Dataset, err error)
 	if err != nil {
 		return nil, nil, err
 	}
+	return LoadDataFromLibFM(trainFilePath, testFilePath)
+}
+
+// LoadDataFromLibFM loads a training set and a test set from files in LibFM format. Labels
+// are shared by both sets.
+func LoadDataFromLibFM(trainFilePath, testFilePath string) (train *Dataset, test *Dataset, err error) {
 	train, test = &Dataset{}, &Dataset{}
 	trainMaxLabel, testMaxLabel := 0, 0
 	if train.FeedbackInputs, train.FeedbackTarget, trainMaxLabel, err = LoadLibFMFile(trainFilePath); err != nil {
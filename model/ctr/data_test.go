@@ -18,6 +18,9 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/storage/data"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -28,6 +31,26 @@ func TestLoadDataFromBuiltIn(t *testing.T) {
 	assert.Equal(t, 28860, test.Count())
 }
 
+func TestLoadDataFromLibFM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorse")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	trainPath, testPath := filepath.Join(dir, "train.libfm"), filepath.Join(dir, "test.libfm")
+	err = ioutil.WriteFile(trainPath, []byte("1 0:1 2:1\n0 1:1 3:1\n"), 0644)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(testPath, []byte("1 0:1 5:1\n"), 0644)
+	assert.Nil(t, err)
+	train, test, err := LoadDataFromLibFM(trainPath, testPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, train.Count())
+	assert.Equal(t, 1, test.Count())
+	assert.Equal(t, [][]int{{0, 2}, {1, 3}}, train.FeedbackInputs)
+	assert.Equal(t, []float32{1, 0}, train.FeedbackTarget)
+	// labels are shared by both sets
+	assert.Equal(t, train.UnifiedIndex, test.UnifiedIndex)
+	assert.Equal(t, 6, train.UnifiedIndex.Len())
+}
+
 type mockDatastore struct {
 	data.Database
 	server *miniredis.Miniredis
@@ -17,6 +17,7 @@ import (
 	"encoding/json"
 	"github.com/zhenghaoz/gorse/base"
 	"go.uber.org/zap"
+	"math"
 	"reflect"
 )
 
@@ -141,16 +142,78 @@ func (parameters Params) ToString() string {
 	return string(b)
 }
 
+// Range is a continuous range of a hyper-parameter. A range is declared in a ParamsGrid as
+// the only candidate of a hyper-parameter, such as {Lr: {Range{Low: 0.001, High: 0.1, Log: true}}}.
+type Range struct {
+	Low  float64
+	High float64
+	Log  bool // sample in the log scale
+}
+
+// Sample a value from the range.
+func (r Range) Sample(rng base.RandomGenerator) float64 {
+	if r.Log {
+		return math.Exp(math.Log(r.Low) + rng.Float64()*(math.Log(r.High)-math.Log(r.Low)))
+	}
+	return r.Low + rng.Float64()*(r.High-r.Low)
+}
+
+// Values returns n evenly spaced values in the range (in the log scale if Log is true).
+func (r Range) Values(n int) []interface{} {
+	values := make([]interface{}, n)
+	for i := range values {
+		ratio := 0.0
+		if n > 1 {
+			ratio = float64(i) / float64(n-1)
+		}
+		if r.Log {
+			values[i] = math.Exp(math.Log(r.Low) + ratio*(math.Log(r.High)-math.Log(r.Low)))
+		} else {
+			values[i] = r.Low + ratio*(r.High-r.Low)
+		}
+	}
+	return values
+}
+
 // ParamsGrid contains candidate for grid search.
 type ParamsGrid map[ParamName][]interface{}
 
+// rangeGridSize is the number of values taken from a range in grid search.
+const rangeGridSize = 5
+
+// Discrete replaces ranges in the grid by evenly spaced values.
+func (grid ParamsGrid) Discrete() ParamsGrid {
+	discrete := make(ParamsGrid, len(grid))
+	for param, values := range grid {
+		if r, ok := grid.GetRange(param); ok {
+			discrete[param] = r.Values(rangeGridSize)
+		} else {
+			discrete[param] = values
+		}
+	}
+	return discrete
+}
+
+// GetRange returns the range of a hyper-parameter if it's declared as a range.
+func (grid ParamsGrid) GetRange(param ParamName) (Range, bool) {
+	if values := grid[param]; len(values) == 1 {
+		r, ok := values[0].(Range)
+		return r, ok
+	}
+	return Range{}, false
+}
+
 func (grid ParamsGrid) Len() int {
 	return len(grid)
 }
 
+// NumCombinations returns the number of combinations in the grid. It's MaxInt32 if there are ranges.
 func (grid ParamsGrid) NumCombinations() int {
 	count := 1
-	for _, values := range grid {
+	for param, values := range grid {
+		if _, ok := grid.GetRange(param); ok {
+			return math.MaxInt32
+		}
 		count *= len(values)
 	}
 	return count
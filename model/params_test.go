@@ -15,6 +15,8 @@ package model
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"math"
 	"testing"
 )
 
@@ -111,3 +113,28 @@ func TestParamsGrid(t *testing.T) {
 	assert.Equal(t, []interface{}{0, 1}, grid["a"])
 	assert.Equal(t, []interface{}{4, 5}, grid["b"])
 }
+
+func TestRange(t *testing.T) {
+	rng := base.NewRandomGenerator(0)
+	r := Range{Low: 0.001, High: 0.1, Log: true}
+	for i := 0; i < 100; i++ {
+		value := r.Sample(rng)
+		assert.True(t, value >= r.Low && value <= r.High)
+	}
+	values := r.Values(3)
+	assert.InDelta(t, 0.001, values[0], 1e-9)
+	assert.InDelta(t, 0.01, values[1], 1e-9)
+	assert.InDelta(t, 0.1, values[2], 1e-9)
+	assert.Equal(t, []interface{}{0.0, 0.5, 1.0}, Range{Low: 0, High: 1}.Values(3))
+	// ranges in grid
+	grid := ParamsGrid{"a": {0, 1}, "b": {Range{Low: 0, High: 1}}}
+	_, ok := grid.GetRange("a")
+	assert.False(t, ok)
+	_, ok = grid.GetRange("b")
+	assert.True(t, ok)
+	assert.Equal(t, math.MaxInt32, grid.NumCombinations())
+	discrete := grid.Discrete()
+	assert.Equal(t, []interface{}{0, 1}, discrete["a"])
+	assert.Equal(t, []interface{}{0.0, 0.25, 0.5, 0.75, 1.0}, discrete["b"])
+	assert.Equal(t, 10, discrete.NumCombinations())
+}
@@ -17,11 +17,13 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/iset"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/model"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
@@ -34,6 +36,7 @@ type DataSet struct {
 	ItemIndex     base.Index
 	FeedbackUsers []int
 	FeedbackItems []int
+	FeedbackTimes []time.Time // timestamps of feedback (zero if unknown)
 	UserFeedback  [][]int
 	ItemFeedback  [][]int
 	Negatives     [][]int
@@ -51,6 +54,7 @@ func NewMapIndexDataset() *DataSet {
 	// Initialize slices
 	s.FeedbackUsers = make([]int, 0)
 	s.FeedbackItems = make([]int, 0)
+	s.FeedbackTimes = make([]time.Time, 0)
 	s.UserFeedback = make([][]int, 0)
 	s.ItemFeedback = make([][]int, 0)
 	return s
@@ -64,6 +68,7 @@ func NewDirectIndexDataset() *DataSet {
 	// Initialize slices
 	dataset.FeedbackUsers = make([]int, 0)
 	dataset.FeedbackItems = make([]int, 0)
+	dataset.FeedbackTimes = make([]time.Time, 0)
 	dataset.UserFeedback = make([][]int, 0)
 	dataset.ItemFeedback = make([][]int, 0)
 	dataset.Negatives = make([][]int, 0)
@@ -87,6 +92,11 @@ func (dataset *DataSet) AddItem(itemId string) {
 }
 
 func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool) {
+	dataset.AddTimedFeedback(userId, itemId, time.Time{}, insertUserItem)
+}
+
+// AddTimedFeedback adds feedback with its timestamp, which is used by temporal splits.
+func (dataset *DataSet) AddTimedFeedback(userId, itemId string, timestamp time.Time, insertUserItem bool) {
 	if insertUserItem {
 		dataset.UserIndex.Add(userId)
 	}
@@ -98,6 +108,7 @@ func (dataset *DataSet) AddFeedback(userId, itemId string, insertUserItem bool)
 	if userIndex != base.NotId && itemIndex != base.NotId {
 		dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
 		dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
+		dataset.FeedbackTimes = append(dataset.FeedbackTimes, timestamp)
 		for itemIndex >= len(dataset.ItemFeedback) {
 			dataset.ItemFeedback = append(dataset.ItemFeedback, make([]int, 0))
 		}
@@ -164,59 +175,38 @@ func (dataset *DataSet) NegativeSample(excludeSet *DataSet, numCandidates int) [
 // set. If numTestUsers is equal or greater than the number of total users or numTestUsers <= 0, all users are presented
 // in the test set.
 func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet) {
-	trainSet, testSet := new(DataSet), new(DataSet)
-	trainSet.NumItemLabels, testSet.NumItemLabels = dataset.NumItemLabels, dataset.NumItemLabels
-	trainSet.ItemLabels, trainSet.ItemLabels = dataset.ItemLabels, dataset.ItemLabels
-	trainSet.UserIndex, testSet.UserIndex = dataset.UserIndex, dataset.UserIndex
-	trainSet.ItemIndex, testSet.ItemIndex = dataset.ItemIndex, dataset.ItemIndex
-	trainSet.UserFeedback, testSet.UserFeedback = createSliceOfSlice(dataset.UserCount()), createSliceOfSlice(dataset.UserCount())
-	trainSet.ItemFeedback, testSet.ItemFeedback = createSliceOfSlice(dataset.ItemCount()), createSliceOfSlice(dataset.ItemCount())
+	trainSet, testSet := dataset.newSplitSets()
+	// positions of feedback of users, in the same order as UserFeedback
+	userPositions := createSliceOfSlice(dataset.UserCount())
+	for i, userIndex := range dataset.FeedbackUsers {
+		userPositions[userIndex] = append(userPositions[userIndex], i)
+	}
 	rng := base.NewRandomGenerator(seed)
-	if numTestUsers >= dataset.UserCount() || numTestUsers <= 0 {
-		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
-			if len(dataset.UserFeedback[userIndex]) > 0 {
-				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
-				for i, itemIndex := range dataset.UserFeedback[userIndex] {
-					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
-					}
+	splitUser := func(userIndex int) {
+		if len(userPositions[userIndex]) > 0 {
+			k := rng.Intn(len(userPositions[userIndex]))
+			testSet.addIndexFeedback(dataset, userPositions[userIndex][k])
+			for i, position := range userPositions[userIndex] {
+				if i != k {
+					trainSet.addIndexFeedback(dataset, position)
 				}
 			}
 		}
+	}
+	if numTestUsers >= dataset.UserCount() || numTestUsers <= 0 {
+		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
+			splitUser(userIndex)
+		}
 	} else {
 		testUsers := rng.Sample(0, dataset.UserCount(), numTestUsers)
 		for _, userIndex := range testUsers {
-			if len(dataset.UserFeedback[userIndex]) > 0 {
-				k := rng.Intn(len(dataset.UserFeedback[userIndex]))
-				testSet.FeedbackUsers = append(testSet.FeedbackUsers, userIndex)
-				testSet.FeedbackItems = append(testSet.FeedbackItems, dataset.UserFeedback[userIndex][k])
-				testSet.UserFeedback[userIndex] = append(testSet.UserFeedback[userIndex], dataset.UserFeedback[userIndex][k])
-				testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]] = append(testSet.ItemFeedback[dataset.UserFeedback[userIndex][k]], userIndex)
-				for i, itemIndex := range dataset.UserFeedback[userIndex] {
-					if i != k {
-						trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-						trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-						trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-						trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
-					}
-				}
-			}
+			splitUser(userIndex)
 		}
 		testUserSet := set.NewIntSet(testUsers...)
 		for userIndex := 0; userIndex < dataset.UserCount(); userIndex++ {
 			if !testUserSet.Has(userIndex) {
-				for _, itemIndex := range dataset.UserFeedback[userIndex] {
-					trainSet.FeedbackUsers = append(trainSet.FeedbackUsers, userIndex)
-					trainSet.FeedbackItems = append(trainSet.FeedbackItems, itemIndex)
-					trainSet.UserFeedback[userIndex] = append(trainSet.UserFeedback[userIndex], itemIndex)
-					trainSet.ItemFeedback[itemIndex] = append(trainSet.ItemFeedback[itemIndex], userIndex)
+				for _, position := range userPositions[userIndex] {
+					trainSet.addIndexFeedback(dataset, position)
 				}
 			}
 		}
@@ -224,6 +214,91 @@ func (dataset *DataSet) Split(numTestUsers int, seed int64) (*DataSet, *DataSet)
 	return trainSet, testSet
 }
 
+// newSplitSets creates empty training and test sets sharing indices and labels with the dataset.
+func (dataset *DataSet) newSplitSets() (*DataSet, *DataSet) {
+	trainSet, testSet := new(DataSet), new(DataSet)
+	trainSet.NumItemLabels, testSet.NumItemLabels = dataset.NumItemLabels, dataset.NumItemLabels
+	trainSet.ItemLabels, testSet.ItemLabels = dataset.ItemLabels, dataset.ItemLabels
+	trainSet.UserIndex, testSet.UserIndex = dataset.UserIndex, dataset.UserIndex
+	trainSet.ItemIndex, testSet.ItemIndex = dataset.ItemIndex, dataset.ItemIndex
+	trainSet.UserFeedback, testSet.UserFeedback = createSliceOfSlice(dataset.UserCount()), createSliceOfSlice(dataset.UserCount())
+	trainSet.ItemFeedback, testSet.ItemFeedback = createSliceOfSlice(dataset.ItemCount()), createSliceOfSlice(dataset.ItemCount())
+	return trainSet, testSet
+}
+
+// addIndexFeedback adds the i-th feedback of the source dataset.
+func (dataset *DataSet) addIndexFeedback(source *DataSet, i int) {
+	userIndex, itemIndex := source.FeedbackUsers[i], source.FeedbackItems[i]
+	dataset.FeedbackUsers = append(dataset.FeedbackUsers, userIndex)
+	dataset.FeedbackItems = append(dataset.FeedbackItems, itemIndex)
+	dataset.FeedbackTimes = append(dataset.FeedbackTimes, source.FeedbackTimes[i])
+	dataset.UserFeedback[userIndex] = append(dataset.UserFeedback[userIndex], itemIndex)
+	dataset.ItemFeedback[itemIndex] = append(dataset.ItemFeedback[itemIndex], userIndex)
+}
+
+// TimeQuantile returns the timestamp before which there is the given ratio of feedback.
+func (dataset *DataSet) TimeQuantile(ratio float32) time.Time {
+	if len(dataset.FeedbackTimes) == 0 {
+		return time.Time{}
+	}
+	timestamps := make([]time.Time, len(dataset.FeedbackTimes))
+	copy(timestamps, dataset.FeedbackTimes)
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i].Before(timestamps[j])
+	})
+	k := int(ratio * float32(len(timestamps)))
+	if k < 0 {
+		k = 0
+	} else if k >= len(timestamps) {
+		k = len(timestamps) - 1
+	}
+	return timestamps[k]
+}
+
+// SplitByTime splits dataset by time. Feedback before splitTime is in the training set and
+// the rest is in the test set, so that the future never leaks into training.
+func (dataset *DataSet) SplitByTime(splitTime time.Time) (*DataSet, *DataSet) {
+	trainSet, testSet := dataset.newSplitSets()
+	for i := range dataset.FeedbackUsers {
+		if dataset.FeedbackTimes[i].Before(splitTime) {
+			trainSet.addIndexFeedback(dataset, i)
+		} else {
+			testSet.addIndexFeedback(dataset, i)
+		}
+	}
+	return trainSet, testSet
+}
+
+// SplitLatest splits dataset by user-leave-last-one-out method. The latest feedback of each test
+// user is in the test set. The argument `numTestUsers` works in the same way as Split.
+func (dataset *DataSet) SplitLatest(numTestUsers int, seed int64) (*DataSet, *DataSet) {
+	trainSet, testSet := dataset.newSplitSets()
+	// find latest feedback of users
+	latest := make([]int, dataset.UserCount())
+	for i := range latest {
+		latest[i] = -1
+	}
+	for i, userIndex := range dataset.FeedbackUsers {
+		if latest[userIndex] < 0 || !dataset.FeedbackTimes[i].Before(dataset.FeedbackTimes[latest[userIndex]]) {
+			latest[userIndex] = i
+		}
+	}
+	// select test users
+	var testUserSet *iset.Set
+	if numTestUsers > 0 && numTestUsers < dataset.UserCount() {
+		rng := base.NewRandomGenerator(seed)
+		testUserSet = set.NewIntSet(rng.Sample(0, dataset.UserCount(), numTestUsers)...)
+	}
+	for i, userIndex := range dataset.FeedbackUsers {
+		if latest[userIndex] == i && (testUserSet == nil || testUserSet.Has(userIndex)) {
+			testSet.addIndexFeedback(dataset, i)
+		} else {
+			trainSet.addIndexFeedback(dataset, i)
+		}
+	}
+	return trainSet, testSet
+}
+
 // GetIndex gets the i-th record by <user index, item index, rating>.
 func (dataset *DataSet) GetIndex(i int) (int, int) {
 	return dataset.FeedbackUsers[i], dataset.FeedbackItems[i]
@@ -331,7 +406,7 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string, itemTT
 					return nil, nil, nil, err
 				}
 				for _, v := range feedback {
-					dataset.AddFeedback(v.UserId, v.ItemId, false)
+					dataset.AddTimedFeedback(v.UserId, v.ItemId, v.Timestamp, false)
 					allFeedback = append(allFeedback, v)
 				}
 				if cursor == "" {
@@ -347,7 +422,7 @@ func LoadDataFromDatabase(database data.Database, feedbackTypes []string, itemTT
 				return nil, nil, nil, err
 			}
 			for _, v := range feedback {
-				dataset.AddFeedback(v.UserId, v.ItemId, false)
+				dataset.AddTimedFeedback(v.UserId, v.ItemId, v.Timestamp, false)
 				allFeedback = append(allFeedback, v)
 			}
 			if cursor == "" {
@@ -20,6 +20,7 @@ import (
 	"github.com/zhenghaoz/gorse/storage/data"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestNewMapIndexDataset(t *testing.T) {
@@ -38,6 +39,87 @@ func TestNewMapIndexDataset(t *testing.T) {
 	assert.Equal(t, 6, dataSet.ItemCount())
 }
 
+func TestDataSet_Split(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	// feedback of users are interleaved
+	for j := 0; j < 5; j++ {
+		for i := 0; i < 4; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(i), strconv.Itoa(j), timestamp.Add(time.Duration(i*10+j)*time.Hour), true)
+		}
+	}
+	checkTimes := func(dataSet *DataSet) {
+		assert.Equal(t, dataSet.Count(), len(dataSet.FeedbackTimes))
+		for k := 0; k < dataSet.Count(); k++ {
+			userIndex, itemIndex := dataSet.GetIndex(k)
+			userId, itemId := dataSet.UserIndex.ToName(userIndex), dataSet.ItemIndex.ToName(itemIndex)
+			i, _ := strconv.Atoi(userId)
+			j, _ := strconv.Atoi(itemId)
+			assert.Equal(t, timestamp.Add(time.Duration(i*10+j)*time.Hour), dataSet.FeedbackTimes[k])
+		}
+	}
+	// all users are test users
+	train, test := dataSet.Split(0, 0)
+	assert.Equal(t, 16, train.Count())
+	assert.Equal(t, 4, test.Count())
+	checkTimes(train)
+	checkTimes(test)
+	// part of users are test users
+	train, test = dataSet.Split(2, 0)
+	assert.Equal(t, 18, train.Count())
+	assert.Equal(t, 2, test.Count())
+	checkTimes(train)
+	checkTimes(test)
+}
+
+func TestDataSet_SplitByTime(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 5; j++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(i), strconv.Itoa(j), timestamp.AddDate(0, 0, j), true)
+		}
+	}
+	// the latest 40% feedback are held out
+	splitTime := dataSet.TimeQuantile(0.6)
+	assert.Equal(t, timestamp.AddDate(0, 0, 3), splitTime)
+	train, test := dataSet.SplitByTime(splitTime)
+	assert.Equal(t, 12, train.Count())
+	assert.Equal(t, 8, test.Count())
+	for i := 0; i < train.Count(); i++ {
+		assert.True(t, train.FeedbackTimes[i].Before(splitTime))
+	}
+	for i := 0; i < test.Count(); i++ {
+		assert.False(t, test.FeedbackTimes[i].Before(splitTime))
+	}
+	assert.Equal(t, []int{0, 1, 2}, train.UserFeedback[0])
+	assert.Equal(t, []int{3, 4}, test.UserFeedback[0])
+	assert.Equal(t, []int{0, 1, 2, 3}, test.ItemFeedback[4])
+}
+
+func TestDataSet_SplitLatest(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	timestamp := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 5; j++ {
+			// the latest feedback of user i is item i
+			dataSet.AddTimedFeedback(strconv.Itoa(i), strconv.Itoa(j), timestamp.AddDate(0, 0, (j-i+4)%5), true)
+		}
+	}
+	train, test := dataSet.SplitLatest(0, 0)
+	assert.Equal(t, 16, train.Count())
+	assert.Equal(t, 4, test.Count())
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, []int{i}, test.UserFeedback[i])
+		assert.NotContains(t, train.UserFeedback[i], i)
+		assert.Len(t, train.UserFeedback[i], 4)
+	}
+	// part split
+	train, test = dataSet.SplitLatest(2, 0)
+	assert.Equal(t, 18, train.Count())
+	assert.Equal(t, 2, test.Count())
+}
+
 func TestLoadDataFromCSV(t *testing.T) {
 	dataset := LoadDataFromCSV("../../misc/csv_test/feedback.csv", ",", true)
 	assert.Equal(t, 5, dataset.Count())
@@ -94,6 +176,7 @@ func TestLoadDataFromDatabase(t *testing.T) {
 					ItemId:       fmt.Sprintf("item%v", j),
 					FeedbackType: "FeedbackType",
 				},
+				Timestamp: time.Date(2021, 1, i+1, 0, 0, 0, 0, time.UTC),
 			}, false, false)
 			assert.Nil(t, err)
 		}
@@ -102,6 +185,10 @@ func TestLoadDataFromDatabase(t *testing.T) {
 	dataset, _, _, err := LoadDataFromDatabase(database.Database, []string{"FeedbackType"}, 0, 0)
 	assert.Nil(t, err)
 	assert.Equal(t, 9, dataset.Count())
+	for i := 0; i < dataset.Count(); i++ {
+		userIndex, _ := dataset.GetIndex(i)
+		assert.Equal(t, userIndex+1, dataset.FeedbackTimes[i].Day())
+	}
 	// split
 	train, test := dataset.Split(0, 0)
 	assert.Equal(t, numUsers, train.UserCount())
@@ -22,6 +22,8 @@ import (
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/floats"
 	"github.com/zhenghaoz/gorse/model"
+	"sort"
+	"sync/atomic"
 )
 
 /* Evaluate Item Ranking */
@@ -69,6 +71,22 @@ func Evaluate(estimator model.Model, testSet *DataSet, trainSet *DataSet, topK i
 	return sum
 }
 
+// EvaluateScore evaluates a model by accuracy metrics and beyond-accuracy metrics.
+func EvaluateScore(estimator model.Model, testSet *DataSet, trainSet *DataSet, config *FitConfig) Score {
+	exposure := NewExposure(trainSet.ItemCount())
+	scores := Evaluate(estimator, testSet, trainSet, config.TopK, config.Candidates, config.Jobs,
+		NDCG, Precision, Recall, IntraListDiversity(trainSet.ItemLabels), Novelty(trainSet), exposure.Record)
+	return Score{
+		NDCG:      scores[0],
+		Precision: scores[1],
+		Recall:    scores[2],
+		Diversity: scores[3],
+		Novelty:   scores[4],
+		Coverage:  exposure.Coverage(),
+		Gini:      exposure.Gini(),
+	}
+}
+
 // NDCG means Normalized Discounted Cumulative Gain.
 func NDCG(targetSet *iset.Set, rankList []int) float32 {
 	// IDCG = \sum^{|REL|}_{i=1} \frac {1} {\log_2(i+1)}
@@ -155,6 +173,116 @@ func MRR(targetSet *iset.Set, rankList []int) float32 {
 	return 0
 }
 
+// IntraListDiversity is the average label distance between pairs of recommended items. The
+// distance between two items is one minus the Jaccard similarity of their labels.
+func IntraListDiversity(itemLabels [][]int) Metric {
+	labelSets := make([]*iset.Set, len(itemLabels))
+	for i, labels := range itemLabels {
+		labelSets[i] = set.NewIntSet(labels...)
+	}
+	getLabels := func(itemIndex int) *iset.Set {
+		if itemIndex < len(labelSets) {
+			return labelSets[itemIndex]
+		}
+		return set.NewIntSet()
+	}
+	return func(targetSet *iset.Set, rankList []int) float32 {
+		if len(rankList) < 2 {
+			return 0
+		}
+		sum := float32(0)
+		for i := 0; i < len(rankList); i++ {
+			for j := i + 1; j < len(rankList); j++ {
+				a, b := getLabels(rankList[i]), getLabels(rankList[j])
+				union := iset.Union(a, b).Size()
+				if union > 0 {
+					sum += 1 - float32(iset.Intersection(a, b).Size())/float32(union)
+				}
+			}
+		}
+		return sum * 2 / float32(len(rankList)*(len(rankList)-1))
+	}
+}
+
+// Novelty is the average self-information of recommended items. The self-information of an item
+// is -log2(p), where p is the (smoothed) fraction of users giving feedback to the item in training.
+func Novelty(trainSet *DataSet) Metric {
+	information := make([]float32, trainSet.ItemCount())
+	for itemIndex := range information {
+		popularity := 0
+		if itemIndex < len(trainSet.ItemFeedback) {
+			popularity = len(trainSet.ItemFeedback[itemIndex])
+		}
+		information[itemIndex] = -math32.Log2(float32(popularity+1) / float32(trainSet.UserCount()+1))
+	}
+	return func(targetSet *iset.Set, rankList []int) float32 {
+		if len(rankList) == 0 {
+			return 0
+		}
+		sum := float32(0)
+		for _, itemIndex := range rankList {
+			sum += information[itemIndex]
+		}
+		return sum / float32(len(rankList))
+	}
+}
+
+// Exposure counts how many times items are recommended, which are used by catalog-level
+// metrics. Pass the Record method to Evaluate as a metric, then read metrics from it.
+type Exposure struct {
+	counts []int32
+}
+
+// NewExposure creates an exposure counter for items.
+func NewExposure(numItems int) *Exposure {
+	return &Exposure{counts: make([]int32, numItems)}
+}
+
+// Record counts items in a recommendation list. It's safe to be called concurrently.
+func (exposure *Exposure) Record(targetSet *iset.Set, rankList []int) float32 {
+	for _, itemIndex := range rankList {
+		if itemIndex < len(exposure.counts) {
+			atomic.AddInt32(&exposure.counts[itemIndex], 1)
+		}
+	}
+	return 0
+}
+
+// Coverage is the fraction of items recommended at least once.
+func (exposure *Exposure) Coverage() float32 {
+	if len(exposure.counts) == 0 {
+		return 0
+	}
+	covered := 0
+	for _, count := range exposure.counts {
+		if count > 0 {
+			covered++
+		}
+	}
+	return float32(covered) / float32(len(exposure.counts))
+}
+
+// Gini is the Gini index of item exposures. It's 0 if all items are recommended equally, and
+// approaches 1 if recommendations concentrate on a few items.
+func (exposure *Exposure) Gini() float32 {
+	n := len(exposure.counts)
+	counts := make([]int, n)
+	total := 0
+	for i, count := range exposure.counts {
+		counts[i] = int(count)
+		total += int(count)
+	}
+	if n == 0 || total == 0 {
+		return 0
+	}
+	sort.Ints(counts)
+	sum := float32(0)
+	for i, count := range counts {
+		sum += float32(2*(i+1)-n-1) * float32(count)
+	}
+	return sum / float32(n) / float32(total)
+}
+
 func Rank(model model.Model, userId int, userProfile []int, candidates []int, topN int) ([]int, []float32) {
 	// Get top-n list
 	itemsHeap := base.NewTopKFilter(topN)
@@ -180,6 +308,29 @@ func Rank(model model.Model, userId int, userProfile []int, candidates []int, to
 type SnapshotManger struct {
 	BestWeights []interface{}
 	BestScore   Score
+	// early stopping
+	Curve        []EpochScore // scores at evaluated epochs
+	stoppingNDCG float32      // best NDCG improved by at least the minimum delta
+	staleCount   int          // number of evaluations without improvement
+}
+
+// AddEpoch records the score at an epoch. It returns true if training should stop early since
+// NDCG hasn't improved by minDelta for patience evaluations. Early stopping is disabled if
+// patience <= 0.
+func (sm *SnapshotManger) AddEpoch(epoch int, score Score, patience int, minDelta float32) bool {
+	sm.Curve = append(sm.Curve, EpochScore{
+		Epoch:     epoch,
+		NDCG:      score.NDCG,
+		Precision: score.Precision,
+		Recall:    score.Recall,
+	})
+	if len(sm.Curve) == 1 || score.NDCG > sm.stoppingNDCG+minDelta {
+		sm.stoppingNDCG = score.NDCG
+		sm.staleCount = 0
+	} else {
+		sm.staleCount++
+	}
+	return patience > 0 && sm.staleCount >= patience
 }
 
 // AddSnapshot adds a copied snapshot.
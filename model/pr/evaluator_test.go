@@ -68,6 +68,48 @@ func TestHR(t *testing.T) {
 	EqualEpsilon(t, 0, HR(set.NewIntSet(30), rankList), evalEpsilon)
 }
 
+func TestIntraListDiversity(t *testing.T) {
+	itemLabels := [][]int{{0, 1}, {1, 2}, {0, 1}}
+	diversity := IntraListDiversity(itemLabels)
+	// distances: (0, 1) = 2/3, (0, 2) = 0, (1, 2) = 2/3
+	EqualEpsilon(t, 4.0/9.0, diversity(nil, []int{0, 1, 2}), evalEpsilon)
+	EqualEpsilon(t, 0, diversity(nil, []int{0, 2}), evalEpsilon)
+	EqualEpsilon(t, 0, diversity(nil, []int{0}), evalEpsilon)
+}
+
+func TestNovelty(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	for i := 0; i < 7; i++ {
+		dataSet.AddFeedback(strconv.Itoa(i), "0", true)
+	}
+	dataSet.AddFeedback("0", "1", true)
+	novelty := Novelty(dataSet)
+	EqualEpsilon(t, 0, novelty(nil, []int{0}), evalEpsilon)
+	EqualEpsilon(t, 2, novelty(nil, []int{1}), evalEpsilon)
+	EqualEpsilon(t, 1, novelty(nil, []int{0, 1}), evalEpsilon)
+}
+
+func TestExposure(t *testing.T) {
+	// all items are recommended equally
+	exposure := NewExposure(4)
+	exposure.Record(nil, []int{0, 1})
+	exposure.Record(nil, []int{2, 3})
+	EqualEpsilon(t, 1, exposure.Coverage(), evalEpsilon)
+	EqualEpsilon(t, 0, exposure.Gini(), evalEpsilon)
+	// only one item is recommended
+	exposure = NewExposure(4)
+	exposure.Record(nil, []int{0})
+	exposure.Record(nil, []int{0})
+	EqualEpsilon(t, 0.25, exposure.Coverage(), evalEpsilon)
+	EqualEpsilon(t, 0.75, exposure.Gini(), evalEpsilon)
+}
+
+func TestObjective_Of(t *testing.T) {
+	score := Score{NDCG: 0.5, Coverage: 0.2, Gini: 0.8}
+	EqualEpsilon(t, 0.5, Objective{}.Of(score), evalEpsilon)
+	EqualEpsilon(t, 0.46, Objective{NDCG: 1, Coverage: 0.2, Gini: -0.1}.Of(score), evalEpsilon)
+}
+
 type mockMatrixFactorizationForEval struct {
 	model.BaseModel
 	positive []*iset.Set
@@ -156,3 +198,23 @@ func TestSnapshotManger_AddSnapshot(t *testing.T) {
 	assert.Equal(t, []int{3}, snapshots.BestWeights[0])
 	assert.Equal(t, [][]int{{3}}, snapshots.BestWeights[1])
 }
+
+func TestSnapshotManger_AddEpoch(t *testing.T) {
+	snapshots := SnapshotManger{}
+	assert.False(t, snapshots.AddEpoch(0, Score{NDCG: 0.1}, 2, 0.01))
+	assert.False(t, snapshots.AddEpoch(1, Score{NDCG: 0.2}, 2, 0.01))
+	// improvements less than the minimum delta are stale
+	assert.False(t, snapshots.AddEpoch(2, Score{NDCG: 0.205}, 2, 0.01))
+	assert.True(t, snapshots.AddEpoch(3, Score{NDCG: 0.15}, 2, 0.01))
+	assert.Equal(t, []EpochScore{
+		{Epoch: 0, NDCG: 0.1},
+		{Epoch: 1, NDCG: 0.2},
+		{Epoch: 2, NDCG: 0.205},
+		{Epoch: 3, NDCG: 0.15},
+	}, snapshots.Curve)
+	// never stop if patience is zero
+	snapshots = SnapshotManger{}
+	for epoch := 0; epoch < 10; epoch++ {
+		assert.False(t, snapshots.AddEpoch(epoch, Score{}, 0, 0))
+	}
+}
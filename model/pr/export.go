@@ -0,0 +1,158 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/zhenghaoz/gorse/base"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats to export latent factors.
+const (
+	CSVFormat   = "csv"
+	JSONLFormat = "jsonl"
+	NPYFormat   = "npy"
+)
+
+// ExportUserFactors writes latent factors of users with their IDs in a format.
+func ExportUserFactors(w io.Writer, m Embedding, format string) error {
+	return exportFactors(w, format, "user_id", m.GetUserIndex(), m.GetUserFactor)
+}
+
+// ExportItemFactors writes latent factors of items with their IDs in a format.
+func ExportItemFactors(w io.Writer, m Embedding, format string) error {
+	return exportFactors(w, format, "item_id", m.GetItemIndex(), m.GetItemFactor)
+}
+
+// FactorRecord is a line of latent factors exported in JSONL.
+type FactorRecord struct {
+	Id     string
+	Factor []float32
+}
+
+func exportFactors(w io.Writer, format, idName string, index base.Index, factor func(int) []float32) error {
+	if index == nil {
+		return fmt.Errorf("model hasn't been fitted")
+	}
+	names := index.GetNames()
+	switch format {
+	case CSVFormat:
+		return exportFactorsCSV(w, idName, names, factor)
+	case JSONLFormat:
+		return exportFactorsJSONL(w, names, factor)
+	case NPYFormat:
+		return exportFactorsNPY(w, names, factor)
+	}
+	return fmt.Errorf("unknown format %v", format)
+}
+
+// exportFactorsCSV writes a header and a line for each ID, which is the ID followed by the factor.
+func exportFactorsCSV(w io.Writer, idName string, names []string, factor func(int) []float32) error {
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	if len(names) > 0 {
+		header := []string{idName}
+		for i := range factor(0) {
+			header = append(header, fmt.Sprintf("factor_%d", i))
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	for i, name := range names {
+		record := []string{name}
+		for _, value := range factor(i) {
+			record = append(record, strconv.FormatFloat(float64(value), 'g', -1, 32))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// exportFactorsJSONL writes a JSON object for each ID in a line.
+func exportFactorsJSONL(w io.Writer, names []string, factor func(int) []float32) error {
+	encoder := json.NewEncoder(w)
+	for i, name := range names {
+		if err := encoder.Encode(FactorRecord{Id: name, Factor: factor(i)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportFactorsNPY writes a NumPy structured array of IDs and factors. The array could be
+// loaded by numpy.load(), then IDs and factors are array["id"] and array["factor"].
+func exportFactorsNPY(w io.Writer, names []string, factor func(int) []float32) error {
+	// find the shape of the array
+	maxLength, numFactors := 1, 0
+	for _, name := range names {
+		maxLength = base.Max(maxLength, utf8.RuneCountInString(name))
+	}
+	if len(names) > 0 {
+		numFactors = len(factor(0))
+	}
+	// write header: magic string, version 1.0, header length and header padded to 64 bytes
+	header := fmt.Sprintf("{'descr': [('id', '<U%d'), ('factor', '<f4', (%d,))], 'fortran_order': False, 'shape': (%d,), }",
+		maxLength, numFactors, len(names))
+	const prefixLength = 10
+	padding := 64 - (prefixLength+len(header)+1)%64
+	if padding == 64 {
+		padding = 0
+	}
+	header += strings.Repeat(" ", padding) + "\n"
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString("\x93NUMPY\x01\x00"); err != nil {
+		return err
+	}
+	if err := binary.Write(writer, binary.LittleEndian, uint16(len(header))); err != nil {
+		return err
+	}
+	if _, err := writer.WriteString(header); err != nil {
+		return err
+	}
+	// write records: IDs in UTF-32 padded by zeros and factors in float32
+	record := make([]byte, 4*maxLength+4*numFactors)
+	for i, name := range names {
+		for j := range record {
+			record[j] = 0
+		}
+		offset := 0
+		for _, r := range name {
+			binary.LittleEndian.PutUint32(record[offset:], uint32(r))
+			offset += 4
+		}
+		offset = 4 * maxLength
+		for _, value := range factor(i) {
+			binary.LittleEndian.PutUint32(record[offset:], math.Float32bits(value))
+			offset += 4
+		}
+		if _, err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
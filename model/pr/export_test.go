@@ -0,0 +1,93 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"math"
+	"testing"
+)
+
+func newMockEmbedding() *BPR {
+	bpr := NewBPR(nil)
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.UserIndex.Add("alice")
+	bpr.UserIndex.Add("bob")
+	bpr.ItemIndex = base.NewMapIndex()
+	bpr.ItemIndex.Add("1")
+	bpr.UserFactor = [][]float32{{0.5, 1}, {-1, 2.25}}
+	bpr.ItemFactor = [][]float32{{3, 4}}
+	return bpr
+}
+
+func TestExportFactors_CSV(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := ExportUserFactors(buf, newMockEmbedding(), CSVFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "user_id,factor_0,factor_1\r\nalice,0.5,1\r\nbob,-1,2.25\r\n", buf.String())
+	buf.Reset()
+	err = ExportItemFactors(buf, newMockEmbedding(), CSVFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "item_id,factor_0,factor_1\r\n1,3,4\r\n", buf.String())
+}
+
+func TestExportFactors_JSONL(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := ExportUserFactors(buf, newMockEmbedding(), JSONLFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"Id\":\"alice\",\"Factor\":[0.5,1]}\n{\"Id\":\"bob\",\"Factor\":[-1,2.25]}\n", buf.String())
+}
+
+func TestExportFactors_NPY(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	err := ExportUserFactors(buf, newMockEmbedding(), NPYFormat)
+	assert.Nil(t, err)
+	data := buf.Bytes()
+	// check header
+	assert.Equal(t, "\x93NUMPY\x01\x00", string(data[:8]))
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	assert.Zero(t, (10+headerLength)%64)
+	header := string(data[10 : 10+headerLength])
+	assert.Contains(t, header, "{'descr': [('id', '<U5'), ('factor', '<f4', (2,))], 'fortran_order': False, 'shape': (2,), }")
+	assert.Equal(t, byte('\n'), header[len(header)-1])
+	// check records
+	records := data[10+headerLength:]
+	assert.Equal(t, 2*(4*5+4*2), len(records))
+	assert.Equal(t, uint32('b'), binary.LittleEndian.Uint32(records[28:]))
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(records[28+12:]))
+	assert.Equal(t, float32(-1), math.Float32frombits(binary.LittleEndian.Uint32(records[28+20:])))
+	assert.Equal(t, float32(2.25), math.Float32frombits(binary.LittleEndian.Uint32(records[28+24:])))
+}
+
+func TestExportFactors_ALS(t *testing.T) {
+	dataSet := NewMapIndexDataset()
+	dataSet.AddFeedback("alice", "1", true)
+	dataSet.AddFeedback("bob", "2", true)
+	als := NewALS(nil)
+	als.Init(dataSet)
+	buf := bytes.NewBuffer(nil)
+	err := ExportItemFactors(buf, als, JSONLFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, als.ItemIndex.Len(), bytes.Count(buf.Bytes(), []byte("\n")))
+	// unknown format
+	err = ExportItemFactors(buf, als, "xml")
+	assert.NotNil(t, err)
+	// model not fitted
+	err = ExportItemFactors(buf, NewALS(nil), CSVFormat)
+	assert.NotNil(t, err)
+}
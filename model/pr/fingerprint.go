@@ -0,0 +1,166 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pr
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/zhenghaoz/gorse/base"
+	"hash"
+	"math"
+	"sort"
+)
+
+// Fingerprint identifies the data a model was trained on. Datasets with the same fingerprint
+// have the same users, items, feedback and item labels in the same order.
+type Fingerprint struct {
+	NumUsers    int
+	NumItems    int
+	NumFeedback int
+	Checksum    string // SHA-256 of users, items, feedback and item labels
+}
+
+// Fingerprint computes the fingerprint of the dataset.
+func (dataset *DataSet) Fingerprint() Fingerprint {
+	h := sha256.New()
+	writeIndex(h, dataset.UserIndex)
+	writeIndex(h, dataset.ItemIndex)
+	writeInt(h, int64(dataset.Count()))
+	for i := range dataset.FeedbackUsers {
+		writeInt(h, int64(dataset.FeedbackUsers[i]))
+		writeInt(h, int64(dataset.FeedbackItems[i]))
+		if i < len(dataset.FeedbackTimes) {
+			writeInt(h, dataset.FeedbackTimes[i].UnixNano())
+		}
+	}
+	writeInt(h, int64(len(dataset.ItemLabels)))
+	for _, labels := range dataset.ItemLabels {
+		writeInts(h, labels)
+	}
+	return Fingerprint{
+		NumUsers:    dataset.UserCount(),
+		NumItems:    dataset.ItemCount(),
+		NumFeedback: dataset.Count(),
+		Checksum:    hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// Checksum computes the SHA-256 checksum of hyper-parameters, indices and weights of a fitted
+// model. Models fitted from the same dataset with the same hyper-parameters and seed have the
+// same checksum. Gob encoding isn't used since maps are encoded in random order.
+func Checksum(m Model) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(m.GetParams().ToString()))
+	switch m := m.(type) {
+	case *BPR:
+		writeIndex(h, m.UserIndex)
+		writeIndex(h, m.ItemIndex)
+		writeMatrix(h, m.UserFactor)
+		writeMatrix(h, m.ItemFactor)
+	case *ALS:
+		writeIndex(h, m.UserIndex)
+		writeIndex(h, m.ItemIndex)
+		if m.UserFactor != nil && m.ItemFactor != nil {
+			writeFloat64s(h, m.UserFactor.RawMatrix().Data)
+			writeFloat64s(h, m.ItemFactor.RawMatrix().Data)
+		}
+	case *CCD:
+		writeIndex(h, m.UserIndex)
+		writeIndex(h, m.ItemIndex)
+		writeMatrix(h, m.UserFactor)
+		writeMatrix(h, m.ItemFactor)
+	case *HMF:
+		writeIndex(h, m.UserIndex)
+		writeIndex(h, m.ItemIndex)
+		writeMatrix(h, m.UserFactor)
+		writeMatrix(h, m.ItemFactor)
+		writeMatrix(h, m.LabelFactor)
+		writeInt(h, int64(len(m.ItemLabels)))
+		for _, labels := range m.ItemLabels {
+			writeInts(h, labels)
+		}
+	case *FPMC:
+		writeIndex(h, m.UserIndex)
+		writeIndex(h, m.ItemIndex)
+		writeMatrix(h, m.UserFactor)
+		writeMatrix(h, m.ItemFactor)
+		writeMatrix(h, m.NextItemFactor)
+		writeMatrix(h, m.PrevItemFactor)
+		writeInts(h, m.LastItems)
+	case *KNN:
+		writeIndex(h, m.ItemIndex)
+		writeInt(h, int64(len(m.Similarity)))
+		for i := range m.Similarity {
+			// neighbors are written in the order of indices
+			neighbors := make([]int, 0, len(m.Similarity[i].Map))
+			for j := range m.Similarity[i].Map {
+				neighbors = append(neighbors, j)
+			}
+			sort.Ints(neighbors)
+			writeInt(h, int64(len(neighbors)))
+			for _, j := range neighbors {
+				writeInt(h, int64(j))
+				writeInt(h, int64(math.Float32bits(m.Similarity[i].Map[j])))
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeInt(h hash.Hash, x int64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(x))
+	_, _ = h.Write(buf[:])
+}
+
+func writeInts(h hash.Hash, a []int) {
+	writeInt(h, int64(len(a)))
+	for _, x := range a {
+		writeInt(h, int64(x))
+	}
+}
+
+func writeString(h hash.Hash, s string) {
+	writeInt(h, int64(len(s)))
+	_, _ = h.Write([]byte(s))
+}
+
+func writeIndex(h hash.Hash, index base.Index) {
+	if index == nil {
+		writeInt(h, -1)
+		return
+	}
+	writeInt(h, int64(index.Len()))
+	for i := 0; i < index.Len(); i++ {
+		writeString(h, index.ToName(i))
+	}
+}
+
+func writeMatrix(h hash.Hash, m [][]float32) {
+	writeInt(h, int64(len(m)))
+	for _, row := range m {
+		writeInt(h, int64(len(row)))
+		for _, x := range row {
+			writeInt(h, int64(math.Float32bits(x)))
+		}
+	}
+}
+
+func writeFloat64s(h hash.Hash, a []float64) {
+	writeInt(h, int64(len(a)))
+	for _, x := range a {
+		writeInt(h, int64(math.Float64bits(x)))
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/model"
+	"testing"
+	"time"
+)
+
+func TestDataSet_Fingerprint(t *testing.T) {
+	newDataSet := func() *DataSet {
+		dataSet := NewMapIndexDataset()
+		dataSet.AddTimedFeedback("1", "2", time.Unix(1, 0), true)
+		dataSet.AddTimedFeedback("1", "3", time.Unix(2, 0), true)
+		dataSet.AddTimedFeedback("2", "3", time.Unix(3, 0), true)
+		return dataSet
+	}
+	fingerprint := newDataSet().Fingerprint()
+	assert.Equal(t, 2, fingerprint.NumUsers)
+	assert.Equal(t, 2, fingerprint.NumItems)
+	assert.Equal(t, 3, fingerprint.NumFeedback)
+	assert.Equal(t, fingerprint, newDataSet().Fingerprint())
+	// different timestamp
+	dataSet := newDataSet()
+	dataSet.FeedbackTimes[0] = time.Unix(4, 0)
+	assert.NotEqual(t, fingerprint.Checksum, dataSet.Fingerprint().Checksum)
+	// different feedback with the same counts
+	dataSet = NewMapIndexDataset()
+	dataSet.AddTimedFeedback("1", "2", time.Unix(1, 0), true)
+	dataSet.AddTimedFeedback("1", "3", time.Unix(2, 0), true)
+	dataSet.AddTimedFeedback("2", "2", time.Unix(3, 0), true)
+	assert.Equal(t, fingerprint.NumFeedback, dataSet.Fingerprint().NumFeedback)
+	assert.NotEqual(t, fingerprint.Checksum, dataSet.Fingerprint().Checksum)
+}
+
+func TestChecksum(t *testing.T) {
+	trainSet, testSet := newClusteredDataset()
+	for _, name := range []string{"als", "bpr", "ccd", "fpmc", "hmf", "knn"} {
+		fit := func(seed int64) Model {
+			m, err := NewModel(name, model.Params{model.NEpochs: 3, model.RandomState: seed})
+			assert.NoError(t, err)
+			m.Fit(trainSet, testSet, fitConfig)
+			return m
+		}
+		assert.Equal(t, Checksum(fit(1)), Checksum(fit(1)), name)
+	}
+	// different weights
+	bpr := NewBPR(model.Params{model.NEpochs: 3})
+	bpr.Fit(trainSet, testSet, fitConfig)
+	checksum := Checksum(bpr)
+	bpr.UserFactor[0][0]++
+	assert.NotEqual(t, checksum, Checksum(bpr))
+}
@@ -0,0 +1,368 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"fmt"
+	"github.com/chewxy/math32"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/floats"
+	"github.com/zhenghaoz/gorse/model"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// FPMC is the factorized personalized Markov chain (Rendle, Steffen, et al. "Factorizing personalized
+// Markov chains for next-basket recommendation." WWW 2010), which combines matrix factorization and
+// a factorized first-order Markov chain. The rating given by a user u to a item i after the
+// previous item l is:
+//
+//   x_{u,l,i} = <v^{U,I}_u, v^{I,U}_i> + <v^{I,L}_i, v^{L,I}_l>
+//
+// The model is trained by the S-BPR loss on transitions in time-ordered feedback of users.
+// Hyper-parameters:
+//   NFactors   - The number of latent factors. Default is 10.
+//   NEpochs    - The number of training epochs. Default is 100.
+//   Lr         - The learning rate of SGD. Default is 0.05.
+//   Reg        - The strength of regularization. Default is 0.01.
+//   InitMean   - The mean of initial latent factors. Default is 0.
+//   InitStdDev - The standard deviation of initial latent factors. Default is 0.001.
+type FPMC struct {
+	BaseMatrixFactorization
+	// Model parameters
+	UserFactor     [][]float32 // v^{U,I}_u
+	ItemFactor     [][]float32 // v^{I,U}_i
+	NextItemFactor [][]float32 // v^{I,L}_i
+	PrevItemFactor [][]float32 // v^{L,I}_l
+	LastItems      []int       // the last item of each user in the training set
+	// Hyper parameters
+	nFactors   int
+	nEpochs    int
+	lr         float32
+	reg        float32
+	initMean   float32
+	initStdDev float32
+}
+
+// NewFPMC creates a FPMC model.
+func NewFPMC(params model.Params) *FPMC {
+	fpmc := new(FPMC)
+	fpmc.SetParams(params)
+	return fpmc
+}
+
+// SetParams sets hyper-parameters of the FPMC model.
+func (fpmc *FPMC) SetParams(params model.Params) {
+	fpmc.BaseMatrixFactorization.SetParams(params)
+	fpmc.nFactors = fpmc.Params.GetInt(model.NFactors, 10)
+	fpmc.nEpochs = fpmc.Params.GetInt(model.NEpochs, 100)
+	fpmc.lr = fpmc.Params.GetFloat32(model.Lr, 0.05)
+	fpmc.reg = fpmc.Params.GetFloat32(model.Reg, 0.01)
+	fpmc.initMean = fpmc.Params.GetFloat32(model.InitMean, 0)
+	fpmc.initStdDev = fpmc.Params.GetFloat32(model.InitStdDev, 0.001)
+}
+
+func (fpmc *FPMC) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.NFactors:   []interface{}{8, 16, 32, 64},
+		model.Lr:         []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.InitMean:   []interface{}{0},
+		model.InitStdDev: []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+	}
+}
+
+// Predict by the FPMC model. The previous item is the last item of the user in the training set.
+func (fpmc *FPMC) Predict(userId, itemId string) float32 {
+	userIndex := fpmc.UserIndex.ToNumber(userId)
+	itemIndex := fpmc.ItemIndex.ToNumber(itemId)
+	if userIndex == base.NotId {
+		base.Logger().Warn("unknown user", zap.String("user_id", userId))
+	}
+	if itemIndex == base.NotId {
+		base.Logger().Warn("unknown item", zap.String("item_id", itemId))
+	}
+	return fpmc.InternalPredict(userIndex, itemIndex)
+}
+
+// InternalPredict predicts the rating given by a user to a item after the last item of the user
+// in the training set.
+func (fpmc *FPMC) InternalPredict(userIndex, itemIndex int) float32 {
+	return fpmc.InternalPredictNext(userIndex, nil, itemIndex)
+}
+
+// InternalPredictNext predicts the rating given by a user to a item after recent items. Only the
+// most recent item is used since the Markov chain is first-order. If there is no recent item, the
+// last item of the user in the training set is used.
+func (fpmc *FPMC) InternalPredictNext(userIndex int, recentItems []int, itemIndex int) float32 {
+	if itemIndex == base.NotId {
+		return 0
+	}
+	ret := float32(0)
+	prevIndex := base.NotId
+	if userIndex != base.NotId {
+		// + <v^{U,I}_u, v^{I,U}_i>
+		ret += floats.Dot(fpmc.UserFactor[userIndex], fpmc.ItemFactor[itemIndex])
+		prevIndex = fpmc.LastItems[userIndex]
+	}
+	if len(recentItems) > 0 {
+		prevIndex = recentItems[0]
+	}
+	if prevIndex != base.NotId {
+		// + <v^{I,L}_i, v^{L,I}_l>
+		ret += floats.Dot(fpmc.NextItemFactor[itemIndex], fpmc.PrevItemFactor[prevIndex])
+	}
+	return ret
+}
+
+// Fit the FPMC model.
+func (fpmc *FPMC) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit fpmc",
+		zap.Any("params", fpmc.GetParams()),
+		zap.Any("config", config))
+	fpmc.Init(trainSet)
+	// Create buffers
+	temp := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	userFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	positiveItemFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	negativeItemFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	positiveNextFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	negativeNextFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	prevFactor := base.NewMatrix32(config.Jobs, fpmc.nFactors)
+	rng := make([]base.RandomGenerator, config.Jobs)
+	for i := 0; i < config.Jobs; i++ {
+		rng[i] = base.NewRandomGenerator(fpmc.GetRandomGenerator().Int63())
+	}
+	// Sort feedback of users by time
+	sequences := sortFeedbackByTime(trainSet)
+	userFeedback := make([]map[int]interface{}, trainSet.UserCount())
+	for u := range userFeedback {
+		userFeedback[u] = make(map[int]interface{})
+		for _, i := range trainSet.UserFeedback[u] {
+			userFeedback[u][i] = nil
+		}
+	}
+	snapshots := SnapshotManger{}
+	evalStart := time.Now()
+	score := EvaluateScore(fpmc, valSet, trainSet, config)
+	evalTime := time.Since(evalStart)
+	base.Logger().Debug(fmt.Sprintf("fit fpmc %v/%v", 0, fpmc.nEpochs),
+		zap.String("eval_time", evalTime.String()),
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+	snapshots.AddSnapshot(score, fpmc.UserFactor, fpmc.ItemFactor, fpmc.NextItemFactor, fpmc.PrevItemFactor)
+	snapshots.AddEpoch(0, score, config.Patience, config.MinDelta)
+	// Training
+	for epoch := 1; epoch <= fpmc.nEpochs; epoch++ {
+		fitStart := time.Now()
+		_ = base.Parallel(trainSet.Count(), config.Jobs, func(workerId, _ int) error {
+			// Select a user
+			var userIndex, ratingCount int
+			for {
+				userIndex = rng[workerId].Intn(trainSet.UserCount())
+				ratingCount = len(sequences[userIndex])
+				if ratingCount > 0 {
+					break
+				}
+			}
+			// Select a transition from the previous item to a positive item
+			position := rng[workerId].Intn(ratingCount)
+			posIndex := sequences[userIndex][position]
+			prevIndex := base.NotId
+			if position > 0 {
+				prevIndex = sequences[userIndex][position-1]
+			}
+			// Select a negative sample
+			negIndex := -1
+			for {
+				index := rng[workerId].Intn(trainSet.ItemCount())
+				if _, exist := userFeedback[userIndex][index]; !exist {
+					negIndex = index
+					break
+				}
+			}
+			copy(userFactor[workerId], fpmc.UserFactor[userIndex])
+			copy(positiveItemFactor[workerId], fpmc.ItemFactor[posIndex])
+			copy(negativeItemFactor[workerId], fpmc.ItemFactor[negIndex])
+			diff := floats.Dot(userFactor[workerId], positiveItemFactor[workerId]) -
+				floats.Dot(userFactor[workerId], negativeItemFactor[workerId])
+			if prevIndex != base.NotId {
+				copy(prevFactor[workerId], fpmc.PrevItemFactor[prevIndex])
+				copy(positiveNextFactor[workerId], fpmc.NextItemFactor[posIndex])
+				copy(negativeNextFactor[workerId], fpmc.NextItemFactor[negIndex])
+				diff += floats.Dot(prevFactor[workerId], positiveNextFactor[workerId]) -
+					floats.Dot(prevFactor[workerId], negativeNextFactor[workerId])
+			}
+			grad := math32.Exp(-diff) / (1.0 + math32.Exp(-diff))
+			// Update positive item latent factor: +w_u
+			floats.MulConstTo(userFactor[workerId], grad, temp[workerId])
+			floats.MulConstAddTo(positiveItemFactor[workerId], -fpmc.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.ItemFactor[posIndex])
+			// Update negative item latent factor: -w_u
+			floats.MulConstTo(userFactor[workerId], -grad, temp[workerId])
+			floats.MulConstAddTo(negativeItemFactor[workerId], -fpmc.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.ItemFactor[negIndex])
+			// Update user latent factor: h_i-h_j
+			floats.SubTo(positiveItemFactor[workerId], negativeItemFactor[workerId], temp[workerId])
+			floats.MulConst(temp[workerId], grad)
+			floats.MulConstAddTo(userFactor[workerId], -fpmc.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.UserFactor[userIndex])
+			if prevIndex != base.NotId {
+				// Update positive next item latent factor: +w_l
+				floats.MulConstTo(prevFactor[workerId], grad, temp[workerId])
+				floats.MulConstAddTo(positiveNextFactor[workerId], -fpmc.reg, temp[workerId])
+				floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.NextItemFactor[posIndex])
+				// Update negative next item latent factor: -w_l
+				floats.MulConstTo(prevFactor[workerId], -grad, temp[workerId])
+				floats.MulConstAddTo(negativeNextFactor[workerId], -fpmc.reg, temp[workerId])
+				floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.NextItemFactor[negIndex])
+				// Update previous item latent factor: h_i-h_j
+				floats.SubTo(positiveNextFactor[workerId], negativeNextFactor[workerId], temp[workerId])
+				floats.MulConst(temp[workerId], grad)
+				floats.MulConstAddTo(prevFactor[workerId], -fpmc.reg, temp[workerId])
+				floats.MulConstAddTo(temp[workerId], fpmc.lr, fpmc.PrevItemFactor[prevIndex])
+			}
+			return nil
+		})
+		fitTime := time.Since(fitStart)
+		// Cross validation
+		if epoch%config.Verbose == 0 || epoch == fpmc.nEpochs {
+			evalStart = time.Now()
+			score = EvaluateScore(fpmc, valSet, trainSet, config)
+			evalTime = time.Since(evalStart)
+			base.Logger().Debug(fmt.Sprintf("fit fpmc %v/%v", epoch, fpmc.nEpochs),
+				zap.String("fit_time", fitTime.String()),
+				zap.String("eval_time", evalTime.String()),
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+			snapshots.AddSnapshot(score, fpmc.UserFactor, fpmc.ItemFactor, fpmc.NextItemFactor, fpmc.PrevItemFactor)
+			if snapshots.AddEpoch(epoch, score, config.Patience, config.MinDelta) {
+				base.Logger().Debug("early stop fpmc", zap.Int("epoch", epoch))
+				break
+			}
+			if config.Pruner != nil && config.Pruner.Prune(epoch, score) {
+				base.Logger().Debug("prune fpmc", zap.Int("epoch", epoch))
+				break
+			}
+		}
+	}
+	// restore best snapshot
+	fpmc.UserFactor = snapshots.BestWeights[0].([][]float32)
+	fpmc.ItemFactor = snapshots.BestWeights[1].([][]float32)
+	fpmc.NextItemFactor = snapshots.BestWeights[2].([][]float32)
+	fpmc.PrevItemFactor = snapshots.BestWeights[3].([][]float32)
+	base.Logger().Info("fit fpmc complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	snapshots.BestScore.Curve = snapshots.Curve
+	return snapshots.BestScore
+}
+
+// sortFeedbackByTime returns items of each user sorted by timestamps of feedback. Feedback at the
+// same time or without timestamps (e.g. random splits) is kept in the order of insertion.
+func sortFeedbackByTime(dataSet *DataSet) [][]int {
+	sequences := make([][]int, dataSet.UserCount())
+	times := make([][]time.Time, dataSet.UserCount())
+	for i := range dataSet.FeedbackUsers {
+		userIndex := dataSet.FeedbackUsers[i]
+		sequences[userIndex] = append(sequences[userIndex], dataSet.FeedbackItems[i])
+		var timestamp time.Time
+		if i < len(dataSet.FeedbackTimes) {
+			timestamp = dataSet.FeedbackTimes[i]
+		}
+		times[userIndex] = append(times[userIndex], timestamp)
+	}
+	for userIndex := range sequences {
+		sort.Stable(&timedItems{items: sequences[userIndex], times: times[userIndex]})
+	}
+	return sequences
+}
+
+// timedItems sorts items by timestamps.
+type timedItems struct {
+	items []int
+	times []time.Time
+}
+
+func (t *timedItems) Len() int {
+	return len(t.items)
+}
+
+func (t *timedItems) Less(i, j int) bool {
+	return t.times[i].Before(t.times[j])
+}
+
+func (t *timedItems) Swap(i, j int) {
+	t.items[i], t.items[j] = t.items[j], t.items[i]
+	t.times[i], t.times[j] = t.times[j], t.times[i]
+}
+
+func (fpmc *FPMC) Clear() {
+	fpmc.UserIndex = nil
+	fpmc.ItemIndex = nil
+	fpmc.UserFactor = nil
+	fpmc.ItemFactor = nil
+	fpmc.NextItemFactor = nil
+	fpmc.PrevItemFactor = nil
+	fpmc.LastItems = nil
+}
+
+func (fpmc *FPMC) Init(trainSet *DataSet) {
+	// Initialize parameters
+	newUserFactor := fpmc.GetRandomGenerator().NormalMatrix(trainSet.UserCount(), fpmc.nFactors, fpmc.initMean, fpmc.initStdDev)
+	newItemFactor := fpmc.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), fpmc.nFactors, fpmc.initMean, fpmc.initStdDev)
+	newNextItemFactor := fpmc.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), fpmc.nFactors, fpmc.initMean, fpmc.initStdDev)
+	newPrevItemFactor := fpmc.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), fpmc.nFactors, fpmc.initMean, fpmc.initStdDev)
+	// Relocate parameters
+	if fpmc.UserIndex != nil {
+		for _, userId := range trainSet.UserIndex.GetNames() {
+			oldIndex := fpmc.UserIndex.ToNumber(userId)
+			newIndex := trainSet.UserIndex.ToNumber(userId)
+			if oldIndex != base.NotId {
+				newUserFactor[newIndex] = fpmc.UserFactor[oldIndex]
+			}
+		}
+	}
+	if fpmc.ItemIndex != nil {
+		for _, itemId := range trainSet.ItemIndex.GetNames() {
+			oldIndex := fpmc.ItemIndex.ToNumber(itemId)
+			newIndex := trainSet.ItemIndex.ToNumber(itemId)
+			if oldIndex != base.NotId {
+				newItemFactor[newIndex] = fpmc.ItemFactor[oldIndex]
+				newNextItemFactor[newIndex] = fpmc.NextItemFactor[oldIndex]
+				newPrevItemFactor[newIndex] = fpmc.PrevItemFactor[oldIndex]
+			}
+		}
+	}
+	// Find last items of users
+	fpmc.LastItems = make([]int, trainSet.UserCount())
+	for userIndex, sequence := range sortFeedbackByTime(trainSet) {
+		fpmc.LastItems[userIndex] = base.NotId
+		if len(sequence) > 0 {
+			fpmc.LastItems[userIndex] = sequence[len(sequence)-1]
+		}
+	}
+	// Initialize base
+	fpmc.UserFactor = newUserFactor
+	fpmc.ItemFactor = newItemFactor
+	fpmc.NextItemFactor = newNextItemFactor
+	fpmc.PrevItemFactor = newPrevItemFactor
+	fpmc.BaseMatrixFactorization.Init(trainSet)
+}
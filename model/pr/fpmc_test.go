@@ -0,0 +1,80 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newSequentialDataset creates a dataset that users watch items 0-9 in a cycle from different
+// starting items. Feedback is inserted in reverse order of time.
+func newSequentialDataset() (*DataSet, *DataSet) {
+	dataSet := NewMapIndexDataset()
+	for i := 0; i < 10; i++ {
+		dataSet.AddItem(strconv.Itoa(i))
+	}
+	for u := 0; u < 50; u++ {
+		for k := 5; k >= 0; k-- {
+			itemId := strconv.Itoa((u + k) % 10)
+			dataSet.AddTimedFeedback(strconv.Itoa(u), itemId, time.Unix(int64(k), 0), true)
+		}
+	}
+	return dataSet.SplitLatest(50, 0)
+}
+
+func TestSortFeedbackByTime(t *testing.T) {
+	trainSet, _ := newSequentialDataset()
+	sequences := sortFeedbackByTime(trainSet)
+	userIndex := trainSet.UserIndex.ToNumber("3")
+	var itemIds []string
+	for _, itemIndex := range sequences[userIndex] {
+		itemIds = append(itemIds, trainSet.ItemIndex.ToName(itemIndex))
+	}
+	assert.Equal(t, []string{"3", "4", "5", "6", "7"}, itemIds)
+}
+
+func TestFPMC_Sequential(t *testing.T) {
+	trainSet, testSet := newSequentialDataset()
+	m := NewFPMC(model.Params{model.NEpochs: 100, model.NFactors: 8})
+	score := m.Fit(trainSet, testSet, fitConfig)
+	assert.Greater(t, score.NDCG, float32(0.5))
+
+	// test next item after recent items
+	itemIndex := m.GetItemIndex()
+	recent := []int{itemIndex.ToNumber("2"), itemIndex.ToNumber("9")}
+	next := m.InternalPredictNext(base.NotId, recent, itemIndex.ToNumber("3"))
+	for _, itemId := range []string{"0", "1", "4", "5", "6", "7", "8"} {
+		assert.Greater(t, next, m.InternalPredictNext(base.NotId, recent, itemIndex.ToNumber(itemId)))
+	}
+
+	// test predict
+	assert.Equal(t, m.Predict("1", "1"), m.InternalPredict(1, 1))
+
+	// test encode and decode
+	buf, err := EncodeModel(m)
+	assert.Nil(t, err)
+	decoded, err := DecodeModel("fpmc", buf)
+	assert.Nil(t, err)
+	assert.Equal(t, m.Predict("0", "6"), decoded.(*FPMC).Predict("0", "6"))
+
+	// test clear
+	m.Clear()
+	assert.Nil(t, m.LastItems)
+}
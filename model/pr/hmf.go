@@ -0,0 +1,291 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"fmt"
+	"github.com/chewxy/math32"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/floats"
+	"github.com/zhenghaoz/gorse/model"
+	"go.uber.org/zap"
+	"time"
+)
+
+// HMF is a hybrid matrix factorization model using item labels. The latent factor of an item is
+// the sum of its ID embedding and embeddings of its labels:
+//
+//   q_i = v_i + \sum_{l \in L(i)} w_l
+//
+// so that cold items and long-tail items get meaningful factors from their labels. The model is
+// trained by the BPR loss. Label embeddings are initialized at each fit since label indices are
+// not stable across datasets.
+// Hyper-parameters:
+//   NFactors   - The number of latent factors. Default is 10.
+//   NEpochs    - The number of training epochs. Default is 100.
+//   Lr         - The learning rate of SGD. Default is 0.05.
+//   Reg        - The strength of regularization. Default is 0.01.
+//   InitMean   - The mean of initial latent factors. Default is 0.
+//   InitStdDev - The standard deviation of initial latent factors. Default is 0.001.
+type HMF struct {
+	BaseMatrixFactorization
+	// Model parameters
+	UserFactor  [][]float32 // p_u
+	ItemFactor  [][]float32 // v_i
+	LabelFactor [][]float32 // w_l
+	ItemLabels  [][]int     // L(i)
+	// Hyper parameters
+	nFactors   int
+	nEpochs    int
+	lr         float32
+	reg        float32
+	initMean   float32
+	initStdDev float32
+}
+
+// NewHMF creates a HMF model.
+func NewHMF(params model.Params) *HMF {
+	hmf := new(HMF)
+	hmf.SetParams(params)
+	return hmf
+}
+
+// SetParams sets hyper-parameters of the HMF model.
+func (hmf *HMF) SetParams(params model.Params) {
+	hmf.BaseMatrixFactorization.SetParams(params)
+	hmf.nFactors = hmf.Params.GetInt(model.NFactors, 10)
+	hmf.nEpochs = hmf.Params.GetInt(model.NEpochs, 100)
+	hmf.lr = hmf.Params.GetFloat32(model.Lr, 0.05)
+	hmf.reg = hmf.Params.GetFloat32(model.Reg, 0.01)
+	hmf.initMean = hmf.Params.GetFloat32(model.InitMean, 0)
+	hmf.initStdDev = hmf.Params.GetFloat32(model.InitStdDev, 0.001)
+}
+
+func (hmf *HMF) GetParamsGrid() model.ParamsGrid {
+	return model.ParamsGrid{
+		model.NFactors:   []interface{}{8, 16, 32, 64},
+		model.Lr:         []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.InitMean:   []interface{}{0},
+		model.InitStdDev: []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+	}
+}
+
+// Predict by the HMF model.
+func (hmf *HMF) Predict(userId, itemId string) float32 {
+	userIndex := hmf.UserIndex.ToNumber(userId)
+	itemIndex := hmf.ItemIndex.ToNumber(itemId)
+	if userIndex == base.NotId {
+		base.Logger().Warn("unknown user", zap.String("user_id", userId))
+	}
+	if itemIndex == base.NotId {
+		base.Logger().Warn("unknown item", zap.String("item_id", itemId))
+	}
+	return hmf.InternalPredict(userIndex, itemIndex)
+}
+
+func (hmf *HMF) InternalPredict(userIndex, itemIndex int) float32 {
+	if itemIndex == base.NotId || userIndex == base.NotId {
+		return 0
+	}
+	return floats.Dot(hmf.UserFactor[userIndex], hmf.GetItemFactor(itemIndex))
+}
+
+// GetUserFactor returns the latent factor of a user.
+func (hmf *HMF) GetUserFactor(userIndex int) []float32 {
+	return hmf.UserFactor[userIndex]
+}
+
+// GetItemFactor returns the latent factor of a item, which is the sum of the ID embedding and
+// label embeddings.
+func (hmf *HMF) GetItemFactor(itemIndex int) []float32 {
+	itemFactor := make([]float32, len(hmf.ItemFactor[itemIndex]))
+	hmf.itemFactorTo(itemIndex, itemFactor)
+	return itemFactor
+}
+
+// itemFactorTo writes the latent factor of a item to dst.
+func (hmf *HMF) itemFactorTo(itemIndex int, dst []float32) {
+	copy(dst, hmf.ItemFactor[itemIndex])
+	if itemIndex < len(hmf.ItemLabels) {
+		for _, labelIndex := range hmf.ItemLabels[itemIndex] {
+			floats.Add(dst, hmf.LabelFactor[labelIndex])
+		}
+	}
+}
+
+// Fit the HMF model.
+func (hmf *HMF) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score {
+	config = config.LoadDefaultIfNil()
+	base.Logger().Info("fit hmf",
+		zap.Any("params", hmf.GetParams()),
+		zap.Any("config", config))
+	hmf.Init(trainSet)
+	// Create buffers
+	temp := base.NewMatrix32(config.Jobs, hmf.nFactors)
+	userFactor := base.NewMatrix32(config.Jobs, hmf.nFactors)
+	positiveItemFactor := base.NewMatrix32(config.Jobs, hmf.nFactors)
+	negativeItemFactor := base.NewMatrix32(config.Jobs, hmf.nFactors)
+	rng := make([]base.RandomGenerator, config.Jobs)
+	for i := 0; i < config.Jobs; i++ {
+		rng[i] = base.NewRandomGenerator(hmf.GetRandomGenerator().Int63())
+	}
+	// Convert array to hashmap
+	userFeedback := make([]map[int]interface{}, trainSet.UserCount())
+	for u := range userFeedback {
+		userFeedback[u] = make(map[int]interface{})
+		for _, i := range trainSet.UserFeedback[u] {
+			userFeedback[u][i] = nil
+		}
+	}
+	snapshots := SnapshotManger{}
+	evalStart := time.Now()
+	score := EvaluateScore(hmf, valSet, trainSet, config)
+	evalTime := time.Since(evalStart)
+	base.Logger().Debug(fmt.Sprintf("fit hmf %v/%v", 0, hmf.nEpochs),
+		zap.String("eval_time", evalTime.String()),
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+	snapshots.AddSnapshot(score, hmf.UserFactor, hmf.ItemFactor, hmf.LabelFactor)
+	snapshots.AddEpoch(0, score, config.Patience, config.MinDelta)
+	// Training
+	for epoch := 1; epoch <= hmf.nEpochs; epoch++ {
+		fitStart := time.Now()
+		_ = base.Parallel(trainSet.Count(), config.Jobs, func(workerId, _ int) error {
+			// Select a user
+			var userIndex, ratingCount int
+			for {
+				userIndex = rng[workerId].Intn(trainSet.UserCount())
+				ratingCount = len(trainSet.UserFeedback[userIndex])
+				if ratingCount > 0 {
+					break
+				}
+			}
+			posIndex := trainSet.UserFeedback[userIndex][rng[workerId].Intn(ratingCount)]
+			// Select a negative sample
+			negIndex := -1
+			for {
+				index := rng[workerId].Intn(trainSet.ItemCount())
+				if _, exist := userFeedback[userIndex][index]; !exist {
+					negIndex = index
+					break
+				}
+			}
+			copy(userFactor[workerId], hmf.UserFactor[userIndex])
+			hmf.itemFactorTo(posIndex, positiveItemFactor[workerId])
+			hmf.itemFactorTo(negIndex, negativeItemFactor[workerId])
+			diff := floats.Dot(userFactor[workerId], positiveItemFactor[workerId]) -
+				floats.Dot(userFactor[workerId], negativeItemFactor[workerId])
+			grad := math32.Exp(-diff) / (1.0 + math32.Exp(-diff))
+			// Update embeddings of the positive item: +w_u
+			floats.MulConstTo(userFactor[workerId], grad, temp[workerId])
+			hmf.updateItem(posIndex, temp[workerId])
+			// Update embeddings of the negative item: -w_u
+			floats.MulConstTo(userFactor[workerId], -grad, temp[workerId])
+			hmf.updateItem(negIndex, temp[workerId])
+			// Update user latent factor: h_i-h_j
+			floats.SubTo(positiveItemFactor[workerId], negativeItemFactor[workerId], temp[workerId])
+			floats.MulConst(temp[workerId], grad)
+			floats.MulConstAddTo(userFactor[workerId], -hmf.reg, temp[workerId])
+			floats.MulConstAddTo(temp[workerId], hmf.lr, hmf.UserFactor[userIndex])
+			return nil
+		})
+		fitTime := time.Since(fitStart)
+		// Cross validation
+		if epoch%config.Verbose == 0 || epoch == hmf.nEpochs {
+			evalStart = time.Now()
+			score = EvaluateScore(hmf, valSet, trainSet, config)
+			evalTime = time.Since(evalStart)
+			base.Logger().Debug(fmt.Sprintf("fit hmf %v/%v", epoch, hmf.nEpochs),
+				zap.String("fit_time", fitTime.String()),
+				zap.String("eval_time", evalTime.String()),
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+			snapshots.AddSnapshot(score, hmf.UserFactor, hmf.ItemFactor, hmf.LabelFactor)
+			if snapshots.AddEpoch(epoch, score, config.Patience, config.MinDelta) {
+				base.Logger().Debug("early stop hmf", zap.Int("epoch", epoch))
+				break
+			}
+			if config.Pruner != nil && config.Pruner.Prune(epoch, score) {
+				base.Logger().Debug("prune hmf", zap.Int("epoch", epoch))
+				break
+			}
+		}
+	}
+	// restore best snapshot
+	hmf.UserFactor = snapshots.BestWeights[0].([][]float32)
+	hmf.ItemFactor = snapshots.BestWeights[1].([][]float32)
+	hmf.LabelFactor = snapshots.BestWeights[2].([][]float32)
+	base.Logger().Info("fit hmf complete",
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	snapshots.BestScore.Curve = snapshots.Curve
+	return snapshots.BestScore
+}
+
+// updateItem updates the ID embedding and label embeddings of a item by a gradient.
+func (hmf *HMF) updateItem(itemIndex int, grad []float32) {
+	floats.MulConstAddTo(hmf.ItemFactor[itemIndex], -hmf.reg*hmf.lr, hmf.ItemFactor[itemIndex])
+	floats.MulConstAddTo(grad, hmf.lr, hmf.ItemFactor[itemIndex])
+	if itemIndex < len(hmf.ItemLabels) {
+		for _, labelIndex := range hmf.ItemLabels[itemIndex] {
+			floats.MulConstAddTo(hmf.LabelFactor[labelIndex], -hmf.reg*hmf.lr, hmf.LabelFactor[labelIndex])
+			floats.MulConstAddTo(grad, hmf.lr, hmf.LabelFactor[labelIndex])
+		}
+	}
+}
+
+func (hmf *HMF) Clear() {
+	hmf.UserIndex = nil
+	hmf.ItemIndex = nil
+	hmf.UserFactor = nil
+	hmf.ItemFactor = nil
+	hmf.LabelFactor = nil
+	hmf.ItemLabels = nil
+}
+
+func (hmf *HMF) Init(trainSet *DataSet) {
+	// Initialize parameters
+	newUserFactor := hmf.GetRandomGenerator().NormalMatrix(trainSet.UserCount(), hmf.nFactors, hmf.initMean, hmf.initStdDev)
+	newItemFactor := hmf.GetRandomGenerator().NormalMatrix(trainSet.ItemCount(), hmf.nFactors, hmf.initMean, hmf.initStdDev)
+	// Relocate parameters
+	if hmf.UserIndex != nil {
+		for _, userId := range trainSet.UserIndex.GetNames() {
+			oldIndex := hmf.UserIndex.ToNumber(userId)
+			newIndex := trainSet.UserIndex.ToNumber(userId)
+			if oldIndex != base.NotId {
+				newUserFactor[newIndex] = hmf.UserFactor[oldIndex]
+			}
+		}
+	}
+	if hmf.ItemIndex != nil {
+		for _, itemId := range trainSet.ItemIndex.GetNames() {
+			oldIndex := hmf.ItemIndex.ToNumber(itemId)
+			newIndex := trainSet.ItemIndex.ToNumber(itemId)
+			if oldIndex != base.NotId {
+				newItemFactor[newIndex] = hmf.ItemFactor[oldIndex]
+			}
+		}
+	}
+	// Initialize base
+	hmf.UserFactor = newUserFactor
+	hmf.ItemFactor = newItemFactor
+	hmf.LabelFactor = hmf.GetRandomGenerator().NormalMatrix(trainSet.NumItemLabels, hmf.nFactors, hmf.initMean, hmf.initStdDev)
+	hmf.ItemLabels = trainSet.ItemLabels
+	hmf.BaseMatrixFactorization.Init(trainSet)
+}
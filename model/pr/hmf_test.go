@@ -0,0 +1,72 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/floats"
+	"github.com/zhenghaoz/gorse/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newLabeledDataset creates a dataset that even users like items 0-4 labeled by "a" and odd users
+// like items 5-9 labeled by "b". Item 10 labeled by "a" and item 11 labeled by "b" are cold.
+func newLabeledDataset() (*DataSet, *DataSet) {
+	dataSet := NewMapIndexDataset()
+	for i := 0; i < 12; i++ {
+		dataSet.AddItem(strconv.Itoa(i))
+		dataSet.ItemLabels = append(dataSet.ItemLabels, []int{i % 10 / 5})
+	}
+	dataSet.ItemLabels[11] = []int{1}
+	dataSet.NumItemLabels = 2
+	for u := 0; u < 20; u++ {
+		for i := 0; i < 5; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(u), strconv.Itoa(i+u%2*5), time.Unix(int64(i), 0), true)
+		}
+	}
+	return dataSet.SplitLatest(20, 0)
+}
+
+func TestHMF_ColdItems(t *testing.T) {
+	trainSet, testSet := newLabeledDataset()
+	m := NewHMF(model.Params{model.NEpochs: 100, model.NFactors: 4})
+	score := m.Fit(trainSet, testSet, fitConfig)
+	assert.Greater(t, score.NDCG, float32(0))
+	// cold items are scored by labels
+	assert.Greater(t, m.Predict("0", "10"), m.Predict("0", "11"))
+	assert.Greater(t, m.Predict("1", "11"), m.Predict("1", "10"))
+
+	// test predict
+	assert.Equal(t, m.Predict("1", "1"), m.InternalPredict(1, 1))
+
+	// test item factor
+	itemFactor := make([]float32, 4)
+	copy(itemFactor, m.ItemFactor[10])
+	floats.Add(itemFactor, m.LabelFactor[0])
+	assert.Equal(t, itemFactor, m.GetItemFactor(10))
+
+	// test encode and decode
+	buf, err := EncodeModel(m)
+	assert.Nil(t, err)
+	decoded, err := DecodeModel("hmf", buf)
+	assert.Nil(t, err)
+	assert.Equal(t, m.Predict("0", "10"), decoded.(*HMF).Predict("0", "10"))
+
+	// test clear
+	m.Clear()
+	assert.Nil(t, m.LabelFactor)
+}
@@ -132,15 +132,15 @@ func (knn *KNN) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 	})
 	fitTime := time.Since(fitStart)
 	evalStart := time.Now()
-	scores := Evaluate(knn, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	score := EvaluateScore(knn, valSet, trainSet, config)
 	evalTime := time.Since(evalStart)
 	base.Logger().Info("fit knn complete",
-		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]),
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall),
 		zap.String("fit_time", fitTime.String()),
 		zap.String("eval_time", evalTime.String()))
-	return Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}
+	return score
 }
 
 func dot(a, b []int) float32 {
@@ -34,6 +34,48 @@ type Score struct {
 	NDCG      float32
 	Precision float32
 	Recall    float32
+	// beyond-accuracy metrics
+	Coverage  float32
+	Diversity float32
+	Novelty   float32
+	Gini      float32
+	// learning curve
+	Curve []EpochScore
+}
+
+// EpochScore is the score at an epoch during training.
+type EpochScore struct {
+	Epoch     int
+	NDCG      float32
+	Precision float32
+	Recall    float32
+}
+
+// Objective is the weighted sum of metrics maximized by model search. Weights of metrics
+// should be negative if lower values are better (e.g. Gini). If no weight is set, NDCG is
+// the objective.
+type Objective struct {
+	NDCG      float32
+	Precision float32
+	Recall    float32
+	Coverage  float32
+	Diversity float32
+	Novelty   float32
+	Gini      float32
+}
+
+// Of returns the objective value of a score.
+func (objective Objective) Of(score Score) float32 {
+	if objective == (Objective{}) {
+		return score.NDCG
+	}
+	return objective.NDCG*score.NDCG +
+		objective.Precision*score.Precision +
+		objective.Recall*score.Recall +
+		objective.Coverage*score.Coverage +
+		objective.Diversity*score.Diversity +
+		objective.Novelty*score.Novelty +
+		objective.Gini*score.Gini
 }
 
 type FitConfig struct {
@@ -41,6 +83,16 @@ type FitConfig struct {
 	Verbose    int
 	Candidates int
 	TopK       int
+	Objective  Objective // objective of hyper-parameters search
+	Pruner     Pruner    // pruner to stop unpromising trials of hyper-parameters search
+	Patience   int       // number of evaluations without improvement before early stopping (0 means never)
+	MinDelta   float32   // minimum increase of NDCG counted as improvement
+}
+
+// Pruner stops unpromising trials of hyper-parameters search early.
+type Pruner interface {
+	// Prune reports the score of a trial at an epoch and returns true if the trial should stop.
+	Prune(epoch int, score Score) bool
 }
 
 func (config *FitConfig) LoadDefaultIfNil() *FitConfig {
@@ -73,6 +125,34 @@ type MatrixFactorization interface {
 	GetUserIndex() base.Index
 }
 
+// Embedding is a matrix factorization model with latent factors of users and items.
+type Embedding interface {
+	MatrixFactorization
+	// GetUserFactor returns the latent factor of a user by its index.
+	GetUserFactor(userIndex int) []float32
+	// GetItemFactor returns the latent factor of a item by its index.
+	GetItemFactor(itemIndex int) []float32
+}
+
+// FoldIn is a matrix factorization model which estimates latent factors of new users from their
+// feedback without retraining.
+type FoldIn interface {
+	MatrixFactorization
+	// FoldIn returns the latent factor of a user given indices of items in feedback, or nil if
+	// it can't be estimated.
+	FoldIn(itemIndices []int) []float32
+	// PredictByFactor predicts the rating given by a user factor to a item by its index.
+	PredictByFactor(userFactor []float32, itemIndex int) float32
+}
+
+// Sequential is a matrix factorization model which predicts next items given recent items.
+type Sequential interface {
+	MatrixFactorization
+	// InternalPredictNext predicts the rating given by a user to a item after recent items,
+	// which are sorted from the most recent. The user index could be NotId for unknown users.
+	InternalPredictNext(userIndex int, recentItems []int, itemIndex int) float32
+}
+
 type BaseMatrixFactorization struct {
 	model.BaseModel
 	UserIndex base.Index
@@ -112,6 +192,10 @@ func NewModel(name string, params model.Params) (Model, error) {
 		return NewBPR(params), nil
 	case "ccd":
 		return NewCCD(params), nil
+	case "fpmc":
+		return NewFPMC(params), nil
+	case "hmf":
+		return NewHMF(params), nil
 	case "knn":
 		return NewKNN(params), nil
 	}
@@ -151,24 +235,42 @@ func DecodeModel(name string, buf []byte) (Model, error) {
 		if err := decoder.Decode(&als); err != nil {
 			return nil, err
 		}
+		als.SetParams(als.GetParams())
 		return &als, nil
 	case "bpr":
 		var bpr BPR
 		if err := decoder.Decode(&bpr); err != nil {
 			return nil, err
 		}
+		bpr.SetParams(bpr.GetParams())
 		return &bpr, nil
 	case "ccd":
 		var ccd CCD
 		if err := decoder.Decode(&ccd); err != nil {
 			return nil, err
 		}
+		ccd.SetParams(ccd.GetParams())
 		return &ccd, nil
+	case "fpmc":
+		var fpmc FPMC
+		if err := decoder.Decode(&fpmc); err != nil {
+			return nil, err
+		}
+		fpmc.SetParams(fpmc.GetParams())
+		return &fpmc, nil
+	case "hmf":
+		var hmf HMF
+		if err := decoder.Decode(&hmf); err != nil {
+			return nil, err
+		}
+		hmf.SetParams(hmf.GetParams())
+		return &hmf, nil
 	case "knn":
 		var knn KNN
 		if err := decoder.Decode(&knn); err != nil {
 			return nil, err
 		}
+		knn.SetParams(knn.GetParams())
 		return &knn, nil
 	}
 	return nil, fmt.Errorf("unknown model %v", name)
@@ -224,10 +326,10 @@ func (bpr *BPR) SetParams(params model.Params) {
 func (bpr *BPR) GetParamsGrid() model.ParamsGrid {
 	return model.ParamsGrid{
 		model.NFactors:   []interface{}{8, 16, 32, 64},
-		model.Lr:         []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
-		model.Reg:        []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.Lr:         []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
 		model.InitMean:   []interface{}{0},
-		model.InitStdDev: []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.InitStdDev: []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
 	}
 }
 
@@ -282,14 +384,15 @@ func (bpr *BPR) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 	}
 	snapshots := SnapshotManger{}
 	evalStart := time.Now()
-	scores := Evaluate(bpr, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	score := EvaluateScore(bpr, valSet, trainSet, config)
 	evalTime := time.Since(evalStart)
 	base.Logger().Debug(fmt.Sprintf("fit bpr %v/%v", 0, bpr.nEpochs),
 		zap.String("eval_time", evalTime.String()),
-		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-	snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, bpr.UserFactor, bpr.ItemFactor)
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+	snapshots.AddSnapshot(score, bpr.UserFactor, bpr.ItemFactor)
+	snapshots.AddEpoch(0, score, config.Patience, config.MinDelta)
 	// Training
 	for epoch := 1; epoch <= bpr.nEpochs; epoch++ {
 		fitStart := time.Now()
@@ -341,15 +444,23 @@ func (bpr *BPR) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		// Cross validation
 		if epoch%config.Verbose == 0 || epoch == bpr.nEpochs {
 			evalStart = time.Now()
-			scores = Evaluate(bpr, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+			score = EvaluateScore(bpr, valSet, trainSet, config)
 			evalTime = time.Since(evalStart)
 			base.Logger().Debug(fmt.Sprintf("fit bpr %v/%v", epoch, bpr.nEpochs),
 				zap.String("fit_time", fitTime.String()),
 				zap.String("eval_time", evalTime.String()),
-				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-			snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, bpr.UserFactor, bpr.ItemFactor)
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+			snapshots.AddSnapshot(score, bpr.UserFactor, bpr.ItemFactor)
+			if snapshots.AddEpoch(epoch, score, config.Patience, config.MinDelta) {
+				base.Logger().Debug("early stop bpr", zap.Int("epoch", epoch))
+				break
+			}
+			if config.Pruner != nil && config.Pruner.Prune(epoch, score) {
+				base.Logger().Debug("prune bpr", zap.Int("epoch", epoch))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -359,6 +470,7 @@ func (bpr *BPR) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
 		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	snapshots.BestScore.Curve = snapshots.Curve
 	return snapshots.BestScore
 }
 
@@ -398,6 +510,61 @@ func (bpr *BPR) Init(trainSet *DataSet) {
 	bpr.BaseMatrixFactorization.Init(trainSet)
 }
 
+// GetUserFactor returns the latent factor of a user.
+func (bpr *BPR) GetUserFactor(userIndex int) []float32 {
+	return bpr.UserFactor[userIndex]
+}
+
+// GetItemFactor returns the latent factor of a item.
+func (bpr *BPR) GetItemFactor(itemIndex int) []float32 {
+	return bpr.ItemFactor[itemIndex]
+}
+
+// FoldIn estimates the latent factor of a new user from items in feedback by SGD steps with
+// item factors fixed. Each epoch samples as many triples as the feedback.
+func (bpr *BPR) FoldIn(itemIndices []int) []float32 {
+	if len(itemIndices) == 0 || bpr.ItemFactor == nil {
+		return nil
+	}
+	rng := base.NewRandomGenerator(bpr.Params.GetInt64(model.RandomState, 0))
+	userFactor := rng.NewNormalVector(bpr.nFactors, bpr.initMean, bpr.initStdDev)
+	positiveSet := make(map[int]interface{}, len(itemIndices))
+	for _, itemIndex := range itemIndices {
+		positiveSet[itemIndex] = nil
+	}
+	if len(positiveSet) == len(bpr.ItemFactor) {
+		return userFactor
+	}
+	temp := make([]float32, bpr.nFactors)
+	for epoch := 0; epoch < bpr.nEpochs; epoch++ {
+		for range itemIndices {
+			posIndex := itemIndices[rng.Intn(len(itemIndices))]
+			// Select a negative sample
+			negIndex := -1
+			for {
+				index := rng.Intn(len(bpr.ItemFactor))
+				if _, exist := positiveSet[index]; !exist {
+					negIndex = index
+					break
+				}
+			}
+			diff := bpr.PredictByFactor(userFactor, posIndex) - bpr.PredictByFactor(userFactor, negIndex)
+			grad := math32.Exp(-diff) / (1.0 + math32.Exp(-diff))
+			// Update user latent factor: h_i-h_j
+			floats.SubTo(bpr.ItemFactor[posIndex], bpr.ItemFactor[negIndex], temp)
+			floats.MulConst(temp, grad)
+			floats.MulConstAddTo(userFactor, -bpr.reg, temp)
+			floats.MulConstAddTo(temp, bpr.lr, userFactor)
+		}
+	}
+	return userFactor
+}
+
+// PredictByFactor predicts the rating given by a user factor to a item.
+func (bpr *BPR) PredictByFactor(userFactor []float32, itemIndex int) float32 {
+	return floats.Dot(userFactor, bpr.ItemFactor[itemIndex])
+}
+
 // ALS [7] is the Weighted Regularized Matrix Factorization, which exploits
 // unique properties of implicit feedback datasets. It treats the data as
 // indication of positive and negative preference associated with vastly
@@ -446,9 +613,9 @@ func (als *ALS) GetParamsGrid() model.ParamsGrid {
 	return model.ParamsGrid{
 		model.NFactors:   []interface{}{8, 16, 32, 64},
 		model.InitMean:   []interface{}{0},
-		model.InitStdDev: []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
-		model.Reg:        []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
-		model.Alpha:      []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.InitStdDev: []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Alpha:      []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
 	}
 }
 
@@ -472,6 +639,63 @@ func (als *ALS) InternalPredict(userIndex, itemIndex int) float32 {
 		als.ItemFactor.RowView(itemIndex)))
 }
 
+// GetUserFactor returns the latent factor of a user.
+func (als *ALS) GetUserFactor(userIndex int) []float32 {
+	return toFloat32(als.UserFactor.RawRowView(userIndex))
+}
+
+// GetItemFactor returns the latent factor of a item.
+func (als *ALS) GetItemFactor(itemIndex int) []float32 {
+	return toFloat32(als.ItemFactor.RawRowView(itemIndex))
+}
+
+// FoldIn estimates the latent factor of a new user from items in feedback by the closed-form
+// least-squares solution with item factors fixed, which is the same as the user update in Fit.
+func (als *ALS) FoldIn(itemIndices []int) []float32 {
+	if len(itemIndices) == 0 || als.ItemFactor == nil {
+		return nil
+	}
+	// (Y^T C^u Y + \lambda reg) x_u = Y^T C^u p(u)
+	a := mat.NewDense(als.nFactors, als.nFactors, nil)
+	a.Mul(als.ItemFactor.T(), als.ItemFactor)
+	a.Scale(als.weight, a)
+	temp1 := mat.NewDense(als.nFactors, als.nFactors, nil)
+	temp2 := mat.NewVecDense(als.nFactors, nil)
+	b := mat.NewVecDense(als.nFactors, nil)
+	for _, itemIndex := range itemIndices {
+		temp1.Outer(1, als.ItemFactor.RowView(itemIndex), als.ItemFactor.RowView(itemIndex))
+		a.Add(a, temp1)
+		temp2.ScaleVec(1+als.weight, als.ItemFactor.RowView(itemIndex))
+		b.AddVec(b, temp2)
+	}
+	for i := 0; i < als.nFactors; i++ {
+		a.Set(i, i, a.At(i, i)+als.reg)
+	}
+	if err := temp2.SolveVec(a, b); err != nil {
+		base.Logger().Error("failed to solve user factor", zap.Error(err))
+		return nil
+	}
+	return toFloat32(temp2.RawVector().Data)
+}
+
+// PredictByFactor predicts the rating given by a user factor to a item.
+func (als *ALS) PredictByFactor(userFactor []float32, itemIndex int) float32 {
+	itemFactor := als.ItemFactor.RawRowView(itemIndex)
+	sum := 0.0
+	for i := range itemFactor {
+		sum += float64(userFactor[i]) * itemFactor[i]
+	}
+	return float32(sum)
+}
+
+func toFloat32(a []float64) []float32 {
+	b := make([]float32, len(a))
+	for i := range a {
+		b[i] = float32(a[i])
+	}
+	return b
+}
+
 // Fit the ALS model.
 func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score {
 	config = config.LoadDefaultIfNil()
@@ -497,18 +721,19 @@ func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 	regI := mat.NewDiagDense(als.nFactors, regs)
 	snapshots := SnapshotManger{}
 	evalStart := time.Now()
-	scores := Evaluate(als, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	score := EvaluateScore(als, valSet, trainSet, config)
 	evalTime := time.Since(evalStart)
 	base.Logger().Debug(fmt.Sprintf("fit als %v/%v", 0, als.nEpochs),
 		zap.String("eval_time", evalTime.String()),
-		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
 	userFactorCopy := mat.NewDense(trainSet.UserCount(), als.nFactors, nil)
 	itemFactorCopy := mat.NewDense(trainSet.ItemCount(), als.nFactors, nil)
 	userFactorCopy.Copy(als.UserFactor)
 	itemFactorCopy.Copy(als.ItemFactor)
-	snapshots.AddSnapshotNoCopy(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, userFactorCopy, itemFactorCopy)
+	snapshots.AddSnapshotNoCopy(score, userFactorCopy, itemFactorCopy)
+	snapshots.AddEpoch(0, score, config.Patience, config.MinDelta)
 	for ep := 1; ep <= als.nEpochs; ep++ {
 		fitStart := time.Now()
 		// Recompute all user factors: x_u = (Y^T C^userIndex Y + \lambda reg)^{-1} Y^T C^userIndex p(userIndex)
@@ -563,19 +788,27 @@ func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		// Cross validation
 		if ep%config.Verbose == 0 || ep == als.nEpochs {
 			evalStart = time.Now()
-			scores = Evaluate(als, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+			score = EvaluateScore(als, valSet, trainSet, config)
 			evalTime = time.Since(evalStart)
 			base.Logger().Debug(fmt.Sprintf("fit als %v/%v", ep, als.nEpochs),
 				zap.String("fit_time", fitTime.String()),
 				zap.String("eval_time", evalTime.String()),
-				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
 			userFactorCopy = mat.NewDense(trainSet.UserCount(), als.nFactors, nil)
 			itemFactorCopy = mat.NewDense(trainSet.ItemCount(), als.nFactors, nil)
 			userFactorCopy.Copy(als.UserFactor)
 			itemFactorCopy.Copy(als.ItemFactor)
-			snapshots.AddSnapshotNoCopy(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, userFactorCopy, itemFactorCopy)
+			snapshots.AddSnapshotNoCopy(score, userFactorCopy, itemFactorCopy)
+			if snapshots.AddEpoch(ep, score, config.Patience, config.MinDelta) {
+				base.Logger().Debug("early stop als", zap.Int("epoch", ep))
+				break
+			}
+			if config.Pruner != nil && config.Pruner.Prune(ep, score) {
+				base.Logger().Debug("prune als", zap.Int("epoch", ep))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -585,6 +818,7 @@ func (als *ALS) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
 		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	snapshots.BestScore.Curve = snapshots.Curve
 	return snapshots.BestScore
 }
 
@@ -662,9 +896,9 @@ func (ccd *CCD) GetParamsGrid() model.ParamsGrid {
 	return model.ParamsGrid{
 		model.NFactors:   []interface{}{8, 16, 32, 64},
 		model.InitMean:   []interface{}{0},
-		model.InitStdDev: []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
-		model.Reg:        []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
-		model.Alpha:      []interface{}{0.001, 0.005, 0.01, 0.05, 0.1},
+		model.InitStdDev: []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+		model.Alpha:      []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
 	}
 }
 
@@ -687,6 +921,16 @@ func (ccd *CCD) InternalPredict(userIndex, itemIndex int) float32 {
 	return floats.Dot(ccd.UserFactor[userIndex], ccd.ItemFactor[itemIndex])
 }
 
+// GetUserFactor returns the latent factor of a user.
+func (ccd *CCD) GetUserFactor(userIndex int) []float32 {
+	return ccd.UserFactor[userIndex]
+}
+
+// GetItemFactor returns the latent factor of a item.
+func (ccd *CCD) GetItemFactor(itemIndex int) []float32 {
+	return ccd.ItemFactor[itemIndex]
+}
+
 func (ccd *CCD) Clear() {
 	ccd.UserIndex = nil
 	ccd.ItemIndex = nil
@@ -744,14 +988,15 @@ func (ccd *CCD) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 	// evaluate initial model
 	snapshots := SnapshotManger{}
 	evalStart := time.Now()
-	scores := Evaluate(ccd, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+	score := EvaluateScore(ccd, valSet, trainSet, config)
 	evalTime := time.Since(evalStart)
 	base.Logger().Debug(fmt.Sprintf("fit ccd %v/%v", 0, ccd.nEpochs),
 		zap.String("eval_time", evalTime.String()),
-		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-	snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, ccd.UserFactor, ccd.ItemFactor)
+		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+	snapshots.AddSnapshot(score, ccd.UserFactor, ccd.ItemFactor)
+	snapshots.AddEpoch(0, score, config.Patience, config.MinDelta)
 	for ep := 1; ep <= ccd.nEpochs; ep++ {
 		fitStart := time.Now()
 		// Update user factors
@@ -836,15 +1081,23 @@ func (ccd *CCD) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		// Cross validation
 		if ep%config.Verbose == 0 || ep == ccd.nEpochs {
 			evalStart = time.Now()
-			scores = Evaluate(ccd, valSet, trainSet, config.TopK, config.Candidates, config.Jobs, NDCG, Precision, Recall)
+			score = EvaluateScore(ccd, valSet, trainSet, config)
 			evalTime = time.Since(evalStart)
 			base.Logger().Debug(fmt.Sprintf("fit ccd %v/%v", ep, ccd.nEpochs),
 				zap.String("fit_time", fitTime.String()),
 				zap.String("eval_time", evalTime.String()),
-				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), scores[0]),
-				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), scores[1]),
-				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), scores[2]))
-			snapshots.AddSnapshot(Score{NDCG: scores[0], Precision: scores[1], Recall: scores[2]}, ccd.UserFactor, ccd.ItemFactor)
+				zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), score.NDCG),
+				zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), score.Precision),
+				zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), score.Recall))
+			snapshots.AddSnapshot(score, ccd.UserFactor, ccd.ItemFactor)
+			if snapshots.AddEpoch(ep, score, config.Patience, config.MinDelta) {
+				base.Logger().Debug("early stop ccd", zap.Int("epoch", ep))
+				break
+			}
+			if config.Pruner != nil && config.Pruner.Prune(ep, score) {
+				base.Logger().Debug("prune ccd", zap.Int("epoch", ep))
+				break
+			}
 		}
 	}
 	// restore best snapshot
@@ -854,5 +1107,6 @@ func (ccd *CCD) Fit(trainSet *DataSet, valSet *DataSet, config *FitConfig) Score
 		zap.Float32(fmt.Sprintf("NDCG@%v", config.TopK), snapshots.BestScore.NDCG),
 		zap.Float32(fmt.Sprintf("Precision@%v", config.TopK), snapshots.BestScore.Precision),
 		zap.Float32(fmt.Sprintf("Recall@%v", config.TopK), snapshots.BestScore.Recall))
+	snapshots.BestScore.Curve = snapshots.Curve
 	return snapshots.BestScore
 }
@@ -18,7 +18,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/zhenghaoz/gorse/model"
 	"runtime"
+	"strconv"
 	"testing"
+	"time"
 )
 
 const (
@@ -164,3 +166,61 @@ func TestCCD_MovieLens(t *testing.T) {
 //	score := m.Fit(trainSet, testSet, fitConfig)
 //	assertEpsilon(t, 0.52, score.NDCG, benchEpsilon)
 //}
+
+// newClusteredDataset creates a dataset that even users like items 0-4 and odd users like items 5-9.
+// The latest feedback of each user is held out for validation.
+func newClusteredDataset() (*DataSet, *DataSet) {
+	dataSet := NewMapIndexDataset()
+	for u := 0; u < 20; u++ {
+		for i := 0; i < 5; i++ {
+			dataSet.AddTimedFeedback(strconv.Itoa(u), strconv.Itoa(i+u%2*5), time.Unix(int64(i), 0), true)
+		}
+	}
+	return dataSet.SplitLatest(20, 0)
+}
+
+func testFoldIn(t *testing.T, m FoldIn) {
+	trainSet, testSet := newClusteredDataset()
+	m.Fit(trainSet, testSet, fitConfig)
+	// a new user likes items in the first cluster
+	itemIndex := m.GetItemIndex()
+	userFactor := m.FoldIn([]int{itemIndex.ToNumber("0"), itemIndex.ToNumber("1")})
+	assert.NotNil(t, userFactor)
+	for _, liked := range []string{"2", "3"} {
+		for _, other := range []string{"5", "6", "7", "8"} {
+			assert.Greater(t,
+				m.PredictByFactor(userFactor, itemIndex.ToNumber(liked)),
+				m.PredictByFactor(userFactor, itemIndex.ToNumber(other)))
+		}
+	}
+	// no feedback
+	assert.Nil(t, m.FoldIn(nil))
+}
+
+// testDecodeFoldIn checks that a decoded model folds in new users as the original model.
+func testDecodeFoldIn(t *testing.T, name string, m FoldIn) {
+	trainSet, testSet := newClusteredDataset()
+	m.Fit(trainSet, testSet, fitConfig)
+	buf, err := EncodeModel(m)
+	assert.NoError(t, err)
+	decoded, err := DecodeModel(name, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, m.GetParams(), decoded.GetParams())
+	itemIndex := m.GetItemIndex()
+	itemIndices := []int{itemIndex.ToNumber("0"), itemIndex.ToNumber("1")}
+	userFactor := decoded.(FoldIn).FoldIn(itemIndices)
+	assert.Equal(t, m.FoldIn(itemIndices), userFactor)
+	for i := 0; i < itemIndex.Len(); i++ {
+		assert.Equal(t, m.PredictByFactor(userFactor, i), decoded.(FoldIn).PredictByFactor(userFactor, i))
+	}
+}
+
+func TestBPR_FoldIn(t *testing.T) {
+	testFoldIn(t, NewBPR(model.Params{model.NEpochs: 100}))
+	testDecodeFoldIn(t, "bpr", NewBPR(model.Params{model.NEpochs: 100}))
+}
+
+func TestALS_FoldIn(t *testing.T) {
+	testFoldIn(t, NewALS(model.Params{model.NEpochs: 10}))
+	testDecodeFoldIn(t, "als", NewALS(model.Params{model.NEpochs: 10}))
+}
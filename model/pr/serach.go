@@ -30,6 +30,8 @@ type ParamsSearchResult struct {
 	BestIndex  int
 	Scores     []Score
 	Params     []model.Params
+	FitTimes   []time.Duration
+	Objective  Objective // objective to select the best score
 }
 
 func NewParamsSearchResult() *ParamsSearchResult {
@@ -42,7 +44,7 @@ func NewParamsSearchResult() *ParamsSearchResult {
 func (r *ParamsSearchResult) AddScore(params model.Params, score Score) {
 	r.Scores = append(r.Scores, score)
 	r.Params = append(r.Params, params.Copy())
-	if len(r.Scores) == 0 || score.NDCG > r.BestScore.NDCG {
+	if len(r.Scores) == 1 || r.Objective.Of(score) > r.Objective.Of(r.BestScore) {
 		r.BestScore = score
 		r.BestParams = params.Copy()
 		r.BestIndex = len(r.Params) - 1
@@ -52,6 +54,7 @@ func (r *ParamsSearchResult) AddScore(params model.Params, score Score) {
 // GridSearchCV finds the best parameters for a model.
 func GridSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGrid model.ParamsGrid,
 	seed int64, fitConfig *FitConfig) ParamsSearchResult {
+	paramGrid = paramGrid.Discrete()
 	// Retrieve parameter names and length
 	paramNames := make([]model.ParamName, 0, len(paramGrid))
 	count := 1
@@ -59,10 +62,12 @@ func GridSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGri
 		paramNames = append(paramNames, paramName)
 		count *= len(values)
 	}
+	objective := fitConfig.LoadDefaultIfNil().Objective
 	// Construct DFS procedure
 	results := ParamsSearchResult{
-		Scores: make([]Score, 0, count),
-		Params: make([]model.Params, 0, count),
+		Scores:    make([]Score, 0, count),
+		Params:    make([]model.Params, 0, count),
+		Objective: objective,
 	}
 	var dfs func(deep int, params model.Params)
 	progress := 0
@@ -74,11 +79,13 @@ func GridSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGri
 			// Cross validate
 			estimator.Clear()
 			estimator.SetParams(estimator.GetParams().Overwrite(params))
+			fitStart := time.Now()
 			score := estimator.Fit(trainSet, testSet, fitConfig)
 			// Create GridSearch result
 			results.Scores = append(results.Scores, score)
 			results.Params = append(results.Params, params.Copy())
-			if len(results.Scores) == 0 || score.NDCG > results.BestScore.NDCG {
+			results.FitTimes = append(results.FitTimes, time.Since(fitStart))
+			if results.BestModel == nil || objective.Of(score) > objective.Of(results.BestScore) {
 				results.BestModel = Clone(estimator)
 				results.BestScore = score
 				results.BestParams = params.Copy()
@@ -106,26 +113,33 @@ func RandomSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramG
 		return GridSearchCV(estimator, trainSet, testSet, paramGrid, seed, fitConfig)
 	}
 	rng := base.NewRandomGenerator(seed)
+	objective := fitConfig.LoadDefaultIfNil().Objective
 	results := ParamsSearchResult{
-		Scores: make([]Score, 0, numTrials),
-		Params: make([]model.Params, 0, numTrials),
+		Scores:    make([]Score, 0, numTrials),
+		Params:    make([]model.Params, 0, numTrials),
+		Objective: objective,
 	}
 	for i := 1; i <= numTrials; i++ {
 		// Make parameters
 		params := model.Params{}
 		for paramName, values := range paramGrid {
-			value := values[rng.Intn(len(values))]
-			params[paramName] = value
+			if r, ok := paramGrid.GetRange(paramName); ok {
+				params[paramName] = r.Sample(rng)
+			} else {
+				params[paramName] = values[rng.Intn(len(values))]
+			}
 		}
 		// Cross validate
 		base.Logger().Info(fmt.Sprintf("random search (%v/%v)", i, numTrials),
 			zap.Any("params", params))
 		estimator.Clear()
 		estimator.SetParams(estimator.GetParams().Overwrite(params))
+		fitStart := time.Now()
 		score := estimator.Fit(trainSet, testSet, fitConfig)
 		results.Scores = append(results.Scores, score)
 		results.Params = append(results.Params, params.Copy())
-		if len(results.Scores) == 0 || score.NDCG > results.BestScore.NDCG {
+		results.FitTimes = append(results.FitTimes, time.Since(fitStart))
+		if results.BestModel == nil || objective.Of(score) > objective.Of(results.BestScore) {
 			results.BestModel = Clone(estimator)
 			results.BestScore = score
 			results.BestParams = params.Copy()
@@ -135,28 +149,80 @@ func RandomSearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramG
 	return results
 }
 
+// maxHistoryTrials is the max number of previous trials kept for each model to warm start searches.
+const maxHistoryTrials = 100
+
+// Trial is a trial of model search.
+type Trial struct {
+	Model   string
+	Params  model.Params
+	Score   Score
+	FitTime time.Duration
+}
+
 // ModelSearcher is a thread-safe personal ranking model searcher.
 type ModelSearcher struct {
 	// arguments
 	numEpochs int
 	numTrials int
+	objective Objective
 	// results
 	bestMutex      sync.Mutex
 	bestModelName  string
 	bestModel      Model
 	bestScore      Score
 	bestSimilarity string
+	// trials
+	history map[string]*ParamsSearchResult // previous trials of models
+	trials  []Trial                        // trials of the last search
 }
 
-// NewModelSearcher creates a thread-safe personal ranking model searcher.
-func NewModelSearcher(nEpoch, nTrials int) *ModelSearcher {
+// NewModelSearcher creates a thread-safe personal ranking model searcher. Models are compared
+// by the objective.
+func NewModelSearcher(nEpoch, nTrials int, objective Objective) *ModelSearcher {
 	return &ModelSearcher{
 		numTrials:      nTrials,
 		numEpochs:      nEpoch,
+		objective:      objective,
 		bestSimilarity: model.SimilarityCosine,
+		history:        make(map[string]*ParamsSearchResult),
 	}
 }
 
+// WarmStart adds previous trials to the history. Searches start from the history instead of
+// random trials.
+func (searcher *ModelSearcher) WarmStart(trials []Trial) {
+	searcher.bestMutex.Lock()
+	defer searcher.bestMutex.Unlock()
+	for _, trial := range trials {
+		searcher.addHistory(trial)
+	}
+}
+
+func (searcher *ModelSearcher) addHistory(trial Trial) {
+	history, exist := searcher.history[trial.Model]
+	if !exist {
+		history = NewParamsSearchResult()
+		history.Objective = searcher.objective
+		searcher.history[trial.Model] = history
+	}
+	history.Scores = append(history.Scores, trial.Score)
+	history.Params = append(history.Params, trial.Params)
+	history.FitTimes = append(history.FitTimes, trial.FitTime)
+	if len(history.Params) > maxHistoryTrials {
+		history.Scores = history.Scores[1:]
+		history.Params = history.Params[1:]
+		history.FitTimes = history.FitTimes[1:]
+	}
+}
+
+// GetTrials returns trials of the last search.
+func (searcher *ModelSearcher) GetTrials() []Trial {
+	searcher.bestMutex.Lock()
+	defer searcher.bestMutex.Unlock()
+	return searcher.trials
+}
+
 // GetBestModel returns the optimal personal ranking model.
 func (searcher *ModelSearcher) GetBestModel() (string, Model, Score) {
 	searcher.bestMutex.Lock()
@@ -171,34 +237,55 @@ func (searcher *ModelSearcher) GetBestSimilarity() string {
 	return searcher.bestSimilarity
 }
 
-func (searcher *ModelSearcher) Fit(trainSet *DataSet, valSet *DataSet) error {
+// Fit searches hyper-parameters of models. Hyper-parameters are sampled by the seed.
+func (searcher *ModelSearcher) Fit(trainSet *DataSet, valSet *DataSet, seed int64) error {
 	base.Logger().Info("model search",
 		zap.Int("n_users", trainSet.UserCount()),
-		zap.Int("n_items", trainSet.ItemCount()))
+		zap.Int("n_items", trainSet.ItemCount()),
+		zap.Int64("seed", seed))
 	fitStart := time.Now()
-	models := []string{"bpr", "ccd", "knn"}
+	fitConfig := (*FitConfig)(nil).LoadDefaultIfNil()
+	fitConfig.Objective = searcher.objective
+	models := []string{"bpr", "ccd", "fpmc", "hmf", "knn"}
+	trials := make([]Trial, 0, len(models)*searcher.numTrials)
 	for _, name := range models {
 		m, err := NewModel(name, model.Params{model.NEpochs: searcher.numEpochs})
 		if err != nil {
 			return err
 		}
-		r := RandomSearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, 0, nil)
 		searcher.bestMutex.Lock()
+		history := searcher.history[name]
+		searcher.bestMutex.Unlock()
+		r := TPESearchCV(m, trainSet, valSet, m.GetParamsGrid(), searcher.numTrials, seed, fitConfig, history)
+		searcher.bestMutex.Lock()
+		for i := range r.Params {
+			trial := Trial{Model: name, Params: r.Params[i], Score: r.Scores[i], FitTime: r.FitTimes[i]}
+			trials = append(trials, trial)
+			searcher.addHistory(trial)
+		}
 		if name == "knn" {
 			searcher.bestSimilarity = r.BestModel.GetParams()[model.Similarity].(string)
 		}
-		if searcher.bestModel == nil || r.BestScore.NDCG > searcher.bestScore.NDCG {
+		if searcher.bestModel == nil || searcher.objective.Of(r.BestScore) > searcher.objective.Of(searcher.bestScore) {
 			searcher.bestModelName = name
 			searcher.bestModel = r.BestModel
 			searcher.bestScore = r.BestScore
 		}
 		searcher.bestMutex.Unlock()
 	}
+	searcher.bestMutex.Lock()
+	searcher.trials = trials
+	searcher.bestMutex.Unlock()
 	fitTime := time.Since(fitStart)
 	base.Logger().Info("complete model search",
 		zap.Float32("NDCG@10", searcher.bestScore.NDCG),
 		zap.Float32("Precision@10", searcher.bestScore.Precision),
 		zap.Float32("Recall@10", searcher.bestScore.Recall),
+		zap.Float32("Coverage@10", searcher.bestScore.Coverage),
+		zap.Float32("Diversity@10", searcher.bestScore.Diversity),
+		zap.Float32("Novelty@10", searcher.bestScore.Novelty),
+		zap.Float32("Gini@10", searcher.bestScore.Gini),
+		zap.Float32("objective", searcher.objective.Of(searcher.bestScore)),
 		zap.String("model", searcher.bestModelName),
 		zap.Any("params", searcher.bestModel.GetParams()),
 		zap.String("fit_time", fitTime.String()))
@@ -61,6 +61,17 @@ func (m *mockMatrixFactorizationForSearch) GetParamsGrid() model.ParamsGrid {
 	}
 }
 
+func TestParamsSearchResult_AddScore(t *testing.T) {
+	r := NewParamsSearchResult()
+	r.Objective = Objective{Recall: 1}
+	r.AddScore(model.Params{model.NFactors: 1}, Score{NDCG: 0.5, Recall: 0.1})
+	r.AddScore(model.Params{model.NFactors: 2}, Score{NDCG: 0.1, Recall: 0.5})
+	r.AddScore(model.Params{model.NFactors: 3}, Score{NDCG: 0.4, Recall: 0.2})
+	assert.Equal(t, 1, r.BestIndex)
+	assert.Equal(t, model.Params{model.NFactors: 2}, r.BestParams)
+	assert.Equal(t, Score{NDCG: 0.1, Recall: 0.5}, r.BestScore)
+}
+
 func TestGridSearchCV(t *testing.T) {
 	m := &mockMatrixFactorizationForSearch{}
 	r := GridSearchCV(m, nil, nil, m.GetParamsGrid(), 0, nil)
@@ -0,0 +1,309 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"fmt"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"go.uber.org/zap"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// tpeGamma is the fraction of good trials.
+	tpeGamma = 0.25
+	// tpeCandidates is the number of candidates sampled for a hyper-parameter.
+	tpeCandidates = 24
+)
+
+// numStartupTrials returns the number of random trials before TPE and pruning start.
+func numStartupTrials(numTrials int) int {
+	n := numTrials / 4
+	if n < 2 {
+		n = 2
+	}
+	return n
+}
+
+// TPESearchCV searches hyper-parameters by the tree-structured Parzen estimator (TPE). The first
+// trials are random. Then, trials are split into good ones and bad ones by the objective, and each
+// hyper-parameter is sampled to maximize l(x)/g(x), where l(x) and g(x) are densities of good trials
+// and bad trials. Trials behind the median of previous trials at the same epoch are pruned. Previous
+// trials in the history (could be nil) are observed as well, which are not tried again and replace
+// random trials. Only new trials are returned.
+func TPESearchCV(estimator Model, trainSet *DataSet, testSet *DataSet, paramGrid model.ParamsGrid,
+	numTrials int, seed int64, fitConfig *FitConfig, history *ParamsSearchResult) ParamsSearchResult {
+	rng := base.NewRandomGenerator(seed)
+	config := *fitConfig.LoadDefaultIfNil()
+	pruner := NewMedianPruner(config.Objective, numStartupTrials(numTrials))
+	config.Pruner = pruner
+	// sort names for reproducibility
+	paramNames := make([]model.ParamName, 0, len(paramGrid))
+	for paramName := range paramGrid {
+		paramNames = append(paramNames, paramName)
+	}
+	sort.Slice(paramNames, func(i, j int) bool {
+		return paramNames[i] < paramNames[j]
+	})
+	results := ParamsSearchResult{
+		Scores:    make([]Score, 0, numTrials),
+		Params:    make([]model.Params, 0, numTrials),
+		FitTimes:  make([]time.Duration, 0, numTrials),
+		Objective: config.Objective,
+	}
+	// observe previous trials
+	observed := NewParamsSearchResult()
+	observed.Objective = config.Objective
+	tried := make(map[string]bool)
+	if history != nil {
+		for i := range history.Params {
+			params := restoreParams(paramGrid, history.Params[i])
+			observed.Scores = append(observed.Scores, history.Scores[i])
+			observed.Params = append(observed.Params, params)
+			tried[params.ToString()] = true
+		}
+	}
+	numHistory := len(observed.Params)
+	for i := 1; i <= numTrials; i++ {
+		// Make parameters
+		var params model.Params
+		if i+numHistory > numStartupTrials(numTrials) {
+			params = suggestTPE(rng, paramGrid, paramNames, *observed, config.Objective)
+		}
+		// Sample randomly in startup trials or if the suggestion has been tried
+		if params == nil || tried[params.ToString()] {
+			params = model.Params{}
+			for _, paramName := range paramNames {
+				if r, ok := paramGrid.GetRange(paramName); ok {
+					params[paramName] = r.Sample(rng)
+				} else {
+					values := paramGrid[paramName]
+					params[paramName] = values[rng.Intn(len(values))]
+				}
+			}
+		}
+		tried[params.ToString()] = true
+		// Cross validate
+		base.Logger().Info(fmt.Sprintf("tpe search (%v/%v)", i, numTrials),
+			zap.Any("params", params))
+		estimator.Clear()
+		estimator.SetParams(estimator.GetParams().Overwrite(params))
+		pruner.StartTrial()
+		fitStart := time.Now()
+		score := estimator.Fit(trainSet, testSet, &config)
+		results.Scores = append(results.Scores, score)
+		results.Params = append(results.Params, params.Copy())
+		results.FitTimes = append(results.FitTimes, time.Since(fitStart))
+		observed.Scores = append(observed.Scores, score)
+		observed.Params = append(observed.Params, params.Copy())
+		if results.BestModel == nil || config.Objective.Of(score) > config.Objective.Of(results.BestScore) {
+			results.BestModel = Clone(estimator)
+			results.BestScore = score
+			results.BestParams = params.Copy()
+			results.BestIndex = len(results.Params) - 1
+		}
+	}
+	return results
+}
+
+// restoreParams restores types of hyper-parameters loaded from elsewhere (e.g. JSON) by the grid.
+// Values of ranges are kept since they are read as floats, and others are replaced by candidates
+// in the same text.
+func restoreParams(paramGrid model.ParamsGrid, params model.Params) model.Params {
+	restored := model.Params{}
+	for paramName, value := range params {
+		restored[paramName] = value
+		if _, ok := paramGrid.GetRange(paramName); ok {
+			continue
+		}
+		for _, candidate := range paramGrid[paramName] {
+			if fmt.Sprint(candidate) == fmt.Sprint(value) {
+				restored[paramName] = candidate
+				break
+			}
+		}
+	}
+	return restored
+}
+
+// suggestTPE suggests hyper-parameters from previous trials.
+func suggestTPE(rng base.RandomGenerator, paramGrid model.ParamsGrid, paramNames []model.ParamName,
+	results ParamsSearchResult, objective Objective) model.Params {
+	// split trials into good ones and bad ones
+	order := make([]int, len(results.Scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return objective.Of(results.Scores[order[i]]) > objective.Of(results.Scores[order[j]])
+	})
+	numGood := int(math.Ceil(tpeGamma * float64(len(order))))
+	good, bad := make([]model.Params, numGood), make([]model.Params, len(order)-numGood)
+	for i, trialIndex := range order {
+		if i < numGood {
+			good[i] = results.Params[trialIndex]
+		} else {
+			bad[i-numGood] = results.Params[trialIndex]
+		}
+	}
+	// suggest hyper-parameters independently
+	params := model.Params{}
+	for _, paramName := range paramNames {
+		if r, ok := paramGrid.GetRange(paramName); ok {
+			params[paramName] = suggestRange(rng, r, observe(good, paramName, r), observe(bad, paramName, r))
+		} else {
+			params[paramName] = suggestValue(rng, paramGrid[paramName], paramName, good, bad)
+		}
+	}
+	return params
+}
+
+// observe collects values of a hyper-parameter in the scale of sampling.
+func observe(trials []model.Params, paramName model.ParamName, r model.Range) []float64 {
+	values := make([]float64, 0, len(trials))
+	for _, params := range trials {
+		value := float64(params.GetFloat32(paramName, float32(r.Low)))
+		if r.Log {
+			value = math.Log(value)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// suggestRange suggests a value in a range. Densities are estimated by Gaussian kernels at
+// observations mixed with an uniform prior.
+func suggestRange(rng base.RandomGenerator, r model.Range, good, bad []float64) float64 {
+	low, high := r.Low, r.High
+	if r.Log {
+		low, high = math.Log(low), math.Log(high)
+	}
+	density := func(x float64, observations []float64) float64 {
+		bandwidth := (high - low) / math.Sqrt(float64(len(observations)+1))
+		sum := 1 / (high - low)
+		for _, o := range observations {
+			z := (x - o) / bandwidth
+			sum += math.Exp(-z*z/2) / (bandwidth * math.Sqrt(2*math.Pi))
+		}
+		return sum / float64(len(observations)+1)
+	}
+	bestValue, bestRatio := low, math.Inf(-1)
+	for i := 0; i < tpeCandidates; i++ {
+		// sample from the density of good trials
+		var x float64
+		if j := rng.Intn(len(good) + 1); j < len(good) {
+			x = good[j] + rng.NormFloat64()*(high-low)/math.Sqrt(float64(len(good)+1))
+			x = math.Max(low, math.Min(high, x))
+		} else {
+			x = low + rng.Float64()*(high-low)
+		}
+		if ratio := density(x, good) / density(x, bad); ratio > bestRatio {
+			bestValue, bestRatio = x, ratio
+		}
+	}
+	if r.Log {
+		return math.Exp(bestValue)
+	}
+	return bestValue
+}
+
+// suggestValue suggests a value from candidates. Densities are frequencies with add-one smoothing.
+func suggestValue(rng base.RandomGenerator, values []interface{}, paramName model.ParamName, good, bad []model.Params) interface{} {
+	density := func(value interface{}, trials []model.Params) float64 {
+		count := 1
+		for _, params := range trials {
+			if params[paramName] == value {
+				count++
+			}
+		}
+		return float64(count) / float64(len(trials)+len(values))
+	}
+	weights := make([]float64, len(values))
+	sum := 0.0
+	for i, value := range values {
+		weights[i] = density(value, good)
+		sum += weights[i]
+	}
+	bestValue, bestRatio := values[0], math.Inf(-1)
+	for i := 0; i < tpeCandidates; i++ {
+		// sample from the density of good trials
+		k, x := 0, rng.Float64()*sum
+		for k < len(values)-1 && x >= weights[k] {
+			x -= weights[k]
+			k++
+		}
+		if ratio := weights[k] / density(values[k], bad); ratio > bestRatio {
+			bestValue, bestRatio = values[k], ratio
+		}
+	}
+	return bestValue
+}
+
+// MedianPruner prunes a trial if its objective at an epoch is lower than the median of previous
+// trials at the same epoch. Trials are never pruned before enough trials have completed.
+type MedianPruner struct {
+	objective        Objective
+	numStartupTrials int
+	trials           []map[int]float32 // objectives of previous trials at epochs
+	current          map[int]float32
+}
+
+// NewMedianPruner creates a median pruner.
+func NewMedianPruner(objective Objective, numStartupTrials int) *MedianPruner {
+	return &MedianPruner{
+		objective:        objective,
+		numStartupTrials: numStartupTrials,
+	}
+}
+
+// StartTrial starts a new trial.
+func (pruner *MedianPruner) StartTrial() {
+	if pruner.current != nil {
+		pruner.trials = append(pruner.trials, pruner.current)
+	}
+	pruner.current = make(map[int]float32)
+}
+
+// Prune reports the score of the current trial at an epoch and returns true if it should stop.
+func (pruner *MedianPruner) Prune(epoch int, score Score) bool {
+	if pruner.current == nil {
+		pruner.StartTrial()
+	}
+	value := pruner.objective.Of(score)
+	pruner.current[epoch] = value
+	if len(pruner.trials) < pruner.numStartupTrials {
+		return false
+	}
+	previous := make([]float32, 0, len(pruner.trials))
+	for _, trial := range pruner.trials {
+		if v, exist := trial[epoch]; exist {
+			previous = append(previous, v)
+		}
+	}
+	if len(previous) == 0 {
+		return false
+	}
+	sort.Slice(previous, func(i, j int) bool {
+		return previous[i] < previous[j]
+	})
+	median := previous[len(previous)/2]
+	if len(previous)%2 == 0 {
+		median = (previous[len(previous)/2-1] + median) / 2
+	}
+	return value < median
+}
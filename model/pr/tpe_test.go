@@ -0,0 +1,115 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pr
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/model"
+	"testing"
+)
+
+func TestTPESearchCV(t *testing.T) {
+	m := &mockMatrixFactorizationForSearch{}
+	paramGrid := model.ParamsGrid{
+		model.NFactors:   []interface{}{1, 2, 3, 4},
+		model.InitMean:   []interface{}{4, 3, 2, 1},
+		model.InitStdDev: []interface{}{model.Range{Low: 0, High: 4}},
+	}
+	r := TPESearchCV(m, nil, nil, paramGrid, 40, 0, nil, nil)
+	assert.Len(t, r.Scores, 40)
+	assert.Equal(t, 4, r.BestParams[model.NFactors])
+	assert.Equal(t, 4, r.BestParams[model.InitMean])
+	assert.Greater(t, r.BestScore.NDCG, float32(11))
+	assert.Equal(t, r.Scores[r.BestIndex], r.BestScore)
+	// suggested values are better than random values
+	early, late := float32(0), float32(0)
+	for i := 0; i < 10; i++ {
+		early += r.Scores[i].NDCG
+		late += r.Scores[len(r.Scores)-i-1].NDCG
+	}
+	assert.Greater(t, late, early)
+}
+
+func TestTPESearchCV_WarmStart(t *testing.T) {
+	m := &mockMatrixFactorizationForSearch{}
+	paramGrid := model.ParamsGrid{
+		model.NFactors:   []interface{}{1, 2, 3, 4},
+		model.InitMean:   []interface{}{4, 3, 2, 1},
+		model.InitStdDev: []interface{}{model.Range{Low: 0, High: 4}},
+	}
+	r := TPESearchCV(m, nil, nil, paramGrid, 20, 0, nil, nil)
+	// previous trials are loaded from JSON
+	history := NewParamsSearchResult()
+	tried := make(map[string]bool)
+	for i := range r.Params {
+		var params model.Params
+		data, err := json.Marshal(r.Params[i])
+		assert.Nil(t, err)
+		err = json.Unmarshal(data, &params)
+		assert.Nil(t, err)
+		history.Scores = append(history.Scores, r.Scores[i])
+		history.Params = append(history.Params, params)
+		tried[r.Params[i].ToString()] = true
+	}
+	warm := TPESearchCV(m, nil, nil, paramGrid, 10, 1, nil, history)
+	assert.Len(t, warm.Scores, 10)
+	assert.Len(t, warm.FitTimes, 10)
+	// previous trials are not tried again
+	for _, params := range warm.Params {
+		assert.False(t, tried[params.ToString()])
+	}
+	// warm start searches are better than random searches
+	random, suggested := float32(0), float32(0)
+	for i := 0; i < 10; i++ {
+		random += r.Scores[i].NDCG
+		suggested += warm.Scores[i].NDCG
+	}
+	assert.Greater(t, suggested, random)
+}
+
+func TestRestoreParams(t *testing.T) {
+	paramGrid := model.ParamsGrid{
+		model.NFactors:   []interface{}{8, 16},
+		model.Similarity: []interface{}{model.SimilarityCosine, model.SimilarityDot},
+		model.Reg:        []interface{}{model.Range{Low: 0.001, High: 0.1, Log: true}},
+	}
+	params := restoreParams(paramGrid, model.Params{
+		model.NFactors:   float64(16),
+		model.Similarity: model.SimilarityDot,
+		model.Reg:        0.01,
+	})
+	assert.Equal(t, model.Params{
+		model.NFactors:   16,
+		model.Similarity: model.SimilarityDot,
+		model.Reg:        0.01,
+	}, params)
+}
+
+func TestMedianPruner(t *testing.T) {
+	pruner := NewMedianPruner(Objective{}, 2)
+	// never prune startup trials
+	pruner.StartTrial()
+	assert.False(t, pruner.Prune(10, Score{NDCG: 0.1}))
+	assert.False(t, pruner.Prune(20, Score{NDCG: 0.2}))
+	pruner.StartTrial()
+	assert.False(t, pruner.Prune(10, Score{NDCG: 0.3}))
+	assert.False(t, pruner.Prune(20, Score{NDCG: 0.4}))
+	// prune trials behind the median
+	pruner.StartTrial()
+	assert.False(t, pruner.Prune(10, Score{NDCG: 0.25}))
+	assert.True(t, pruner.Prune(20, Score{NDCG: 0.25}))
+	assert.False(t, pruner.Prune(30, Score{NDCG: 0.1}))
+}
@@ -23,6 +23,7 @@ type MasterClient interface {
 	GetUserIndex(ctx context.Context, in *NodeInfo, opts ...grpc.CallOption) (*UserIndex, error)
 	GetCTRModel(ctx context.Context, in *NodeInfo, opts ...grpc.CallOption) (*Model, error)
 	GetPRModel(ctx context.Context, in *NodeInfo, opts ...grpc.CallOption) (*Model, error)
+	GetSequentialModel(ctx context.Context, in *NodeInfo, opts ...grpc.CallOption) (*Model, error)
 }
 
 type masterClient struct {
@@ -69,6 +70,15 @@ func (c *masterClient) GetPRModel(ctx context.Context, in *NodeInfo, opts ...grp
 	return out, nil
 }
 
+func (c *masterClient) GetSequentialModel(ctx context.Context, in *NodeInfo, opts ...grpc.CallOption) (*Model, error) {
+	out := new(Model)
+	err := c.cc.Invoke(ctx, "/protocol.Master/GetSequentialModel", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MasterServer is the server API for Master service.
 // All implementations must embed UnimplementedMasterServer
 // for forward compatibility
@@ -79,6 +89,7 @@ type MasterServer interface {
 	GetUserIndex(context.Context, *NodeInfo) (*UserIndex, error)
 	GetCTRModel(context.Context, *NodeInfo) (*Model, error)
 	GetPRModel(context.Context, *NodeInfo) (*Model, error)
+	GetSequentialModel(context.Context, *NodeInfo) (*Model, error)
 	mustEmbedUnimplementedMasterServer()
 }
 
@@ -98,6 +109,9 @@ func (UnimplementedMasterServer) GetCTRModel(context.Context, *NodeInfo) (*Model
 func (UnimplementedMasterServer) GetPRModel(context.Context, *NodeInfo) (*Model, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPRModel not implemented")
 }
+func (UnimplementedMasterServer) GetSequentialModel(context.Context, *NodeInfo) (*Model, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSequentialModel not implemented")
+}
 func (UnimplementedMasterServer) mustEmbedUnimplementedMasterServer() {}
 
 // UnsafeMasterServer may be embedded to opt out of forward compatibility for this service.
@@ -183,6 +197,24 @@ func _Master_GetPRModel_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Master_GetSequentialModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NodeInfo)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MasterServer).GetSequentialModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/protocol.Master/GetSequentialModel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MasterServer).GetSequentialModel(ctx, req.(*NodeInfo))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Master_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protocol.Master",
 	HandlerType: (*MasterServer)(nil),
@@ -203,6 +235,10 @@ var _Master_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetPRModel",
 			Handler:    _Master_GetPRModel_Handler,
 		},
+		{
+			MethodName: "GetSequentialModel",
+			Handler:    _Master_GetSequentialModel_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "protocol.proto",
@@ -0,0 +1,73 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+const (
+	impressionBufferSize    = 1024
+	impressionBatchSize     = 1000
+	impressionFlushInterval = time.Second
+)
+
+// logImpressions queues impressions to be written in background, so that recommendation
+// requests don't wait for the data store. Impressions are dropped if the queue is full.
+func (s *RestServer) logImpressions(impressions []data.Impression) {
+	s.impressionOnce.Do(func() {
+		s.impressionChan = make(chan []data.Impression, impressionBufferSize)
+		go s.writeImpressions()
+	})
+	select {
+	case s.impressionChan <- impressions:
+	default:
+		base.Logger().Warn("impression queue is full, drop impressions",
+			zap.Int("n_impressions", len(impressions)))
+	}
+}
+
+// writeImpressions inserts queued impressions in batches. A batch is flushed once it is
+// full or the flush interval elapses.
+func (s *RestServer) writeImpressions() {
+	ticker := time.NewTicker(impressionFlushInterval)
+	defer ticker.Stop()
+	batch := make([]data.Impression, 0, impressionBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ttl := time.Duration(s.GorseConfig.Server.ImpressionTTL) * 24 * time.Hour
+		if err := s.DataStore.InsertImpressions(batch, ttl); err != nil {
+			base.Logger().Error("failed to insert impressions", zap.Int("n_impressions", len(batch)), zap.Error(err))
+		}
+		batch = make([]data.Impression, 0, impressionBatchSize)
+	}
+	for {
+		select {
+		case impressions := <-s.impressionChan:
+			batch = append(batch, impressions...)
+			if len(batch) >= impressionBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
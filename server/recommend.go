@@ -0,0 +1,593 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/scylladb/go-set"
+	"github.com/scylladb/go-set/strset"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+// Candidate sources of the recommendation pipeline.
+const (
+	CollaborativeSource = "collaborative"
+	SessionSource       = "session"
+	SequentialSource    = "sequential"
+	SimilarSource       = "similar"
+	PopularSource       = "popular"
+	LatestSource        = "latest"
+	TrendingSource      = "trending"
+	LabelPopularSource  = "label_popular"
+	ColdStartSource     = "cold_start"
+	SubscribeSource     = "subscribe"
+	SimilarUsersSource  = "similar_users"
+	// PinSource is the source of items pinned by rules.
+	PinSource = "pin"
+)
+
+// Rank stages of the recommendation pipeline.
+const (
+	NoneRank     = "none"
+	WeightedRank = "weighted"
+)
+
+// Re-ranking stages of the recommendation pipeline.
+const (
+	NoDiversity         = "none"
+	SimilarityDiversity = "similarity"
+	LabelDiversity      = "label"
+)
+
+// RecommendOptions are options for a recommendation request, which override the config.
+type RecommendOptions struct {
+	Variant         string // the variant of the experiment assigned to the user
+	Rank            string
+	Pipeline        []config.StageConfig
+	Diversity       string
+	DiversityLambda float32
+	LabelCap        int
+}
+
+// NewRecommendOptions creates options for a user from the config. If there is an experiment,
+// settings of the variant assigned to the user override the recommend section.
+func (s *RestServer) NewRecommendOptions(userId string) *RecommendOptions {
+	options := &RecommendOptions{
+		Rank:            s.GorseConfig.Recommend.Rank,
+		Pipeline:        s.GorseConfig.Recommend.GetPipeline(),
+		Diversity:       s.GorseConfig.Recommend.Diversity,
+		DiversityLambda: s.GorseConfig.Recommend.DiversityLambda,
+		LabelCap:        s.GorseConfig.Recommend.LabelCap,
+	}
+	if variant := s.GorseConfig.Experiment.Assign(userId); variant != nil {
+		options.Variant = variant.Name
+		if variant.Rank != "" {
+			options.Rank = variant.Rank
+		}
+		if len(variant.Pipeline) > 0 {
+			options.Pipeline = variant.Pipeline
+		}
+		if variant.Diversity != "" {
+			options.Diversity = variant.Diversity
+		}
+		if variant.DiversityLambda > 0 {
+			options.DiversityLambda = variant.DiversityLambda
+		}
+		if variant.LabelCap > 0 {
+			options.LabelCap = variant.LabelCap
+		}
+	}
+	return options
+}
+
+// maxContributors is the max number of contributing items in an explanation.
+const maxContributors = 3
+
+// maxNeighbors is the max number of similar users whose feedback is collected.
+const maxNeighbors = 10
+
+// Explanation explains why an item is recommended.
+type Explanation struct {
+	ItemId string
+	Source string  // the source contributing most to the item
+	Score  float32 // the score of the item in the rank stage
+	// Contributors are historical items contributing to the score of the item, which are only
+	// available for item-based sources (session and similar).
+	Contributors []cache.ScoredItem `json:",omitempty"`
+}
+
+// recommendContext keeps states of a recommendation request.
+type recommendContext struct {
+	userId       string
+	excludeSet   *strset.Set
+	sources      map[string]string                        // the source contributing most to each item
+	scores       map[string]float32                       // scores of items in the rank stage
+	contributors map[string]map[string][]cache.ScoredItem // source -> item -> contributing items
+	firedRules   []string
+}
+
+// explain items by sources, scores and contributors.
+func (ctx *recommendContext) explain(items []string) []Explanation {
+	explanations := make([]Explanation, len(items))
+	for i, itemId := range items {
+		source := ctx.sources[itemId]
+		explanations[i] = Explanation{
+			ItemId:       itemId,
+			Source:       source,
+			Score:        ctx.scores[itemId],
+			Contributors: ctx.contributors[source][itemId],
+		}
+	}
+	return explanations
+}
+
+// addContributors records the top contributing items of each candidate from a source.
+func (ctx *recommendContext) addContributors(source string, contributions map[string]map[string]float32) {
+	if ctx.contributors == nil {
+		ctx.contributors = make(map[string]map[string][]cache.ScoredItem)
+	}
+	ctx.contributors[source] = make(map[string][]cache.ScoredItem, len(contributions))
+	for itemId, contribution := range contributions {
+		ctx.contributors[source][itemId] = topScoredItems(contribution, maxContributors)
+	}
+}
+
+// Recommend items to users. Candidates are collected from sources in the recommendation pipeline:
+// 1. If the rank stage is weighted, merge candidates from sources with positive weights by weighted scores.
+// 2. Fill recommendations by candidates from other sources in order, until there are n items.
+// 3. Apply filter and boost rules to candidates.
+// 4. If diversity or label cap is enabled, re-rank candidates to n items.
+// 5. Insert items pinned by rules.
+// Items read by the user are excluded from recommendations. Options from the config are used if
+// options is nil. Rules fired are logged for audit.
+func (s *RestServer) Recommend(userId string, n int, options *RecommendOptions) ([]string, error) {
+	results, _, err := s.recommend(userId, n, options)
+	return results, err
+}
+
+func (s *RestServer) recommend(userId string, n int, options *RecommendOptions) ([]string, *recommendContext, error) {
+	start := time.Now()
+	if options == nil {
+		options = s.NewRecommendOptions(userId)
+	}
+	if options.Diversity == "" {
+		options.Diversity = NoDiversity
+	}
+	pipeline := options.Pipeline
+	rank := options.Rank
+	if rank == "" {
+		rank = NoneRank
+	}
+	if rank != NoneRank && rank != WeightedRank {
+		return nil, nil, fmt.Errorf("unknown rank method `%s`", rank)
+	}
+
+	// 0. load ignore items
+	ignoreItems, err := s.CacheStore.GetList(cache.IgnoreItems, userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, err := s.loadRules(userId, start)
+	if err != nil {
+		return nil, nil, err
+	}
+	finalN := n
+	if options.Diversity != NoDiversity || options.LabelCap > 0 || hasRankingRules(rules) {
+		// collect more candidates for re-ranking
+		if s.GorseConfig.Database.CacheSize > n {
+			n = s.GorseConfig.Database.CacheSize
+		}
+	}
+	ctx := &recommendContext{
+		userId:     userId,
+		excludeSet: strset.New(ignoreItems...),
+		sources:    make(map[string]string),
+		scores:     make(map[string]float32),
+	}
+	results := make([]string, 0, n)
+	resultSet := strset.New()
+	stageTimes := make([]zap.Field, 0, len(pipeline))
+
+	// 1. merge candidates by weighted scores
+	if rank == WeightedRank {
+		scores := ctx.scores
+		contributions := make(map[string]float32)
+		for _, stage := range pipeline {
+			if stage.Weight <= 0 {
+				continue
+			}
+			stageStart := time.Now()
+			candidates, err := s.collect(ctx, stage.Source)
+			if err != nil {
+				return nil, nil, err
+			}
+			if stage.Quota > 0 && len(candidates) > stage.Quota {
+				candidates = candidates[:stage.Quota]
+			}
+			for i, item := range candidates {
+				if !resultSet.Has(item.ItemId) {
+					resultSet.Add(item.ItemId)
+					results = append(results, item.ItemId)
+				}
+				// scores are normalized by positions
+				contribution := stage.Weight * (1 - float32(i)/float32(len(candidates)))
+				scores[item.ItemId] += contribution
+				if contribution > contributions[item.ItemId] {
+					contributions[item.ItemId] = contribution
+					ctx.sources[item.ItemId] = stage.Source
+				}
+			}
+			stageTimes = append(stageTimes, zap.Duration(stage.Source+"_time", time.Since(stageStart)))
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return scores[results[i]] > scores[results[j]]
+		})
+	}
+
+	// 2. fill recommendations in order
+	for _, stage := range pipeline {
+		if len(results) >= n {
+			break
+		}
+		if rank == WeightedRank && stage.Weight > 0 {
+			continue
+		}
+		stageStart := time.Now()
+		candidates, err := s.collect(ctx, stage.Source)
+		if err != nil {
+			return nil, nil, err
+		}
+		limit := n - len(results)
+		if stage.Quota > 0 && stage.Quota < limit {
+			limit = stage.Quota
+		}
+		for _, item := range candidates {
+			if limit <= 0 {
+				break
+			}
+			if !resultSet.Has(item.ItemId) {
+				resultSet.Add(item.ItemId)
+				results = append(results, item.ItemId)
+				ctx.sources[item.ItemId] = stage.Source
+				ctx.scores[item.ItemId] = item.Score
+				limit--
+			}
+		}
+		stageTimes = append(stageTimes, zap.Duration(stage.Source+"_time", time.Since(stageStart)))
+	}
+
+	// 3. apply filter and boost rules
+	if hasRankingRules(rules) {
+		results, ctx.firedRules = s.applyRules(results, rules, start)
+	}
+
+	// 4. re-rank recommendations
+	if options.Diversity != NoDiversity || options.LabelCap > 0 {
+		rerankStart := time.Now()
+		results, err = s.diversify(results, finalN, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		stageTimes = append(stageTimes, zap.Duration("rerank_time", time.Since(rerankStart)))
+	}
+
+	if len(results) > finalN {
+		results = results[:finalN]
+	}
+
+	// 5. pin items
+	var pinnedRules []string
+	results, pinnedRules = pinItems(results, rules, ctx.excludeSet)
+	ctx.firedRules = append(ctx.firedRules, pinnedRules...)
+	pinnedRuleSet := strset.New(pinnedRules...)
+	for _, rule := range rules {
+		if pinnedRuleSet.Has(rule.RuleId) {
+			ctx.sources[rule.ItemId] = PinSource
+		}
+	}
+
+	// return recommendations
+	if len(results) > finalN {
+		results = results[:finalN]
+	}
+	if len(ctx.firedRules) > 0 {
+		for _, ruleId := range ctx.firedRules {
+			RuleFiredCounter.WithLabelValues(ruleId).Inc()
+		}
+		base.Logger().Info("rules fired", zap.String("user_id", userId), zap.Strings("rule_ids", ctx.firedRules))
+	}
+	base.Logger().Info("complete recommendation", append(stageTimes,
+		zap.String("variant", options.Variant),
+		zap.Duration("total_time", time.Since(start)))...)
+	return results, ctx, nil
+}
+
+// collect candidates from a source. Candidates are sorted by scores in descending order.
+func (s *RestServer) collect(ctx *recommendContext, source string) ([]cache.ScoredItem, error) {
+	var candidates []cache.ScoredItem
+	var err error
+	switch source {
+	case CollaborativeSource:
+		candidates, err = s.CacheStore.GetScores(cache.CollaborativeItems, ctx.userId, 0, s.GorseConfig.Database.CacheSize)
+		if err == nil && len(candidates) == 0 {
+			base.Logger().Warn("empty collaborative filtering", zap.String("user_id", ctx.userId))
+		}
+	case SessionSource:
+		candidates, err = s.sessionRecommend(ctx)
+	case SequentialSource:
+		candidates, err = s.sequentialRecommend(ctx)
+	case SimilarSource:
+		candidates, err = s.similarRecommend(ctx)
+	case PopularSource:
+		candidates, err = s.CacheStore.GetScores(cache.PopularItems, "", 0, s.GorseConfig.Database.CacheSize)
+	case LatestSource:
+		candidates, err = s.CacheStore.GetScores(cache.LatestItems, "", 0, s.GorseConfig.Database.CacheSize)
+	case TrendingSource:
+		candidates, err = s.CacheStore.GetScores(cache.TrendingItems, "", 0, s.GorseConfig.Database.CacheSize)
+	case LabelPopularSource:
+		candidates, err = s.labelPopularRecommend(ctx)
+	case ColdStartSource:
+		candidates, err = s.coldStartRecommend(ctx)
+	case SimilarUsersSource:
+		candidates, err = s.similarUsersRecommend(ctx)
+	case SubscribeSource:
+		candidates, err = s.CacheStore.GetScores(cache.SubscribeItems, ctx.userId, 0, s.GorseConfig.Database.CacheSize)
+	default:
+		return nil, fmt.Errorf("unknown recommendation source `%s`", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// remove read items
+	results := make([]cache.ScoredItem, 0, len(candidates))
+	for _, item := range candidates {
+		if !ctx.excludeSet.Has(item.ItemId) {
+			results = append(results, item)
+		}
+	}
+	return results, nil
+}
+
+// sessionRecommend recommends items similar to recent items of a user. Similarities
+// to an item are weighted by its recency, the i-th recent item has a weight of 1/i.
+func (s *RestServer) sessionRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	sessionItems, err := s.CacheStore.GetList(cache.SessionItems, ctx.userId)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make(map[string]float32)
+	contributions := make(map[string]map[string]float32)
+	for i, itemId := range sessionItems {
+		similarItems, err := s.CacheStore.GetScores(cache.SimilarItems, itemId, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range similarItems {
+			if !ctx.excludeSet.Has(item.ItemId) {
+				candidates[item.ItemId] += item.Score / float32(i+1)
+				addContribution(contributions, item.ItemId, itemId, item.Score/float32(i+1))
+			}
+		}
+	}
+	ctx.addContributors(SessionSource, contributions)
+	return topScoredItems(candidates, s.GorseConfig.Database.CacheSize), nil
+}
+
+// sequentialRecommend recommends next items after recent items of a user by the sequential model
+// pulled from the master. Nothing is recommended until the sequential model has been pulled. Only
+// items cached for the user by workers and neighbors of recent items are scored, so the latency
+// doesn't grow with the number of items.
+func (s *RestServer) sequentialRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	sequential, ok := s.getSequentialModel().(pr.Sequential)
+	if !ok || sequential.GetUserIndex() == nil || sequential.GetItemIndex() == nil {
+		return nil, nil
+	}
+	// load recent items
+	sessionItems, err := s.CacheStore.GetList(cache.SessionItems, ctx.userId)
+	if err != nil {
+		return nil, err
+	}
+	recentItems := make([]int, 0, len(sessionItems))
+	for _, itemId := range sessionItems {
+		if itemIndex := sequential.GetItemIndex().ToNumber(itemId); itemIndex != base.NotId {
+			recentItems = append(recentItems, itemIndex)
+		}
+	}
+	userIndex := sequential.GetUserIndex().ToNumber(ctx.userId)
+	if userIndex == base.NotId && len(recentItems) == 0 {
+		return nil, nil
+	}
+	// collect candidates
+	candidates, err := s.CacheStore.GetScores(cache.CollaborativeItems, ctx.userId, 0, s.GorseConfig.Database.CacheSize-1)
+	if err != nil {
+		return nil, err
+	}
+	for _, itemId := range sessionItems {
+		similarItems, err := s.CacheStore.GetScores(cache.SimilarItems, itemId, 0, s.GorseConfig.Database.CacheSize-1)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, similarItems...)
+	}
+	// score next items
+	scored := strset.New()
+	filter := base.NewTopKStringFilter(s.GorseConfig.Database.CacheSize)
+	for _, candidate := range candidates {
+		if scored.Has(candidate.ItemId) || ctx.excludeSet.Has(candidate.ItemId) {
+			continue
+		}
+		scored.Add(candidate.ItemId)
+		if itemIndex := sequential.GetItemIndex().ToNumber(candidate.ItemId); itemIndex != base.NotId {
+			filter.Push(candidate.ItemId, sequential.InternalPredictNext(userIndex, recentItems, itemIndex))
+		}
+	}
+	elems, scores := filter.PopAll()
+	return cache.CreateScoredItems(elems, scores), nil
+}
+
+// similarRecommend recommends items similar to historical items of a user. Historical
+// items are excluded from following sources.
+func (s *RestServer) similarRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	// load historical feedback
+	userFeedback, err := s.DataStore.GetUserFeedback(ctx.userId, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, feedback := range userFeedback {
+		ctx.excludeSet.Add(feedback.ItemId)
+	}
+	// collect candidates
+	candidates := make(map[string]float32)
+	contributions := make(map[string]map[string]float32)
+	for _, feedback := range userFeedback {
+		// load similar items
+		similarItems, err := s.CacheStore.GetScores(cache.SimilarItems, feedback.ItemId, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		// add unseen items
+		for _, item := range similarItems {
+			if !ctx.excludeSet.Has(item.ItemId) {
+				candidates[item.ItemId] += item.Score
+				addContribution(contributions, item.ItemId, feedback.ItemId, item.Score)
+			}
+		}
+	}
+	ctx.addContributors(SimilarSource, contributions)
+	return topScoredItems(candidates, s.GorseConfig.Database.CacheSize), nil
+}
+
+// similarUsersRecommend recommends items favored by similar users of a user. Items are
+// weighted by similarities of users who favor them.
+func (s *RestServer) similarUsersRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	// load historical feedback
+	userFeedback, err := s.DataStore.GetUserFeedback(ctx.userId, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, feedback := range userFeedback {
+		ctx.excludeSet.Add(feedback.ItemId)
+	}
+	// load similar users
+	similarUsers, err := s.CacheStore.GetScores(cache.SimilarUsers, ctx.userId, 0, maxNeighbors-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(similarUsers) == 0 {
+		return nil, nil
+	}
+	// load positive feedback of similar users in a batch (all feedback if no positive type)
+	similarities := make(map[string]float32, len(similarUsers))
+	userIds := make([]string, len(similarUsers))
+	for i, user := range similarUsers {
+		similarities[user.ItemId] = user.Score
+		userIds[i] = user.ItemId
+	}
+	var positiveTypes []string
+	if len(s.GorseConfig.Database.PositiveFeedbackType) > 0 {
+		positiveTypes = s.GorseConfig.Database.PositiveFeedbackType
+	}
+	feedback, err := s.DataStore.BatchGetUserFeedback(userIds, positiveTypes)
+	if err != nil {
+		return nil, err
+	}
+	// collect candidates
+	candidates := make(map[string]float32)
+	for _, f := range feedback {
+		if !ctx.excludeSet.Has(f.ItemId) {
+			candidates[f.ItemId] += similarities[f.UserId]
+		}
+	}
+	return topScoredItems(candidates, s.GorseConfig.Database.CacheSize), nil
+}
+
+// labelPopularRecommend recommends popular items with labels of recent items of a user.
+// Popularity of an item is weighted by the frequency of its label.
+func (s *RestServer) labelPopularRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	sessionItems, err := s.CacheStore.GetList(cache.SessionItems, ctx.userId)
+	if err != nil {
+		return nil, err
+	}
+	// count labels
+	labels := make(map[string]int)
+	for _, itemId := range sessionItems {
+		item, err := s.DataStore.GetItem(itemId)
+		if err != nil {
+			base.Logger().Warn("failed to get item", zap.String("item_id", itemId), zap.Error(err))
+			continue
+		}
+		for _, label := range set.NewStringSet(item.Labels...).List() {
+			labels[label]++
+		}
+	}
+	// collect candidates
+	candidates := make(map[string]float32)
+	for label, count := range labels {
+		popularItems, err := s.CacheStore.GetScores(cache.PopularItems, label, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range popularItems {
+			candidates[item.ItemId] += float32(count) * item.Score
+		}
+	}
+	return topScoredItems(candidates, s.GorseConfig.Database.CacheSize), nil
+}
+
+// coldStartRecommend recommends popular items among users sharing labels with a user.
+func (s *RestServer) coldStartRecommend(ctx *recommendContext) ([]cache.ScoredItem, error) {
+	user, err := s.DataStore.GetUser(ctx.userId)
+	if err != nil {
+		if err.Error() == data.ErrUserNotExist {
+			return nil, nil
+		}
+		return nil, err
+	}
+	candidates := make(map[string]float32)
+	for _, label := range set.NewStringSet(user.Labels...).List() {
+		popularItems, err := s.CacheStore.GetScores(cache.UserLabelPopularItems, label, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range popularItems {
+			candidates[item.ItemId] += item.Score
+		}
+	}
+	return topScoredItems(candidates, s.GorseConfig.Database.CacheSize), nil
+}
+
+func addContribution(contributions map[string]map[string]float32, itemId, contributorId string, score float32) {
+	if _, exist := contributions[itemId]; !exist {
+		contributions[itemId] = make(map[string]float32)
+	}
+	contributions[itemId][contributorId] += score
+}
+
+func topScoredItems(candidates map[string]float32, n int) []cache.ScoredItem {
+	filter := base.NewTopKStringFilter(n)
+	for itemId, score := range candidates {
+		filter.Push(itemId, score)
+	}
+	ids, scores := filter.PopAll()
+	return cache.CreateScoredItems(ids, scores)
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/scylladb/go-set/strset"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"go.uber.org/zap"
+)
+
+// diversify re-ranks items by maximal marginal relevance (MMR). Items are selected greedily by
+// λ * relevance - (1 - λ) * max similarity to selected items, where relevance is normalized by
+// positions. Items with labels reaching the label cap are skipped.
+func (s *RestServer) diversify(items []string, n int, options *RecommendOptions) ([]string, error) {
+	// load labels
+	var labels []*strset.Set
+	if options.Diversity == LabelDiversity || options.LabelCap > 0 {
+		labels = s.loadLabels(items)
+	}
+	// create similarity function
+	var similarity func(i, j int) float32
+	switch options.Diversity {
+	case NoDiversity:
+	case LabelDiversity:
+		similarity = func(i, j int) float32 {
+			return jaccard(labels[i], labels[j])
+		}
+	case SimilarityDiversity:
+		similarities, err := s.loadSimilarities(items)
+		if err != nil {
+			return nil, err
+		}
+		similarity = func(i, j int) float32 {
+			if similarities[i][items[j]] > similarities[j][items[i]] {
+				return similarities[i][items[j]]
+			}
+			return similarities[j][items[i]]
+		}
+	default:
+		return nil, fmt.Errorf("unknown diversity method `%s`", options.Diversity)
+	}
+	// select items
+	results := make([]string, 0, n)
+	selected := make([]bool, len(items))
+	maxSimilarities := make([]float32, len(items))
+	labelCount := make(map[string]int)
+	for len(results) < n {
+		best, bestScore := -1, float32(0)
+		for i := range items {
+			if selected[i] || (options.LabelCap > 0 && !underCap(labels[i], labelCount, options.LabelCap)) {
+				continue
+			}
+			score := 1 - float32(i)/float32(len(items))
+			if similarity != nil {
+				score = options.DiversityLambda*score - (1-options.DiversityLambda)*maxSimilarities[i]
+			}
+			if best == -1 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best == -1 {
+			break
+		}
+		selected[best] = true
+		results = append(results, items[best])
+		if labels != nil {
+			labels[best].Each(func(label string) bool {
+				labelCount[label]++
+				return true
+			})
+		}
+		if similarity != nil {
+			for i := range items {
+				if !selected[i] {
+					if sim := similarity(i, best); sim > maxSimilarities[i] {
+						maxSimilarities[i] = sim
+					}
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+// loadLabels loads labels of items in a batch. Labels of items failed to load are empty.
+func (s *RestServer) loadLabels(items []string) []*strset.Set {
+	labels := make([]*strset.Set, len(items))
+	for i := range labels {
+		labels[i] = strset.New()
+	}
+	details, err := s.DataStore.BatchGetItems(items)
+	if err != nil {
+		base.Logger().Warn("failed to get items", zap.Error(err))
+		return labels
+	}
+	positions := make(map[string]int, len(items))
+	for i, itemId := range items {
+		positions[itemId] = i
+	}
+	for _, item := range details {
+		if i, exist := positions[item.ItemId]; exist {
+			labels[i] = strset.New(item.Labels...)
+		}
+	}
+	return labels
+}
+
+// loadSimilarities loads similar items of items. Similarities are normalized by the max similarity of each item.
+func (s *RestServer) loadSimilarities(items []string) ([]map[string]float32, error) {
+	similarities := make([]map[string]float32, len(items))
+	for i, itemId := range items {
+		similarItems, err := s.CacheStore.GetScores(cache.SimilarItems, itemId, 0, s.GorseConfig.Database.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		similarities[i] = make(map[string]float32, len(similarItems))
+		for _, item := range similarItems {
+			if similarItems[0].Score > 0 {
+				similarities[i][item.ItemId] = item.Score / similarItems[0].Score
+			}
+		}
+	}
+	return similarities, nil
+}
+
+func underCap(labels *strset.Set, labelCount map[string]int, labelCap int) bool {
+	under := true
+	labels.Each(func(label string) bool {
+		under = labelCount[label] < labelCap
+		return under
+	})
+	return under
+}
+
+func jaccard(a, b *strset.Set) float32 {
+	union := strset.Union(a, b).Size()
+	if union == 0 {
+		return 0
+	}
+	return float32(strset.Intersection(a, b).Size()) / float32(union)
+}
@@ -15,18 +15,23 @@
 package server
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/araddon/dateparse"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/scylladb/go-set"
 	"net/http"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/pr"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 	"go.uber.org/zap"
@@ -40,6 +45,87 @@ type RestServer struct {
 	HttpPort    int
 	EnableAuth  bool
 	WebService  *restful.WebService
+
+	// personal ranking model
+	prModel      pr.Model
+	prModelMutex sync.RWMutex
+
+	// sequential model
+	sequentialModel      pr.Model
+	sequentialModelMutex sync.RWMutex
+
+	// workers in the cluster
+	workerRing      *base.ConsistentHash
+	workerRingMutex sync.RWMutex
+
+	// cached business rules
+	rules         []data.Rule
+	rulesLoadTime time.Time
+	rulesMutex    sync.Mutex
+
+	// impressions written in background
+	impressionChan chan []data.Impression
+	impressionOnce sync.Once
+}
+
+// SetPRModel sets the personal ranking model used to score items.
+func (s *RestServer) SetPRModel(prModel pr.Model) {
+	s.prModelMutex.Lock()
+	defer s.prModelMutex.Unlock()
+	s.prModel = prModel
+}
+
+// getPRModel gets the personal ranking model. Models are never modified once set, so they are
+// used without holding the lock.
+func (s *RestServer) getPRModel() pr.Model {
+	s.prModelMutex.RLock()
+	defer s.prModelMutex.RUnlock()
+	return s.prModel
+}
+
+// SetSequentialModel sets the model used by the sequential recommendation source.
+func (s *RestServer) SetSequentialModel(sequentialModel pr.Model) {
+	s.sequentialModelMutex.Lock()
+	defer s.sequentialModelMutex.Unlock()
+	s.sequentialModel = sequentialModel
+}
+
+// getSequentialModel gets the sequential model, which is used without holding the lock as well.
+func (s *RestServer) getSequentialModel() pr.Model {
+	s.sequentialModelMutex.RLock()
+	defer s.sequentialModelMutex.RUnlock()
+	return s.sequentialModel
+}
+
+// SetWorkers sets workers in the cluster. Active users are published to queues of workers
+// they are assigned to.
+func (s *RestServer) SetWorkers(workers []string) {
+	ring := base.NewConsistentHash(workers...)
+	s.workerRingMutex.Lock()
+	defer s.workerRingMutex.Unlock()
+	s.workerRing = ring
+}
+
+// notifyActiveUsers publishes users to queues of workers they are assigned to by consistent
+// hashing, so that recommendations are refreshed by their owners. Failures are logged only
+// since feedback has been committed.
+func (s *RestServer) notifyActiveUsers(users []string) {
+	s.workerRingMutex.RLock()
+	ring := s.workerRing
+	s.workerRingMutex.RUnlock()
+	queues := make(map[string][]string)
+	if ring != nil {
+		for _, userId := range users {
+			if worker := ring.Get(userId); worker != "" {
+				queues[worker] = append(queues[worker], userId)
+			}
+		}
+	}
+	for worker, workingUsers := range queues {
+		if err := s.CacheStore.PushQueue(cache.ActiveUsersQueue(worker), cache.MaxActiveUsers, workingUsers...); err != nil {
+			base.Logger().Error("failed to publish active users", zap.String("worker", worker), zap.Error(err))
+		}
+	}
 }
 
 func (s *RestServer) StartHttpServer() {
@@ -234,15 +320,14 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]string{}))
 	// Get subscribe items
-	//ws.Route(ws.GET("/intermediate/subscribe/{user-id}").To(s.getSubscribe).
-	//	Doc("get subscribe items for a user").
-	//	Metadata(restfulspec.KeyOpenAPITags, []string{"intermediate"}).
-	//	Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
-	//	Param(ws.QueryParameter("user-id", "identifier of the user").DataType("string")).
-	//	Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
-	//	Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
-	//	Param(ws.QueryParameter("return", "return type (id/detail)").DataType("string")).
-	//	Writes([]string{}))
+	ws.Route(ws.GET("/intermediate/subscribe/{user-id}").To(s.getSubscribe).
+		Doc("get subscribe items for a user").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"intermediate"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("begin", "begin of the list").DataType("int")).
+		Param(ws.QueryParameter("end", "end of the list").DataType("int")).
+		Writes([]cache.ScoredItem{}))
 
 	/* Rank recommendation */
 
@@ -285,15 +370,76 @@ func (s *RestServer) CreateWebService() {
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
 		Param(ws.QueryParameter("offset", "offset of the list").DataType("int")).
 		Writes([]string{}))
+	ws.Route(ws.GET("/neighbors/user/{user-id}").To(s.getUserNeighbors).
+		Doc("Get similar users of a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("begin", "begin of the list").DataType("int")).
+		Param(ws.QueryParameter("end", "end of the list").DataType("int")).
+		Writes([]cache.ScoredItem{}))
 	ws.Route(ws.GET("/recommend/{user-id}").To(s.getRecommend).
-		Doc("Get recommendation for user.").
+		Doc("Get recommendation for user. The request is identified by the X-Request-Id header and the experiment variant of the user is returned in the X-Variant-Id header.").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
 		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
 		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
 		Param(ws.QueryParameter("write-back", "write recommendation back to feedback").DataType("string")).
 		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
+		Param(ws.QueryParameter("diversity", "diversity re-ranking method (none/similarity/label)").DataType("string")).
+		Param(ws.QueryParameter("diversity-lambda", "trade-off between relevance and diversity").DataType("number")).
+		Param(ws.QueryParameter("label-cap", "max number of items per label").DataType("int")).
+		Param(ws.QueryParameter("explain", "return explanations of items if true").DataType("boolean")).
 		Writes([]string{}))
 
+	/* Business rules */
+
+	// Insert a rule
+	ws.Route(ws.POST("/rule").To(s.insertRule).
+		Doc("Insert a business rule.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Reads(data.Rule{}).
+		Writes(Success{}))
+	// Get rules
+	ws.Route(ws.GET("/rules").To(s.getRules).
+		Doc("Get business rules.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Writes([]data.Rule{}))
+	// Delete a rule
+	ws.Route(ws.DELETE("/rule/{rule-id}").To(s.deleteRule).
+		Doc("Delete a business rule.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rule"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("rule-id", "identifier of the rule").DataType("string")).
+		Writes(Success{}))
+
+	// Get following feed
+	ws.Route(ws.GET("/following/{user-id}").To(s.getFollowing).
+		Doc("Get fresh items from subscriptions of a user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
+		Writes([]string{}))
+	// Onboard a new user
+	ws.Route(ws.POST("/onboard/{user-id}").To(s.onboard).
+		Doc("Submit interests of a new user as labels and get recommendation for the user.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Param(ws.QueryParameter("n", "number of returned items").DataType("int")).
+		Reads([]string{}).
+		Writes([]string{}))
+	// Score candidates for a user
+	ws.Route(ws.POST("/score/{user-id}").To(s.score).
+		Doc("Score candidate items for a user by the personal ranking model.").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"recommendation"}).
+		Param(ws.HeaderParameter("X-API-Key", "secret key for RESTful API")).
+		Param(ws.PathParameter("user-id", "identifier of the user").DataType("string")).
+		Reads([]string{}).
+		Writes([]cache.ScoredItem{}))
+
 	/* Interaction with measurements */
 
 	ws.Route(ws.GET("/measurements/{name}").To(s.getMeasurements).
@@ -304,6 +450,15 @@ func (s *RestServer) CreateWebService() {
 		Writes([]data.Measurement{}))
 }
 
+// NewRequestId generates a random identifier for a request.
+func NewRequestId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
 func ParseInt(request *restful.Request, name string, fallback int) (value int, err error) {
 	valueString := request.QueryParameter(name)
 	value, err = strconv.Atoi(valueString)
@@ -314,6 +469,15 @@ func ParseInt(request *restful.Request, name string, fallback int) (value int, e
 	return
 }
 
+func ParseFloat32(request *restful.Request, name string, fallback float32) (float32, error) {
+	valueString := request.QueryParameter(name)
+	if valueString == "" {
+		return fallback, nil
+	}
+	value, err := strconv.ParseFloat(valueString, 32)
+	return float32(value), err
+}
+
 func (s *RestServer) getList(prefix string, name string, request *restful.Request, response *restful.Response) {
 	var begin, end int
 	var err error
@@ -416,6 +580,17 @@ func (s *RestServer) getNeighbors(request *restful.Request, response *restful.Re
 	s.getList(cache.SimilarItems, itemId, request, response)
 }
 
+// getUserNeighbors gets similar users of a user from database.
+func (s *RestServer) getUserNeighbors(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	// Get user id
+	userId := request.PathParameter("user-id")
+	s.getList(cache.SimilarUsers, userId, request, response)
+}
+
 // getSubscribe gets subscribed items of a user from database.
 func (s *RestServer) getSubscribe(request *restful.Request, response *restful.Response) {
 	// Authorize
@@ -449,133 +624,47 @@ func (s *RestServer) InsertFeedbackTwice(feedback data.Feedback, insertUser, ins
 	return s.CacheStore.AppendList(cache.IgnoreItems, feedback.UserId, feedback.ItemId)
 }
 
-// Recommend items to users.
-// 1. If there are recommendations in cache, return cached recommendations.
-// 2. If there are historical interactions of the users, return similar items.
-// 3. Otherwise, return fallback recommendation (popular/latest).
-func (s *RestServer) Recommend(userId string, n int) ([]string, error) {
-	var err error
-	var knnTime, fallbackTime, loadArchReadTime, removeReadTime time.Duration
-
-	// 1. read recommendations in cache.
-	start := time.Now()
-	itemsChan := make(chan []string, 1)
-	errChan := make(chan error, 1)
-	go func() {
-		var collaborativeFilteringItems []cache.ScoredItem
-		collaborativeFilteringItems, err = s.CacheStore.GetScores(cache.CollaborativeItems, userId, 0, s.GorseConfig.Database.CacheSize)
-		if err != nil {
-			itemsChan <- nil
-			errChan <- err
-		} else {
-			itemsChan <- cache.RemoveScores(collaborativeFilteringItems)
-			errChan <- nil
-			if len(collaborativeFilteringItems) == 0 {
-				base.Logger().Warn("empty collaborative filtering", zap.String("user_id", userId))
-			}
-		}
-	}()
-
-	// 0. load ignore items
-	loadCachedReadStart := time.Now()
-	ignoreItems, err := s.CacheStore.GetList(cache.IgnoreItems, userId)
-	excludeSet := set.NewStringSet()
-	for _, item := range ignoreItems {
-		excludeSet.Add(item)
-	}
-	loadCachedReadTime := time.Since(loadCachedReadStart)
-
-	// *. remove ignore items
-	items := <-itemsChan
-	err = <-errChan
-	if err != nil {
-		return nil, err
+// updateSessions puts items in feedback into sessions of users. Only the most recent
+// items are kept in a session.
+func (s *RestServer) updateSessions(feedback []data.Feedback) error {
+	if s.GorseConfig.Recommend.SessionSize <= 0 {
+		return nil
 	}
-	results := make([]string, 0, len(items))
-	removeReadStart := time.Now()
-	for _, itemId := range items {
-		if !excludeSet.Has(itemId) {
-			results = append(results, itemId)
+	// keep positive feedback only
+	positiveTypes := set.NewStringSet(s.GorseConfig.Database.PositiveFeedbackType...)
+	sortedFeedback := make([]data.Feedback, 0, len(feedback))
+	for _, v := range feedback {
+		if positiveTypes.Size() == 0 || positiveTypes.Has(v.FeedbackType) {
+			sortedFeedback = append(sortedFeedback, v)
 		}
 	}
-	removeReadTime += time.Since(removeReadStart)
-
-	// 2. return similar items
-	if len(results) < n {
-		// load historical feedback
-		loadArchReadStart := time.Now()
-		userFeedback, err := s.DataStore.GetUserFeedback(userId, nil)
-		if err != nil {
-			return nil, err
-		}
-		for _, feedback := range userFeedback {
-			excludeSet.Add(feedback.ItemId)
-		}
-		loadArchReadTime = time.Since(loadArchReadStart)
-		knnStart := time.Now()
-		// collect candidates
-		candidates := make(map[string]float32)
-		for _, feedback := range userFeedback {
-			// load similar items
-			similarItems, err := s.CacheStore.GetScores(cache.SimilarItems, feedback.ItemId, 0, s.GorseConfig.Database.CacheSize)
-			if err != nil {
-				return nil, err
+	// group items by users in time order
+	sort.SliceStable(sortedFeedback, func(i, j int) bool {
+		return sortedFeedback[i].Timestamp.Before(sortedFeedback[j].Timestamp)
+	})
+	userItems := make(map[string][]string)
+	for _, v := range sortedFeedback {
+		userItems[v.UserId] = append(userItems[v.UserId], v.ItemId)
+	}
+	// push new items ahead of sessions
+	for userId, itemIds := range userItems {
+		// keep the latest occurrence of each item
+		itemSet := set.NewStringSet()
+		distinctItems := make([]string, 0, len(itemIds))
+		for i := len(itemIds) - 1; i >= 0; i-- {
+			if !itemSet.Has(itemIds[i]) {
+				itemSet.Add(itemIds[i])
+				distinctItems = append(distinctItems, itemIds[i])
 			}
-			// add unseen items
-			removeReadStart = time.Now()
-			for _, item := range similarItems {
-				if !excludeSet.Has(item.ItemId) {
-					candidates[item.ItemId] += item.Score
-				}
-			}
-			removeReadTime += time.Since(removeReadStart)
 		}
-		// collect top k
-		k := n - len(results)
-		filter := base.NewTopKStringFilter(k)
-		for id, score := range candidates {
-			filter.Push(id, score)
+		for i, j := 0, len(distinctItems)-1; i < j; i, j = i+1, j-1 {
+			distinctItems[i], distinctItems[j] = distinctItems[j], distinctItems[i]
 		}
-		ids, _ := filter.PopAll()
-		results = append(results, ids...)
-		knnTime = time.Since(knnStart)
-	}
-
-	// 3. return fallback recommendation
-	if len(results) < n {
-		fallbackStart := time.Now()
-		var fallbacks []cache.ScoredItem
-		switch s.GorseConfig.Recommend.FallbackRecommend {
-		case "latest":
-			fallbacks, err = s.CacheStore.GetScores(cache.LatestItems, "", 0, s.GorseConfig.Database.CacheSize)
-		case "popular":
-			fallbacks, err = s.CacheStore.GetScores(cache.PopularItems, "", 0, s.GorseConfig.Database.CacheSize)
-		default:
-			return nil, fmt.Errorf("unknown fallback recommendation method `%s`", s.GorseConfig.Recommend.FallbackRecommend)
+		if err := s.CacheStore.PushList(cache.SessionItems, userId, s.GorseConfig.Recommend.SessionSize, distinctItems...); err != nil {
+			return err
 		}
-		removeReadStart = time.Now()
-		for _, item := range fallbacks {
-			if !excludeSet.Has(item.ItemId) {
-				results = append(results, item.ItemId)
-			}
-		}
-		removeReadTime += time.Since(removeReadStart)
-		fallbackTime = time.Since(fallbackStart)
-	}
-
-	// return recommendations
-	if len(results) > n {
-		results = results[:n]
 	}
-	spent := time.Since(start)
-	base.Logger().Info("complete recommendation",
-		zap.Duration("load_cache_read_time", loadCachedReadTime),
-		zap.Duration("load_arch_read_time", loadArchReadTime),
-		zap.Duration("remove_read_time", removeReadTime),
-		zap.Duration("knn_time", knnTime),
-		zap.Duration("fallback_time", fallbackTime),
-		zap.Duration("total_time", spent))
-	return results, nil
+	return nil
 }
 
 func (s *RestServer) getRecommend(request *restful.Request, response *restful.Response) {
@@ -591,11 +680,48 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 		return
 	}
 	writeBackFeedback := request.QueryParameter("write-back")
-	results, err := s.Recommend(userId, n)
+	explain := request.QueryParameter("explain") == "true"
+	options := s.NewRecommendOptions(userId)
+	if diversity := request.QueryParameter("diversity"); diversity != "" {
+		switch diversity {
+		case NoDiversity, SimilarityDiversity, LabelDiversity:
+			options.Diversity = diversity
+		default:
+			BadRequest(response, fmt.Errorf("unknown diversity method `%s`", diversity))
+			return
+		}
+	}
+	if options.DiversityLambda, err = ParseFloat32(request, "diversity-lambda", options.DiversityLambda); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if options.LabelCap, err = ParseInt(request, "label-cap", options.LabelCap); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	results, ctx, err := s.recommend(userId, n, options)
 	if err != nil {
 		InternalServerError(response, err)
 		return
 	}
+	// log impressions
+	requestId := NewRequestId()
+	if s.GorseConfig.Server.ImpressionLog {
+		timestamp := time.Now()
+		impressions := make([]data.Impression, len(results))
+		for i, itemId := range results {
+			impressions[i] = data.Impression{
+				RequestId: requestId,
+				UserId:    userId,
+				ItemId:    itemId,
+				Position:  i + 1,
+				Source:    ctx.sources[itemId],
+				Variant:   options.Variant,
+				Timestamp: timestamp,
+			}
+		}
+		s.logImpressions(impressions)
+	}
 	// write back
 	if writeBackFeedback != "" {
 		for _, itemId := range results {
@@ -614,6 +740,161 @@ func (s *RestServer) getRecommend(request *restful.Request, response *restful.Re
 		}
 	}
 	// Send result
+	response.AddHeader("X-Request-Id", requestId)
+	if options.Variant != "" {
+		response.AddHeader("X-Variant-Id", options.Variant)
+	}
+	if explain {
+		Ok(response, ctx.explain(results))
+		return
+	}
+	Ok(response, results)
+}
+
+// onboard saves interests of a user as labels and recommends items to the user by cold-start
+// recommendation, which falls back to the fallback recommendation.
+func (s *RestServer) onboard(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	// parse arguments
+	userId := request.PathParameter("user-id")
+	n, err := ParseInt(request, "n", s.GorseConfig.Server.DefaultN)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	var interests []string
+	if err = request.ReadEntity(&interests); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// merge interests into user labels
+	user, err := s.DataStore.GetUser(userId)
+	if err != nil {
+		if err.Error() != data.ErrUserNotExist {
+			InternalServerError(response, err)
+			return
+		}
+		user = data.User{UserId: userId}
+	}
+	labels := set.NewStringSet(user.Labels...)
+	for _, interest := range interests {
+		if !labels.Has(interest) {
+			labels.Add(interest)
+			user.Labels = append(user.Labels, interest)
+		}
+	}
+	if err = s.DataStore.InsertUser(user); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	// recommend by interests
+	options := s.NewRecommendOptions(userId)
+	options.Rank = NoneRank
+	options.Pipeline = []config.StageConfig{
+		{Source: ColdStartSource},
+		{Source: s.GorseConfig.Recommend.FallbackRecommend},
+	}
+	results, err := s.Recommend(userId, n, options)
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, results)
+}
+
+// score scores candidate items for a user by the personal ranking model pulled from the master.
+// Items are sorted by scores in descending order and items unknown to the model are omitted. Users
+// unknown to the model are folded in by their positive feedback if the model supports it.
+func (s *RestServer) score(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	// parse arguments
+	userId := request.PathParameter("user-id")
+	var itemIds []string
+	if err := request.ReadEntity(&itemIds); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// load personal ranking model
+	mf, ok := s.getPRModel().(pr.MatrixFactorization)
+	if !ok || mf.GetUserIndex() == nil || mf.GetItemIndex() == nil {
+		ServiceUnavailable(response, fmt.Errorf("matrix factorization model not available"))
+		return
+	}
+	userIndex := mf.GetUserIndex().ToNumber(userId)
+	var userFactor []float32
+	if userIndex == base.NotId {
+		// fold in a new user by positive feedback
+		if foldIn, ok := mf.(pr.FoldIn); ok {
+			var itemIndices []int
+			for i := range s.GorseConfig.Database.PositiveFeedbackType {
+				feedback, err := s.DataStore.GetUserFeedback(userId, &s.GorseConfig.Database.PositiveFeedbackType[i])
+				if err != nil {
+					InternalServerError(response, err)
+					return
+				}
+				for _, f := range feedback {
+					if itemIndex := mf.GetItemIndex().ToNumber(f.ItemId); itemIndex != base.NotId {
+						itemIndices = append(itemIndices, itemIndex)
+					}
+				}
+			}
+			userFactor = foldIn.FoldIn(itemIndices)
+		}
+		if userFactor == nil {
+			PageNotFound(response, fmt.Errorf("user %v not found in personal ranking model", userId))
+			return
+		}
+	}
+	// score candidates
+	results := make([]cache.ScoredItem, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		itemIndex := mf.GetItemIndex().ToNumber(itemId)
+		if itemIndex == base.NotId {
+			continue
+		}
+		var score float32
+		if userFactor != nil {
+			score = mf.(pr.FoldIn).PredictByFactor(userFactor, itemIndex)
+		} else {
+			score = mf.InternalPredict(userIndex, itemIndex)
+		}
+		results = append(results, cache.ScoredItem{ItemId: itemId, Score: score})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	Ok(response, results)
+}
+
+// getFollowing gets fresh items from subscriptions of a user, which are filtered by read items
+// and business rules like other recommendations.
+func (s *RestServer) getFollowing(request *restful.Request, response *restful.Response) {
+	// authorize
+	if !s.auth(request, response) {
+		return
+	}
+	// parse arguments
+	userId := request.PathParameter("user-id")
+	n, err := ParseInt(request, "n", s.GorseConfig.Server.DefaultN)
+	if err != nil {
+		BadRequest(response, err)
+		return
+	}
+	// recommend by subscriptions
+	options := s.NewRecommendOptions(userId)
+	options.Rank = NoneRank
+	options.Pipeline = []config.StageConfig{{Source: SubscribeSource}}
+	results, err := s.Recommend(userId, n, options)
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
 	Ok(response, results)
 }
 
@@ -923,6 +1204,12 @@ func (s *RestServer) insertFeedback(request *restful.Request, response *restful.
 			return
 		}
 	}
+	// update sessions (failures are logged only since feedback has been committed)
+	if err = s.updateSessions(feedback); err != nil {
+		base.Logger().Warn("failed to update sessions", zap.Error(err))
+	}
+	// notify workers to refresh recommendations
+	s.notifyActiveUsers(users.List())
 	Ok(response, Success{RowAffected: len(feedback)})
 }
 
@@ -1057,6 +1344,55 @@ func (s *RestServer) getMeasurements(request *restful.Request, response *restful
 	Ok(response, measurements)
 }
 
+func (s *RestServer) insertRule(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	var rule data.Rule
+	if err := request.ReadEntity(&rule); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if err := ValidateRule(rule); err != nil {
+		BadRequest(response, err)
+		return
+	}
+	if err := s.DataStore.InsertRule(rule); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	s.invalidateRules()
+	Ok(response, Success{RowAffected: 1})
+}
+
+func (s *RestServer) getRules(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	rules, err := s.DataStore.GetRules()
+	if err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	Ok(response, rules)
+}
+
+func (s *RestServer) deleteRule(request *restful.Request, response *restful.Response) {
+	// Authorize
+	if !s.auth(request, response) {
+		return
+	}
+	ruleId := request.PathParameter("rule-id")
+	if err := s.DataStore.DeleteRule(ruleId); err != nil {
+		InternalServerError(response, err)
+		return
+	}
+	s.invalidateRules()
+	Ok(response, Success{RowAffected: 1})
+}
+
 func BadRequest(response *restful.Response, err error) {
 	response.Header().Set("Access-Control-Allow-Origin", "*")
 	base.Logger().Error("bad request", zap.Error(err))
@@ -1073,6 +1409,14 @@ func InternalServerError(response *restful.Response, err error) {
 	}
 }
 
+func ServiceUnavailable(response *restful.Response, err error) {
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	base.Logger().Warn("service unavailable", zap.Error(err))
+	if err = response.WriteError(503, err); err != nil {
+		base.Logger().Error("failed to write error", zap.Error(err))
+	}
+}
+
 func PageNotFound(response *restful.Response, err error) {
 	response.Header().Set("Access-Control-Allow-Origin", "*")
 	if err := response.WriteError(400, err); err != nil {
@@ -16,6 +16,7 @@ package server
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
@@ -23,7 +24,10 @@ import (
 	"github.com/emicklei/go-restful/v3"
 	"github.com/steinfletcher/apitest"
 	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/pr"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
 )
@@ -143,7 +147,7 @@ func TestServer_Users(t *testing.T) {
 		Get("/api/user/0").
 		Header("X-API-Key", apiKey).
 		Expect(t).
-		Status(http.StatusInternalServerError).
+		Status(http.StatusBadRequest).
 		End()
 }
 
@@ -241,6 +245,7 @@ func TestServer_Items(t *testing.T) {
 func TestServer_Feedback(t *testing.T) {
 	s := newMockServer(t)
 	defer s.Close(t)
+	s.server.SetWorkers([]string{"worker_0", "worker_1"})
 	// Insert ret
 	feedback := []data.Feedback{
 		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "0"}},
@@ -259,6 +264,21 @@ func TestServer_Feedback(t *testing.T) {
 		Status(http.StatusOK).
 		Body(`{"RowAffected": 5}`).
 		End()
+	// active users are published to their workers
+	ring := base.NewConsistentHash("worker_0", "worker_1")
+	activeUsers := make([]string, 0)
+	for _, worker := range []string{"worker_0", "worker_1"} {
+		for {
+			userId, err := s.cacheStoreClient.PopQueue(cache.ActiveUsersQueue(worker))
+			if err == cache.ErrObjectNotExist {
+				break
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, worker, ring.Get(userId))
+			activeUsers = append(activeUsers, userId)
+		}
+	}
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4"}, activeUsers)
 	//Get Feedback
 	apitest.New().
 		Handler(s.handler).
@@ -337,12 +357,13 @@ func TestServer_List(t *testing.T) {
 	}
 	operators := []ListOperator{
 		{cache.CollaborativeItems, "0", "/api/intermediate/recommend/0"},
-		//{cache.SubscribeItems, "0", "/subscribe/0"},
+		{cache.SubscribeItems, "0", "/api/intermediate/subscribe/0"},
 		{cache.LatestItems, "", "/api/latest/"},
 		{cache.LatestItems, "0", "/api/latest/0"},
 		{cache.PopularItems, "", "/api/popular/"},
 		{cache.PopularItems, "0", "/api/popular/0"},
 		{cache.SimilarItems, "0", "/api/neighbors/0"},
+		{cache.SimilarUsers, "0", "/api/neighbors/user/0"},
 	}
 
 	for _, operator := range operators {
@@ -665,3 +686,817 @@ func TestServer_GetRecommends_Fallback_NonPersonalized(t *testing.T) {
 		Status(http.StatusInternalServerError).
 		End()
 }
+
+func TestServer_GetRecommends_Session(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.SessionSize = 2
+	s.server.GorseConfig.Recommend.SessionWeight = 0.5
+	s.server.GorseConfig.Database.PositiveFeedbackType = []string{"click"}
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}, {"5", 95}})
+	assert.Nil(t, err)
+	// insert similar items
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "10", []cache.ScoredItem{{"20", 2}, {"21", 1}})
+	assert.Nil(t, err)
+	// insert feedback
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]Feedback{
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "12"}, Timestamp: "2021-01-03"},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "11"}, Timestamp: "2021-01-01"},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "10"}, Timestamp: "2021-01-02"},
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "13"}, Timestamp: "2021-01-04"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 4}`).
+		End()
+	sessionItems, err := s.cacheStoreClient.GetList(cache.SessionItems, "0")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"12", "10"}, sessionItems)
+	// blend session-based recommendation
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "20", "2", "3"})).
+		End()
+	// disable session-based recommendation
+	s.server.GorseConfig.Recommend.SessionWeight = 0
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3", "4"})).
+		End()
+}
+
+func TestServer_InsertFeedback_SessionFailure(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.SessionSize = 2
+	// break the session of the user
+	err := s.cacheStoreClient.SetString(cache.SessionItems, "0", "broken")
+	assert.Nil(t, err)
+	// feedback is committed regardless of sessions
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]Feedback{
+			{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "1"}, Timestamp: "2021-01-01"},
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	feedback, err := s.dataStoreClient.GetUserFeedback("0", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(feedback))
+}
+
+func TestServer_GetRecommends_Sequential(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// set sequential model
+	fpmc := pr.NewFPMC(model.Params{model.NFactors: 1})
+	fpmc.UserIndex = base.NewMapIndex()
+	fpmc.UserIndex.Add("9")
+	fpmc.ItemIndex = base.NewMapIndex()
+	fpmc.ItemIndex.Add("1")
+	fpmc.ItemIndex.Add("2")
+	fpmc.ItemIndex.Add("3")
+	fpmc.UserFactor = [][]float32{{1}}
+	fpmc.ItemFactor = [][]float32{{0}, {0}, {0}}
+	fpmc.NextItemFactor = [][]float32{{1}, {2}, {3}}
+	fpmc.PrevItemFactor = [][]float32{{1}, {-1}, {0}}
+	fpmc.LastItems = []int{0}
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{{Source: "sequential"}}
+	err := s.cacheStoreClient.AppendList(cache.SessionItems, "0", "2", "1")
+	assert.Nil(t, err)
+	// candidates are cached items and neighbors of recent items
+	err = s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0", []cache.ScoredItem{{"1", 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "1", []cache.ScoredItem{{"2", 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "2", []cache.ScoredItem{{"3", 1}, {"4", 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.CollaborativeItems, "9", []cache.ScoredItem{{"2", 1}, {"3", 1}})
+	assert.Nil(t, err)
+	// the personal ranking model isn't used by the sequential source
+	s.server.SetPRModel(fpmc)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{})).
+		End()
+	// recommend after the most recent item in session
+	s.server.SetSequentialModel(fpmc)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+	// recommend after the last item in training (items out of candidates aren't scored)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/9").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"3", "2"})).
+		End()
+}
+
+func TestServer_GetRecommends_Pipeline(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.PopularItems, "",
+		[]cache.ScoredItem{{"1", 99}, {"5", 95}, {"6", 94}, {"7", 93}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.TrendingItems, "",
+		[]cache.ScoredItem{{"8", 92}, {"9", 91}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.PopularItems, "a",
+		[]cache.ScoredItem{{"10", 3}, {"11", 2}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.PopularItems, "b",
+		[]cache.ScoredItem{{"12", 4}, {"11", 3}})
+	assert.Nil(t, err)
+	// insert session
+	err = s.dataStoreClient.BatchInsertItem([]data.Item{
+		{ItemId: "20", Labels: []string{"a", "b"}},
+		{ItemId: "21", Labels: []string{"a"}},
+	})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.AppendList(cache.SessionItems, "0", "20", "21")
+	assert.Nil(t, err)
+	// fill by quotas
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{
+		{Source: "collaborative", Quota: 2},
+		{Source: "popular", Quota: 2},
+		{Source: "trending"},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "5", "6", "8"})).
+		End()
+	// merge by weights
+	s.server.GorseConfig.Recommend.Rank = "weighted"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{
+		{Source: "collaborative", Weight: 1},
+		{Source: "popular", Weight: 1},
+		{Source: "label_popular"},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "9",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "5", "3", "6", "4", "7", "11", "10"})).
+		End()
+	// unknown rank
+	s.server.GorseConfig.Recommend.Rank = "unknown"
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusInternalServerError).
+		End()
+}
+
+func TestServer_GetRecommends_Diversity(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.SessionWeight = 0
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}, {"5", 95}, {"6", 94}})
+	assert.Nil(t, err)
+	err = s.dataStoreClient.BatchInsertItem([]data.Item{
+		{ItemId: "1", Labels: []string{"a"}},
+		{ItemId: "2", Labels: []string{"a"}},
+		{ItemId: "3", Labels: []string{"a"}},
+		{ItemId: "4", Labels: []string{"b"}},
+		{ItemId: "5", Labels: []string{"b"}},
+		{ItemId: "6", Labels: []string{"c"}},
+	})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "1", []cache.ScoredItem{{"2", 10}, {"3", 5}})
+	assert.Nil(t, err)
+	// label cap
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":         "4",
+			"label-cap": "2",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "4", "5"})).
+		End()
+	// label diversity
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":                "3",
+			"diversity":        "label",
+			"diversity-lambda": "0.5",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "4", "6"})).
+		End()
+	// similarity diversity from config
+	s.server.GorseConfig.Recommend.Diversity = "similarity"
+	s.server.GorseConfig.Recommend.DiversityLambda = 0.5
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "4", "5"})).
+		End()
+	// override by request
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":         "3",
+			"diversity": "none",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "3"})).
+		End()
+	// invalid arguments
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"diversity-lambda": "abc",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"diversity": "unknown",
+		}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func TestServer_Rules(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.SessionWeight = 0
+	// insert recommendation
+	for _, userId := range []string{"0", "1"} {
+		err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, userId,
+			[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}, {"4", 96}, {"5", 95}, {"6", 94}})
+		assert.Nil(t, err)
+	}
+	now := time.Now()
+	err := s.dataStoreClient.BatchInsertItem([]data.Item{
+		{ItemId: "1", Timestamp: now, Labels: []string{"a"}},
+		{ItemId: "2", Timestamp: now, Labels: []string{"b"}},
+		{ItemId: "3", Timestamp: now, Labels: []string{"a"}},
+		{ItemId: "4", Timestamp: now.AddDate(-1, 0, 0), Labels: []string{"c"}},
+		{ItemId: "5", Timestamp: now, Labels: []string{"b"}},
+		{ItemId: "6", Timestamp: now, Labels: []string{"c"}},
+	})
+	assert.Nil(t, err)
+	err = s.dataStoreClient.InsertUser(data.User{UserId: "0", Labels: []string{"vip"}})
+	assert.Nil(t, err)
+	// insert rules
+	rules := []data.Rule{
+		{RuleId: "boost-c", Action: "boost", ItemLabels: []string{"c"}, UserLabels: []string{"vip"}, Boost: 3},
+		{RuleId: "expired", Action: "filter", ItemId: "2", End: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{RuleId: "filter-a", Action: "filter", ItemLabels: []string{"a"}},
+		{RuleId: "pin-9", Action: "pin", ItemId: "9", Position: 2},
+	}
+	for _, rule := range rules {
+		apitest.New().
+			Handler(s.handler).
+			Post("/api/rule").
+			Header("X-API-Key", apiKey).
+			JSON(rule).
+			Expect(t).
+			Status(http.StatusOK).
+			Body(`{"RowAffected": 1}`).
+			End()
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/rules").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, rules)).
+		End()
+	// invalid rule
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rule").
+		Header("X-API-Key", apiKey).
+		JSON(data.Rule{RuleId: "unknown", Action: "unknown"}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// apply rules
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"4", "9", "2", "6"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/1").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "9", "4", "5"})).
+		End()
+	// filter old items
+	apitest.New().
+		Handler(s.handler).
+		Delete("/api/rule/boost-c").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/rule").
+		Header("X-API-Key", apiKey).
+		JSON(data.Rule{RuleId: "filter-old", Action: "filter", MinAge: 30}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "9", "5", "6"})).
+		End()
+	// rules inserted via other nodes are cached until refreshed
+	err = s.dataStoreClient.InsertRule(data.Rule{RuleId: "filter-b", Action: "filter", ItemLabels: []string{"b"}})
+	assert.Nil(t, err)
+	cached, err := s.server.loadRules("0", now)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(cached))
+	s.server.rulesLoadTime = now.Add(-rulesRefreshInterval - time.Second)
+	cached, err = s.server.loadRules("0", now)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(cached))
+}
+
+func TestServer_GetRecommends_Experiment(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{{Source: "collaborative"}}
+	s.server.GorseConfig.Experiment = config.ExperimentConfig{
+		Name: "popular",
+		Salt: "salt",
+		Variants: []config.VariantConfig{
+			{Name: "control", Traffic: 0.5},
+			{Name: "treatment", Traffic: 0.5, Pipeline: []config.StageConfig{{Source: "popular"}}},
+		},
+	}
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.PopularItems, "",
+		[]cache.ScoredItem{{"5", 95}, {"6", 94}, {"7", 93}})
+	assert.Nil(t, err)
+	expected := map[string][]string{
+		"control":   {"1", "2", "3"},
+		"treatment": {"5", "6", "7"},
+	}
+	for i := 0; i < 10; i++ {
+		userId := strconv.Itoa(i)
+		err = s.cacheStoreClient.SetScores(cache.CollaborativeItems, userId,
+			[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}})
+		assert.Nil(t, err)
+		variant := s.server.GorseConfig.Experiment.Assign(userId).Name
+		apitest.New().
+			Handler(s.handler).
+			Get("/api/recommend/"+userId).
+			Header("X-API-Key", apiKey).
+			QueryParams(map[string]string{
+				"n": "3",
+			}).
+			Expect(t).
+			Status(http.StatusOK).
+			Header("X-Variant-Id", variant).
+			Body(marshal(t, expected[variant])).
+			End()
+	}
+}
+
+func TestServer_GetRecommends_Impression(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Server.ImpressionLog = true
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{
+		{Source: "collaborative", Quota: 2},
+		{Source: "popular"},
+	}
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"1", 99}, {"2", 98}, {"3", 97}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.PopularItems, "",
+		[]cache.ScoredItem{{"1", 99}, {"5", 95}})
+	assert.Nil(t, err)
+	result := apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "2", "5"})).
+		End()
+	requestId := result.Response.Header.Get("X-Request-Id")
+	assert.NotEmpty(t, requestId)
+	// check impressions written in background
+	var impressions []data.Impression
+	assert.Eventually(t, func() bool {
+		_, impressions, err = s.dataStoreClient.GetImpressions("", 100, nil)
+		return err == nil && len(impressions) == 3
+	}, 5*time.Second, 100*time.Millisecond)
+	for i := range impressions {
+		impressions[i].Timestamp = time.Time{}
+	}
+	assert.ElementsMatch(t, []data.Impression{
+		{RequestId: requestId, UserId: "0", ItemId: "1", Position: 1, Source: "collaborative"},
+		{RequestId: requestId, UserId: "0", ItemId: "2", Position: 2, Source: "collaborative"},
+		{RequestId: requestId, UserId: "0", ItemId: "5", Position: 3, Source: "popular"},
+	}, impressions)
+}
+
+func TestServer_GetRecommends_Explain(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{
+		{Source: "collaborative", Quota: 1},
+		{Source: "similar"},
+	}
+	// insert recommendation
+	err := s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"1", 99}, {"2", 98}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "10",
+		[]cache.ScoredItem{{"3", 0.9}, {"4", 0.5}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.SimilarItems, "11",
+		[]cache.ScoredItem{{"5", 0.8}, {"3", 0.3}})
+	assert.Nil(t, err)
+	// insert feedback
+	err = s.dataStoreClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "10"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "11"}},
+	}, true, true)
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n":       "3",
+			"explain": "true",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []Explanation{
+			{ItemId: "1", Source: "collaborative", Score: 99},
+			{ItemId: "3", Source: "similar", Score: 1.2, Contributors: []cache.ScoredItem{{"10", 0.9}, {"11", 0.3}}},
+			{ItemId: "5", Source: "similar", Score: 0.8, Contributors: []cache.ScoredItem{{"11", 0.8}}},
+		})).
+		End()
+}
+
+func TestServer_Onboard(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert popular items by user labels
+	err := s.cacheStoreClient.SetScores(cache.UserLabelPopularItems, "sports",
+		[]cache.ScoredItem{{"1", 5}, {"2", 3}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.UserLabelPopularItems, "music",
+		[]cache.ScoredItem{{"2", 4}, {"3", 1}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.LatestItems, "",
+		[]cache.ScoredItem{{"9", 10}, {"8", 9}})
+	assert.Nil(t, err)
+	// onboard a new user
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/onboard/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "4",
+		}).
+		JSON([]string{"sports", "music"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "1", "3", "9"})).
+		End()
+	// interests are merged into labels
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/onboard/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "2",
+		}).
+		JSON([]string{"sports", "movie"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "1"})).
+		End()
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/user/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, data.User{UserId: "0", Labels: []string{"sports", "music", "movie"}})).
+		End()
+	// cold-start recommendation in the default pipeline
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "1", "3"})).
+		End()
+}
+
+func TestServer_Following(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// insert subscribe items
+	err := s.cacheStoreClient.SetScores(cache.SubscribeItems, "0",
+		[]cache.ScoredItem{{"1", 100}, {"2", 99}, {"3", 98}})
+	assert.Nil(t, err)
+	err = s.cacheStoreClient.SetScores(cache.CollaborativeItems, "0",
+		[]cache.ScoredItem{{"4", 1}, {"5", 0.5}})
+	assert.Nil(t, err)
+	// insert feedback
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/feedback").
+		Header("X-API-Key", apiKey).
+		JSON([]data.Feedback{{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "0", ItemId: "2"}}}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(`{"RowAffected": 1}`).
+		End()
+	// following feed
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/following/0").
+		Header("X-API-Key", apiKey).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "3"})).
+		End()
+	// mix subscribe items into recommendation
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{
+		{Source: "subscribe", Quota: 1},
+		{Source: "collaborative"},
+	}
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"1", "4", "5"})).
+		End()
+}
+
+func TestServer_GetRecommends_SimilarUsers(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Database.PositiveFeedbackType = []string{"star"}
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{{Source: "similar_users"}}
+	// insert similar users
+	err := s.cacheStoreClient.SetScores(cache.SimilarUsers, "0",
+		[]cache.ScoredItem{{"1", 3}, {"2", 1}})
+	assert.Nil(t, err)
+	// insert feedback
+	err = s.dataStoreClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "0", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "1", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "1", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "1", ItemId: "3"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "4"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "2", ItemId: "3"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "2", ItemId: "5"}},
+	}, true, true)
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"3", "2", "5"})).
+		End()
+}
+
+func TestServer_GetRecommends_SimilarUsers_AllFeedback(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	s.server.GorseConfig.Database.PositiveFeedbackType = nil
+	s.server.GorseConfig.Recommend.Rank = "none"
+	s.server.GorseConfig.Recommend.Pipeline = []config.StageConfig{{Source: "similar_users"}}
+	// insert similar users
+	err := s.cacheStoreClient.SetScores(cache.SimilarUsers, "0",
+		[]cache.ScoredItem{{"1", 3}, {"2", 1}})
+	assert.Nil(t, err)
+	// insert feedback of any types
+	err = s.dataStoreClient.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "1", ItemId: "1"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "1", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "click", UserId: "2", ItemId: "2"}},
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "like", UserId: "2", ItemId: "3"}},
+	}, true, true)
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Get("/api/recommend/0").
+		Header("X-API-Key", apiKey).
+		QueryParams(map[string]string{
+			"n": "3",
+		}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []string{"2", "1", "3"})).
+		End()
+}
+
+func TestServer_Score(t *testing.T) {
+	s := newMockServer(t)
+	defer s.Close(t)
+	// model not available
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/alice").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"1", "2"}).
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		End()
+	// model not supported
+	s.server.SetPRModel(pr.NewKNN(nil))
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/alice").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"1", "2"}).
+		Expect(t).
+		Status(http.StatusServiceUnavailable).
+		End()
+	// set model
+	bpr := pr.NewBPR(model.Params{model.NFactors: 2})
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.UserIndex.Add("alice")
+	bpr.ItemIndex = base.NewMapIndex()
+	bpr.ItemIndex.Add("1")
+	bpr.ItemIndex.Add("2")
+	bpr.ItemIndex.Add("3")
+	bpr.UserFactor = [][]float32{{1, 2}}
+	bpr.ItemFactor = [][]float32{{1, 0}, {0, 1}, {1, 1}}
+	s.server.SetPRModel(bpr)
+	// score candidates
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/alice").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"1", "2", "3", "4"}).
+		Expect(t).
+		Status(http.StatusOK).
+		Body(marshal(t, []cache.ScoredItem{{"3", 3}, {"2", 2}, {"1", 1}})).
+		End()
+	// unknown user without feedback
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/bob").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"1"}).
+		Expect(t).
+		Status(http.StatusBadRequest).
+		End()
+	// fold in unknown user with feedback
+	s.server.GorseConfig.Database.PositiveFeedbackType = []string{"star"}
+	err := s.dataStoreClient.InsertFeedback(data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "bob", ItemId: "3"},
+		Timestamp:   time.Now(),
+	}, true, true)
+	assert.Nil(t, err)
+	apitest.New().
+		Handler(s.handler).
+		Post("/api/score/bob").
+		Header("X-API-Key", apiKey).
+		JSON([]string{"1"}).
+		Expect(t).
+		Status(http.StatusOK).
+		End()
+}
@@ -0,0 +1,241 @@
+// Copyright 2021 gorse Project Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/scylladb/go-set/strset"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"go.uber.org/zap"
+)
+
+// Actions of business rules.
+const (
+	FilterAction = "filter"
+	BoostAction  = "boost"
+	PinAction    = "pin"
+)
+
+// ValidateRule checks whether a rule is well-formed.
+func ValidateRule(rule data.Rule) error {
+	if rule.RuleId == "" {
+		return fmt.Errorf("rule id is required")
+	}
+	switch rule.Action {
+	case FilterAction:
+	case BoostAction:
+		if rule.Boost <= 0 {
+			return fmt.Errorf("boost factor of rule `%s` must be positive", rule.RuleId)
+		}
+	case PinAction:
+		if rule.ItemId == "" || rule.Position <= 0 {
+			return fmt.Errorf("pin rule `%s` requires an item and a positive position", rule.RuleId)
+		}
+	default:
+		return fmt.Errorf("unknown rule action `%s`", rule.Action)
+	}
+	return nil
+}
+
+// rulesRefreshInterval is the interval to reload rules from the data store. Rules inserted or
+// deleted via other nodes take effect after the interval.
+const rulesRefreshInterval = 10 * time.Second
+
+// cachedRules returns rules cached in the server. Rules are reloaded once they are older than
+// the refresh interval.
+func (s *RestServer) cachedRules() ([]data.Rule, error) {
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+	if s.rules == nil || time.Since(s.rulesLoadTime) > rulesRefreshInterval {
+		rules, err := s.DataStore.GetRules()
+		if err != nil {
+			return nil, err
+		}
+		if rules == nil {
+			rules = []data.Rule{}
+		}
+		s.rules, s.rulesLoadTime = rules, time.Now()
+	}
+	return s.rules, nil
+}
+
+// invalidateRules drops cached rules, so that rules are reloaded at the next request.
+func (s *RestServer) invalidateRules() {
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+	s.rules = nil
+}
+
+// loadRules loads rules in effect for a user at the moment.
+func (s *RestServer) loadRules(userId string, now time.Time) ([]data.Rule, error) {
+	rules, err := s.cachedRules()
+	if err != nil {
+		return nil, err
+	}
+	var userLabels *strset.Set
+	results := make([]data.Rule, 0, len(rules))
+	for _, rule := range rules {
+		if (!rule.Start.IsZero() && now.Before(rule.Start)) || (!rule.End.IsZero() && now.After(rule.End)) {
+			continue
+		}
+		if len(rule.UserLabels) > 0 {
+			// load user labels once
+			if userLabels == nil {
+				user, err := s.DataStore.GetUser(userId)
+				if err != nil {
+					base.Logger().Warn("failed to get user", zap.String("user_id", userId), zap.Error(err))
+				}
+				userLabels = strset.New(user.Labels...)
+			}
+			if !userLabels.HasAny(rule.UserLabels...) {
+				continue
+			}
+		}
+		results = append(results, rule)
+	}
+	return results, nil
+}
+
+// hasRankingRules checks whether there are filter or boost rules.
+func hasRankingRules(rules []data.Rule) bool {
+	for _, rule := range rules {
+		if rule.Action != PinAction {
+			return true
+		}
+	}
+	return false
+}
+
+// matchItem checks whether an item satisfies conditions of a rule.
+func matchItem(rule data.Rule, item data.Item, now time.Time) bool {
+	if rule.ItemId != "" && rule.ItemId != item.ItemId {
+		return false
+	}
+	if len(rule.ItemLabels) > 0 && !strset.New(item.Labels...).HasAny(rule.ItemLabels...) {
+		return false
+	}
+	if rule.MinAge > 0 && item.Timestamp.After(now.AddDate(0, 0, -rule.MinAge)) {
+		return false
+	}
+	if rule.MaxAge > 0 && item.Timestamp.Before(now.AddDate(0, 0, -rule.MaxAge)) {
+		return false
+	}
+	return true
+}
+
+// applyRules applies filter and boost rules to ranked items. Scores of items are normalized by
+// positions before boosting. IDs of fired rules are returned.
+func (s *RestServer) applyRules(items []string, rules []data.Rule, now time.Time) ([]string, []string) {
+	// load items if there are item conditions
+	details := make([]data.Item, len(items))
+	for i, itemId := range items {
+		details[i] = data.Item{ItemId: itemId}
+	}
+	for _, rule := range rules {
+		if rule.Action != PinAction && (len(rule.ItemLabels) > 0 || rule.MinAge > 0 || rule.MaxAge > 0) {
+			loaded, err := s.DataStore.BatchGetItems(items)
+			if err != nil {
+				base.Logger().Warn("failed to get items", zap.Error(err))
+				break
+			}
+			positions := make(map[string]int, len(items))
+			for i, itemId := range items {
+				positions[itemId] = i
+			}
+			for _, item := range loaded {
+				if i, exist := positions[item.ItemId]; exist {
+					details[i] = item
+				}
+			}
+			break
+		}
+	}
+	// apply rules
+	fired := strset.New()
+	scores := make(map[string]float32, len(items))
+	results := make([]string, 0, len(items))
+	for i, item := range details {
+		score, filtered := 1-float32(i)/float32(len(items)), false
+		for _, rule := range rules {
+			if rule.Action == PinAction || !matchItem(rule, item, now) {
+				continue
+			}
+			fired.Add(rule.RuleId)
+			if rule.Action == FilterAction {
+				filtered = true
+				break
+			}
+			score *= rule.Boost
+		}
+		if !filtered {
+			scores[item.ItemId] = score
+			results = append(results, item.ItemId)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return scores[results[i]] > scores[results[j]]
+	})
+	return results, fired.List()
+}
+
+// pinItems inserts pinned items at their positions. Excluded items are never pinned. IDs of
+// fired rules are returned.
+func pinItems(items []string, rules []data.Rule, excludeSet *strset.Set) ([]string, []string) {
+	pins := make([]data.Rule, 0)
+	for _, rule := range rules {
+		if rule.Action == PinAction && !excludeSet.Has(rule.ItemId) {
+			pins = append(pins, rule)
+		}
+	}
+	if len(pins) == 0 {
+		return items, nil
+	}
+	sort.SliceStable(pins, func(i, j int) bool {
+		return pins[i].Position < pins[j].Position
+	})
+	// remove pinned items from ranked items
+	pinSet := strset.New()
+	for _, rule := range pins {
+		pinSet.Add(rule.ItemId)
+	}
+	results := make([]string, 0, len(items)+len(pins))
+	for _, itemId := range items {
+		if !pinSet.Has(itemId) {
+			results = append(results, itemId)
+		}
+	}
+	// insert pinned items
+	fired := make([]string, 0, len(pins))
+	inserted := strset.New()
+	for _, rule := range pins {
+		if inserted.Has(rule.ItemId) {
+			continue
+		}
+		inserted.Add(rule.ItemId)
+		pos := rule.Position - 1
+		if pos > len(results) {
+			pos = len(results)
+		}
+		results = append(results, "")
+		copy(results[pos+1:], results[pos:])
+		results[pos] = rule.ItemId
+		fired = append(fired, rule.RuleId)
+	}
+	return results, fired
+}
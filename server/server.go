@@ -26,6 +26,7 @@ import (
 
 	"github.com/zhenghaoz/gorse/base"
 	"github.com/zhenghaoz/gorse/config"
+	"github.com/zhenghaoz/gorse/model/pr"
 	"github.com/zhenghaoz/gorse/protocol"
 	"github.com/zhenghaoz/gorse/storage/cache"
 	"github.com/zhenghaoz/gorse/storage/data"
@@ -42,6 +43,14 @@ type Server struct {
 	// master connection
 	masterClient protocol.MasterClient
 
+	// personal ranking model
+	latestPRVersion int64
+	prModelVersion  int64
+
+	// sequential model
+	latestSequentialVersion int64
+	sequentialModelVersion  int64
+
 	// factorization machine
 	//fmModel         ctr.FactorizationMachine
 	//RankModelMutex  sync.RWMutex
@@ -54,13 +63,14 @@ type Server struct {
 	masterPort int
 
 	// events
-	//syncedChan chan bool
+	syncedChan chan bool // meta synced events
 }
 
 func NewServer(masterHost string, masterPort int, serverHost string, serverPort int) *Server {
 	return &Server{
 		masterHost: masterHost,
 		masterPort: masterPort,
+		syncedChan: make(chan bool, 1024),
 		RestServer: RestServer{
 			DataStore:   &data.NoDatabase{},
 			CacheStore:  &cache.NoDatabase{},
@@ -104,10 +114,59 @@ func (s *Server) Serve() {
 	s.masterClient = protocol.NewMasterClient(conn)
 
 	go s.Sync()
-	//go s.Pull()
+	go s.Pull()
 	s.StartHttpServer()
 }
 
+// Pull personal ranking model from master.
+func (s *Server) Pull() {
+	defer base.CheckPanic()
+	for range s.syncedChan {
+		// pull personal ranking model
+		if s.latestPRVersion != s.prModelVersion {
+			base.Logger().Info("start pull personal ranking model")
+			if mfResponse, err := s.masterClient.GetPRModel(context.Background(),
+				&protocol.NodeInfo{
+					NodeType: protocol.NodeType_ServerNode,
+					NodeName: s.serverName,
+				}, grpc.MaxCallRecvMsgSize(10e8)); err != nil {
+				base.Logger().Error("failed to pull personal ranking model", zap.Error(err))
+			} else {
+				prModel, err := pr.DecodeModel(mfResponse.Name, mfResponse.Model)
+				if err != nil {
+					base.Logger().Error("failed to decode personal ranking model", zap.Error(err))
+				} else {
+					s.SetPRModel(prModel)
+					s.prModelVersion = mfResponse.Version
+					base.Logger().Info("synced personal ranking model",
+						zap.String("version", base.Hex(s.prModelVersion)))
+				}
+			}
+		}
+		// pull sequential model
+		if s.latestSequentialVersion != s.sequentialModelVersion {
+			base.Logger().Info("start pull sequential model")
+			if modelResponse, err := s.masterClient.GetSequentialModel(context.Background(),
+				&protocol.NodeInfo{
+					NodeType: protocol.NodeType_ServerNode,
+					NodeName: s.serverName,
+				}, grpc.MaxCallRecvMsgSize(10e8)); err != nil {
+				base.Logger().Error("failed to pull sequential model", zap.Error(err))
+			} else {
+				sequentialModel, err := pr.DecodeModel(modelResponse.Name, modelResponse.Model)
+				if err != nil {
+					base.Logger().Error("failed to decode sequential model", zap.Error(err))
+				} else {
+					s.SetSequentialModel(sequentialModel)
+					s.sequentialModelVersion = modelResponse.Version
+					base.Logger().Info("synced sequential model",
+						zap.String("version", base.Hex(s.sequentialModelVersion)))
+				}
+			}
+		}
+	}
+}
+
 // Pull factorization machine.
 //func (s *RestServer) Pull() {
 //	defer base.CheckPanic()
@@ -175,6 +234,27 @@ func (s *Server) Sync() {
 			s.cacheAddress = s.GorseConfig.Database.CacheStore
 		}
 
+		// update workers
+		s.SetWorkers(meta.Workers)
+
+		// check PR version
+		s.latestPRVersion = meta.PrVersion
+		if s.latestPRVersion != s.prModelVersion {
+			base.Logger().Info("new personal ranking model found",
+				zap.String("old_version", base.Hex(s.prModelVersion)),
+				zap.String("new_version", base.Hex(s.latestPRVersion)))
+			s.syncedChan <- true
+		}
+
+		// check sequential version
+		s.latestSequentialVersion = meta.SequentialVersion
+		if s.latestSequentialVersion != s.sequentialModelVersion {
+			base.Logger().Info("new sequential model found",
+				zap.String("old_version", base.Hex(s.sequentialModelVersion)),
+				zap.String("new_version", base.Hex(s.latestSequentialVersion)))
+			s.syncedChan <- true
+		}
+
 		// check FM version
 		//s.latestFMVersion = meta.FmVersion
 		//if s.latestFMVersion != s.fmVersion {
@@ -23,17 +23,26 @@ import (
 
 const (
 	// IgnoreItems is these items that a user has read.
-	IgnoreItems        = "ignore_items"
-	PopularItems       = "popular_items"
-	LatestItems        = "latest_items"
-	SimilarItems       = "similar_items"
+	IgnoreItems   = "ignore_items"
+	PopularItems  = "popular_items"
+	LatestItems   = "latest_items"
+	TrendingItems = "trending_items"
+	SimilarItems  = "similar_items"
+	// SimilarUsers are users who have given feedback to common items with a user.
+	SimilarUsers       = "similar_users"
 	CollaborativeItems = "collaborative_items"
 	SubscribeItems     = "subscribe_items"
+	// UserLabelPopularItems are popular items among users with a label.
+	UserLabelPopularItems = "user_label_popular_items"
+	// SessionItems is these items that a user has interacted recently, from the newest to the oldest.
+	SessionItems = "session_items"
 
 	GlobalMeta                  = "global_meta"
 	CollectPopularTime          = "last_update_popular_time"
 	CollectLatestTime           = "last_update_latest_time"
+	CollectTrendingTime         = "last_update_trending_time"
 	CollectSimilarTime          = "last_update_similar_time"
+	CollectSimilarUsersTime     = "last_update_similar_users_time"
 	FitMatrixFactorizationTime  = "last_fit_match_model_time"
 	FitFactorizationMachineTime = "last_fit_rank_model_time"
 	MatrixFactorizationVersion  = "latest_match_model_version"
@@ -44,8 +53,21 @@ const (
 	NumUsers                = "num_users"
 	NumItems                = "num_items"
 	NumPositiveFeedback     = "num_pos_feedback"
+
+	// ActiveUsers is the prefix of queues of users who have inserted feedback recently. Each
+	// worker has a queue of users assigned to it.
+	ActiveUsers = "active_users"
+	// MaxActiveUsers is the max length of a queue of active users.
+	MaxActiveUsers = 100000
+	// OnlineMetrics is the list of online metric names.
+	OnlineMetrics = "online_metrics"
 )
 
+// ActiveUsersQueue returns the name of the queue of active users assigned to a worker.
+func ActiveUsersQueue(worker string) string {
+	return ActiveUsers + "/" + worker
+}
+
 var ErrObjectNotExist = fmt.Errorf("object not exists")
 var ErrNoDatabase = fmt.Errorf("no database specified")
 
@@ -80,11 +102,14 @@ type Database interface {
 	GetScores(prefix, name string, begin int, end int) ([]ScoredItem, error)
 	ClearList(prefix, name string) error
 	AppendList(prefix, name string, items ...string) error
+	PushList(prefix, name string, maxLen int, items ...string) error
 	GetList(prefix, name string) ([]string, error)
 	GetString(prefix, name string) (string, error)
 	SetString(prefix, name string, val string) error
 	GetInt(prefix, name string) (int, error)
 	SetInt(prefix, name string, val int) error
+	PushQueue(name string, maxLen int, values ...string) error
+	PopQueue(name string) (string, error)
 }
 
 const redisPrefix = "redis://"
@@ -111,4 +111,41 @@ func testList(t *testing.T, db Database) {
 	totalItems, err = db.GetList("list", "0")
 	assert.Nil(t, err)
 	assert.Empty(t, totalItems)
+	// push
+	err = db.PushList("list", "1", 3, "0", "1", "2")
+	assert.Nil(t, err)
+	err = db.PushList("list", "1", 3, "1", "3")
+	assert.Nil(t, err)
+	totalItems, err = db.GetList("list", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "1", "2"}, totalItems)
+}
+
+func testQueue(t *testing.T, db Database) {
+	// push
+	err := db.PushQueue("queue", 0, "0", "1")
+	assert.Nil(t, err)
+	err = db.PushQueue("queue", 0, "2")
+	assert.Nil(t, err)
+	// pop
+	for _, expected := range []string{"0", "1", "2"} {
+		value, err := db.PopQueue("queue")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value)
+	}
+	// pop empty
+	_, err = db.PopQueue("queue")
+	assert.Equal(t, ErrObjectNotExist, err)
+	// push to a bounded queue
+	err = db.PushQueue("bounded", 3, "0", "1")
+	assert.Nil(t, err)
+	err = db.PushQueue("bounded", 3, "2", "3")
+	assert.Nil(t, err)
+	for _, expected := range []string{"1", "2", "3"} {
+		value, err := db.PopQueue("bounded")
+		assert.Nil(t, err)
+		assert.Equal(t, expected, value)
+	}
+	_, err = db.PopQueue("bounded")
+	assert.Equal(t, ErrObjectNotExist, err)
 }
@@ -36,6 +36,10 @@ func (NoDatabase) AppendList(prefix, name string, items ...string) error {
 	return ErrNoDatabase
 }
 
+func (NoDatabase) PushList(prefix, name string, maxLen int, items ...string) error {
+	return ErrNoDatabase
+}
+
 func (NoDatabase) GetList(prefix, name string) ([]string, error) {
 	return nil, ErrNoDatabase
 }
@@ -55,3 +59,11 @@ func (NoDatabase) GetInt(prefix, name string) (int, error) {
 func (NoDatabase) SetInt(prefix, name string, val int) error {
 	return ErrNoDatabase
 }
+
+func (NoDatabase) PushQueue(name string, maxLen int, values ...string) error {
+	return ErrNoDatabase
+}
+
+func (NoDatabase) PopQueue(name string) (string, error) {
+	return "", ErrNoDatabase
+}
@@ -87,6 +87,27 @@ func (redis *Redis) AppendList(prefix, name string, items ...string) error {
 	return nil
 }
 
+// PushList pushes distinct items to the head of a list in order, so the last item becomes the
+// head. Previous occurrences of items are removed and the list keeps at most maxLen items from
+// the head. The list is updated atomically.
+func (redis *Redis) PushList(prefix, name string, maxLen int, items ...string) error {
+	var ctx = context.Background()
+	key := prefix + "/" + name
+	if len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(items))
+	pipe := redis.client.TxPipeline()
+	for i, item := range items {
+		pipe.LRem(ctx, key, 0, item)
+		args[i] = item
+	}
+	pipe.LPush(ctx, key, args...)
+	pipe.LTrim(ctx, key, 0, int64(maxLen-1))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func (redis *Redis) GetList(prefix, name string) ([]string, error) {
 	var ctx = context.Background()
 	key := prefix + "/" + name
@@ -138,3 +159,36 @@ func (redis *Redis) GetInt(prefix, name string) (int, error) {
 func (redis *Redis) SetInt(prefix, name string, val int) error {
 	return redis.SetString(prefix, name, strconv.Itoa(val))
 }
+
+// PushQueue appends values to the tail of a queue. The queue keeps at most maxLen values from
+// the tail (0 means no limit).
+func (redis *Redis) PushQueue(name string, maxLen int, values ...string) error {
+	var ctx = context.Background()
+	if len(values) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	pipe := redis.client.TxPipeline()
+	pipe.RPush(ctx, name, args...)
+	if maxLen > 0 {
+		pipe.LTrim(ctx, name, int64(-maxLen), -1)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// PopQueue removes and returns the head of a queue. ErrObjectNotExist is returned if the queue is empty.
+func (redis *Redis) PopQueue(name string) (string, error) {
+	var ctx = context.Background()
+	val, err := redis.client.LPop(ctx, name).Result()
+	if err != nil {
+		if err.Error() == "redis: nil" {
+			return "", ErrObjectNotExist
+		}
+		return "", err
+	}
+	return val, nil
+}
@@ -57,3 +57,9 @@ func TestRedis_List(t *testing.T) {
 	defer db.Close(t)
 	testList(t, db.Database)
 }
+
+func TestRedis_Queue(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testQueue(t, db.Database)
+}
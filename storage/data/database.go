@@ -29,8 +29,9 @@ import (
 )
 
 const (
-	ErrUserNotExist = "user not exist"
-	ErrItemNotExist = "item not exist"
+	ErrUserNotExist  = "user not exist"
+	ErrItemNotExist  = "item not exist"
+	ErrModelNotExist = "model not exist"
 )
 
 // Item stores meta data about item.
@@ -81,6 +82,66 @@ type Measurement struct {
 	Comment   string
 }
 
+// Impression records an item shown to a user by a recommendation request.
+type Impression struct {
+	RequestId string
+	UserId    string
+	ItemId    string
+	Position  int    // position of the item in the response, starting from 1
+	Source    string // the pipeline stage generating the item
+	Variant   string // the experiment variant assigned to the user
+	Timestamp time.Time
+}
+
+// impressionKey identifies an impression, which is used as the cursor of impressions.
+type impressionKey struct {
+	RequestId string
+	ItemId    string
+}
+
+// Rule is a business rule applied to recommendations. A rule matches items and users by
+// conditions, and an empty condition matches everything. The action of a rule is one of:
+// "filter" removes matched items, "boost" multiplies scores of matched items by Boost and
+// "pin" inserts ItemId at Position (starting from 1).
+type Rule struct {
+	RuleId     string
+	Action     string
+	ItemId     string    // the item to match or to pin
+	ItemLabels []string  // items with any of these labels are matched
+	UserLabels []string  // users with any of these labels are matched
+	MinAge     int       // items older than MinAge days are matched
+	MaxAge     int       // items newer than MaxAge days are matched
+	Boost      float32   // the factor to boost scores of matched items
+	Position   int       // the position of the pinned item
+	Start      time.Time // the rule takes effect after the start time
+	End        time.Time // the rule takes effect before the end time
+	Comment    string
+}
+
+// Trial is a trial of model search. Scores are evaluated on the validation set.
+type Trial struct {
+	TrialId   string
+	Model     string                 // name of the model
+	Params    map[string]interface{} // hyper-parameters of the model
+	NDCG      float32
+	Precision float32
+	Recall    float32
+	Coverage  float32
+	Diversity float32
+	Novelty   float32
+	Gini      float32
+	FitTime   float32   // time to fit the model in seconds
+	Timestamp time.Time // time when the trial completed
+}
+
+// ModelMeta is the metadata of a version of the personal ranking model, which is recorded to
+// retrain the version later.
+type ModelMeta struct {
+	Version   string    // version of the model in hex
+	Meta      string    // metadata of the model in JSON
+	Timestamp time.Time // time when the fitting started
+}
+
 type Database interface {
 	Init() error
 	Close() error
@@ -89,6 +150,7 @@ type Database interface {
 	BatchInsertItem(items []Item) error
 	DeleteItem(itemId string) error
 	GetItem(itemId string) (Item, error)
+	BatchGetItems(itemIds []string) ([]Item, error)
 	GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error)
 	GetItemFeedback(itemId string, feedbackType *string) ([]Feedback, error)
 	// users
@@ -97,6 +159,7 @@ type Database interface {
 	GetUser(userId string) (User, error)
 	GetUsers(cursor string, n int) (string, []User, error)
 	GetUserFeedback(userId string, feedbackType *string) ([]Feedback, error)
+	BatchGetUserFeedback(userIds []string, feedbackTypes []string) ([]Feedback, error)
 	// feedback
 	GetUserItemFeedback(userId, itemId string, feedbackType *string) ([]Feedback, error)
 	DeleteUserItemFeedback(userId, itemId string, feedbackType *string) (int, error)
@@ -106,6 +169,20 @@ type Database interface {
 	// measurement
 	InsertMeasurement(measurement Measurement) error
 	GetMeasurements(name string, n int) ([]Measurement, error)
+	// impressions (ttl is used by data stores expiring impressions by themselves, 0 means forever)
+	InsertImpressions(impressions []Impression, ttl time.Duration) error
+	GetImpressions(cursor string, n int, timeLimit *time.Time) (string, []Impression, error)
+	DeleteImpressions(timeLimit time.Time) error
+	// rules
+	InsertRule(rule Rule) error
+	DeleteRule(ruleId string) error
+	GetRules() ([]Rule, error)
+	// trials
+	InsertTrial(trial Trial) error
+	GetTrials(n int) ([]Trial, error)
+	// model metadata
+	InsertModelMeta(meta ModelMeta) error
+	GetModelMeta(version string) (ModelMeta, error)
 }
 
 const mySQLPrefix = "mysql://"
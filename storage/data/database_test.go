@@ -187,6 +187,14 @@ func testFeedback(t *testing.T, db Database) {
 	ret, err = db.GetUserFeedback("2", nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(ret))
+	// Get typed feedback by users
+	ret, err = db.BatchGetUserFeedback([]string{"1", "2", "5"}, []string{positiveFeedbackType})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, feedback[1:3], ret)
+	// Get all feedback by users
+	ret, err = db.BatchGetUserFeedback([]string{"0", "2"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(ret))
 	// Get typed feedback by item
 	ret, err = db.GetItemFeedback("4", &positiveFeedbackType)
 	assert.Nil(t, err)
@@ -257,6 +265,10 @@ func testItems(t *testing.T, db Database) {
 		assert.Nil(t, err)
 		assert.Equal(t, item, ret)
 	}
+	// Batch get items
+	batchItems, err := db.BatchGetItems([]string{"2", "6", "1"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []Item{items[1], items[3]}, batchItems)
 	// Delete item
 	err = db.DeleteItem("0")
 	assert.Nil(t, err)
@@ -374,6 +386,117 @@ func testMeasurements(t *testing.T, db Database) {
 	}, ret)
 }
 
+func testImpressions(t *testing.T, db Database) {
+	impressions := []Impression{
+		{"0", "0", "1", 1, "collaborative", "a", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"0", "0", "2", 2, "session", "a", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"0", "0", "3", 3, "popular", "a", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"1", "1", "1", 1, "latest", "", time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"1", "1", "2", 2, "latest", "", time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)},
+	}
+	err := db.InsertImpressions(impressions, 0)
+	assert.Nil(t, err)
+	// get impressions by pages
+	var ret []Impression
+	cursor := ""
+	for {
+		var page []Impression
+		cursor, page, err = db.GetImpressions(cursor, 2, nil)
+		assert.Nil(t, err)
+		ret = append(ret, page...)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.ElementsMatch(t, impressions, ret)
+	// get impressions by time limit
+	timeLimit := time.Date(2000, 6, 1, 1, 1, 1, 0, time.UTC)
+	_, ret, err = db.GetImpressions("", 100, &timeLimit)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, impressions[3:], ret)
+}
+
+func testDeleteImpressions(t *testing.T, db Database) {
+	impressions := []Impression{
+		{"0", "0", "1", 1, "collaborative", "a", time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{"1", "1", "1", 1, "latest", "", time.Date(2001, 1, 1, 1, 1, 1, 0, time.UTC)},
+	}
+	err := db.InsertImpressions(impressions, 0)
+	assert.Nil(t, err)
+	// delete impressions by time limit
+	err = db.DeleteImpressions(time.Date(2000, 6, 1, 1, 1, 1, 0, time.UTC))
+	assert.Nil(t, err)
+	_, ret, err := db.GetImpressions("", 100, nil)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, impressions[1:], ret)
+}
+
+func testRules(t *testing.T, db Database) {
+	rules := []Rule{
+		{RuleId: "0", Action: "filter", ItemLabels: []string{"a"}, Start: time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{RuleId: "1", Action: "boost", UserLabels: []string{"b"}, Boost: 2},
+		{RuleId: "2", Action: "pin", ItemId: "1", Position: 3},
+	}
+	for _, rule := range rules {
+		err := db.InsertRule(rule)
+		assert.Nil(t, err)
+	}
+	ret, err := db.GetRules()
+	assert.Nil(t, err)
+	assert.Equal(t, rules, ret)
+	// update a rule
+	rules[2].Position = 1
+	err = db.InsertRule(rules[2])
+	assert.Nil(t, err)
+	// delete a rule
+	err = db.DeleteRule("1")
+	assert.Nil(t, err)
+	ret, err = db.GetRules()
+	assert.Nil(t, err)
+	assert.Equal(t, []Rule{rules[0], rules[2]}, ret)
+}
+
+func testTrials(t *testing.T, db Database) {
+	trials := []Trial{
+		{TrialId: "0", Model: "bpr", Params: map[string]interface{}{"lr": 0.01}, NDCG: 0.1, FitTime: 1,
+			Timestamp: time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{TrialId: "1", Model: "als", Params: map[string]interface{}{"reg": 0.1}, NDCG: 0.3, FitTime: 2,
+			Timestamp: time.Date(2000, 1, 1, 1, 1, 3, 0, time.UTC)},
+		{TrialId: "2", Model: "knn", Params: map[string]interface{}{"similarity": "cosine"}, NDCG: 0.2, FitTime: 3,
+			Timestamp: time.Date(2000, 1, 1, 1, 1, 2, 0, time.UTC)},
+	}
+	for _, trial := range trials {
+		err := db.InsertTrial(trial)
+		assert.Nil(t, err)
+	}
+	// latest trials come first
+	ret, err := db.GetTrials(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Trial{trials[1], trials[2]}, ret)
+	ret, err = db.GetTrials(10)
+	assert.Nil(t, err)
+	assert.Equal(t, []Trial{trials[1], trials[2], trials[0]}, ret)
+}
+
+func testModelMeta(t *testing.T, db Database) {
+	metas := []ModelMeta{
+		{Version: "1", Meta: `{"Name":"bpr"}`, Timestamp: time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)},
+		{Version: "2", Meta: `{"Name":"als"}`, Timestamp: time.Date(2000, 1, 1, 1, 1, 2, 0, time.UTC)},
+	}
+	for _, meta := range metas {
+		err := db.InsertModelMeta(meta)
+		assert.Nil(t, err)
+	}
+	meta, err := db.GetModelMeta("1")
+	assert.Nil(t, err)
+	assert.Equal(t, metas[0], meta)
+	meta, err = db.GetModelMeta("2")
+	assert.Nil(t, err)
+	assert.Equal(t, metas[1], meta)
+	_, err = db.GetModelMeta("3")
+	assert.EqualError(t, err, ErrModelNotExist)
+}
+
 func testTimeLimit(t *testing.T, db Database) {
 	// insert items
 	items := []Item{
@@ -16,6 +16,8 @@ package data
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -31,7 +33,7 @@ func (db *MongoDB) Init() error {
 	ctx := context.Background()
 	d := db.client.Database(db.dbName)
 	// list collections
-	var hasUsers, hasItems, hasFeedback, hasMeasurements bool
+	var hasUsers, hasItems, hasFeedback, hasMeasurements, hasImpressions, hasRules, hasTrials, hasModels bool
 	collections, err := d.ListCollectionNames(ctx, bson.M{})
 	if err != nil {
 		return err
@@ -46,6 +48,14 @@ func (db *MongoDB) Init() error {
 			hasFeedback = true
 		case "measurements":
 			hasMeasurements = true
+		case "impressions":
+			hasImpressions = true
+		case "rules":
+			hasRules = true
+		case "trials":
+			hasTrials = true
+		case "models":
+			hasModels = true
 		}
 	}
 	// create collections
@@ -69,6 +79,31 @@ func (db *MongoDB) Init() error {
 			return err
 		}
 	}
+	if !hasImpressions {
+		if err = d.CreateCollection(ctx, "impressions"); err != nil {
+			return err
+		}
+		if _, err = d.Collection("impressions").Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.M{"timestamp": 1},
+		}); err != nil {
+			return err
+		}
+	}
+	if !hasRules {
+		if err = d.CreateCollection(ctx, "rules"); err != nil {
+			return err
+		}
+	}
+	if !hasTrials {
+		if err = d.CreateCollection(ctx, "trials"); err != nil {
+			return err
+		}
+	}
+	if !hasModels {
+		if err = d.CreateCollection(ctx, "models"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -104,6 +139,158 @@ func (db *MongoDB) GetMeasurements(name string, n int) ([]Measurement, error) {
 	return measurements, nil
 }
 
+func (db *MongoDB) InsertImpressions(impressions []Impression, _ time.Duration) error {
+	if len(impressions) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("impressions")
+	documents := make([]interface{}, len(impressions))
+	for i := range impressions {
+		documents[i] = impressions[i]
+	}
+	_, err := c.InsertMany(ctx, documents)
+	return err
+}
+
+// DeleteImpressions deletes impressions before the time limit.
+func (db *MongoDB) DeleteImpressions(timeLimit time.Time) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("impressions")
+	_, err := c.DeleteMany(ctx, bson.M{"timestamp": bson.M{"$lt": timeLimit}})
+	return err
+}
+
+func (db *MongoDB) GetImpressions(cursor string, n int, timeLimit *time.Time) (string, []Impression, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("impressions")
+	opt := options.Find()
+	opt.SetLimit(int64(n))
+	opt.SetSort(bson.D{{"requestid", 1}, {"itemid", 1}})
+	filter := make(bson.M)
+	// pass cursor to filter
+	if cursor != "" {
+		var cursorKey impressionKey
+		if err := json.Unmarshal([]byte(cursor), &cursorKey); err != nil {
+			return "", nil, err
+		}
+		filter["$or"] = bson.A{
+			bson.M{"requestid": bson.M{"$gt": cursorKey.RequestId}},
+			bson.M{"requestid": cursorKey.RequestId, "itemid": bson.M{"$gt": cursorKey.ItemId}},
+		}
+	}
+	// pass time limit to filter
+	if timeLimit != nil {
+		filter["timestamp"] = bson.M{"$gte": *timeLimit}
+	}
+	r, err := c.Find(ctx, filter, opt)
+	if err != nil {
+		return "", nil, err
+	}
+	impressions := make([]Impression, 0)
+	for r.Next(ctx) {
+		var impression Impression
+		if err = r.Decode(&impression); err != nil {
+			return "", nil, err
+		}
+		impressions = append(impressions, impression)
+	}
+	if len(impressions) == n {
+		last := impressions[n-1]
+		nextCursor, err := json.Marshal(impressionKey{last.RequestId, last.ItemId})
+		if err != nil {
+			return "", nil, err
+		}
+		return string(nextCursor), impressions, nil
+	}
+	return "", impressions, nil
+}
+
+func (db *MongoDB) InsertRule(rule Rule) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	opt := options.Update()
+	opt.SetUpsert(true)
+	_, err := c.UpdateOne(ctx, bson.M{"ruleid": bson.M{"$eq": rule.RuleId}}, bson.M{"$set": rule}, opt)
+	return err
+}
+
+func (db *MongoDB) DeleteRule(ruleId string) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	_, err := c.DeleteOne(ctx, bson.M{"ruleid": ruleId})
+	return err
+}
+
+func (db *MongoDB) GetRules() ([]Rule, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("rules")
+	opt := options.Find()
+	opt.SetSort(bson.D{{"ruleid", 1}})
+	r, err := c.Find(ctx, bson.M{}, opt)
+	rules := make([]Rule, 0)
+	if err != nil {
+		return rules, err
+	}
+	for r.Next(ctx) {
+		var rule Rule
+		if err = r.Decode(&rule); err != nil {
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (db *MongoDB) InsertTrial(trial Trial) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("trials")
+	opt := options.Update()
+	opt.SetUpsert(true)
+	_, err := c.UpdateOne(ctx, bson.M{"trialid": bson.M{"$eq": trial.TrialId}}, bson.M{"$set": trial}, opt)
+	return err
+}
+
+func (db *MongoDB) GetTrials(n int) ([]Trial, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("trials")
+	opt := options.Find()
+	opt.SetSort(bson.D{{"timestamp", -1}})
+	opt.SetLimit(int64(n))
+	r, err := c.Find(ctx, bson.M{}, opt)
+	trials := make([]Trial, 0)
+	if err != nil {
+		return trials, err
+	}
+	for r.Next(ctx) {
+		var trial Trial
+		if err = r.Decode(&trial); err != nil {
+			return trials, err
+		}
+		trials = append(trials, trial)
+	}
+	return trials, nil
+}
+
+func (db *MongoDB) InsertModelMeta(meta ModelMeta) error {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("models")
+	opt := options.Update()
+	opt.SetUpsert(true)
+	_, err := c.UpdateOne(ctx, bson.M{"version": bson.M{"$eq": meta.Version}}, bson.M{"$set": meta}, opt)
+	return err
+}
+
+func (db *MongoDB) GetModelMeta(version string) (meta ModelMeta, err error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("models")
+	r := c.FindOne(ctx, bson.M{"version": version})
+	if err = r.Decode(&meta); err == mongo.ErrNoDocuments {
+		err = errors.New(ErrModelNotExist)
+	}
+	return
+}
+
 func (db *MongoDB) InsertItem(item Item) error {
 	ctx := context.Background()
 	c := db.client.Database(db.dbName).Collection("items")
@@ -144,6 +331,29 @@ func (db *MongoDB) GetItem(itemId string) (item Item, err error) {
 	return
 }
 
+// BatchGetItems gets items by IDs. Items not found are skipped.
+func (db *MongoDB) BatchGetItems(itemIds []string) ([]Item, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("items")
+	items := make([]Item, 0, len(itemIds))
+	if len(itemIds) == 0 {
+		return items, nil
+	}
+	r, err := c.Find(ctx, bson.M{"itemid": bson.M{"$in": itemIds}})
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close(ctx)
+	for r.Next(ctx) {
+		var item Item
+		if err = r.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 func (db *MongoDB) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	ctx := context.Background()
 	c := db.client.Database(db.dbName).Collection("items")
@@ -233,6 +443,9 @@ func (db *MongoDB) GetUser(userId string) (user User, err error) {
 	c := db.client.Database(db.dbName).Collection("users")
 	r := c.FindOne(ctx, bson.M{"userid": userId})
 	err = r.Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		err = errors.New(ErrUserNotExist)
+	}
 	return
 }
 
@@ -293,6 +506,34 @@ func (db *MongoDB) GetUserFeedback(userId string, feedbackType *string) ([]Feedb
 	return feedbacks, nil
 }
 
+// BatchGetUserFeedback gets feedback of users with given types. Feedback of all types are
+// returned if no type is given.
+func (db *MongoDB) BatchGetUserFeedback(userIds []string, feedbackTypes []string) ([]Feedback, error) {
+	ctx := context.Background()
+	c := db.client.Database(db.dbName).Collection("feedback")
+	feedbacks := make([]Feedback, 0)
+	if len(userIds) == 0 {
+		return feedbacks, nil
+	}
+	filter := bson.M{"feedbackkey.userid": bson.M{"$in": userIds}}
+	if len(feedbackTypes) > 0 {
+		filter["feedbackkey.feedbacktype"] = bson.M{"$in": feedbackTypes}
+	}
+	r, err := c.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close(ctx)
+	for r.Next(ctx) {
+		var feedback Feedback
+		if err = r.Decode(&feedback); err != nil {
+			return nil, err
+		}
+		feedbacks = append(feedbacks, feedback)
+	}
+	return feedbacks, nil
+}
+
 func (db *MongoDB) InsertFeedback(feedback Feedback, insertUser, insertItem bool) error {
 	ctx := context.Background()
 	opt := options.Update()
@@ -123,3 +123,33 @@ func TestMongoDatabase_TimeLimit(t *testing.T) {
 	defer db.Close(t)
 	testTimeLimit(t, db.Database)
 }
+
+func TestMongoDatabase_Impressions(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestMongoDatabase_DeleteImpressions(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_DeleteImpressions")
+	defer db.Close(t)
+	testDeleteImpressions(t, db.Database)
+}
+
+func TestMongoDatabase_Rules(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
+func TestMongoDatabase_Trials(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_Trials")
+	defer db.Close(t)
+	testTrials(t, db.Database)
+}
+
+func TestMongoDatabase_ModelMeta(t *testing.T) {
+	db := newTestMongoDatabase(t, "TestMongoDatabase_ModelMeta")
+	defer db.Close(t)
+	testModelMeta(t, db.Database)
+}
@@ -47,6 +47,10 @@ func (NoDatabase) GetItem(itemId string) (Item, error) {
 	return Item{}, NoDatabaseError
 }
 
+func (NoDatabase) BatchGetItems(itemIds []string) ([]Item, error) {
+	return nil, NoDatabaseError
+}
+
 func (NoDatabase) GetItems(cursor string, n int, time *time.Time) (string, []Item, error) {
 	return "", nil, NoDatabaseError
 }
@@ -75,6 +79,10 @@ func (NoDatabase) GetUserFeedback(userId string, feedbackType *string) ([]Feedba
 	return nil, NoDatabaseError
 }
 
+func (NoDatabase) BatchGetUserFeedback(userIds []string, feedbackTypes []string) ([]Feedback, error) {
+	return nil, NoDatabaseError
+}
+
 func (NoDatabase) GetUserItemFeedback(userId, itemId string, feedbackType *string) ([]Feedback, error) {
 	return nil, NoDatabaseError
 }
@@ -102,3 +110,43 @@ func (NoDatabase) InsertMeasurement(measurement Measurement) error {
 func (NoDatabase) GetMeasurements(name string, n int) ([]Measurement, error) {
 	return nil, NoDatabaseError
 }
+
+func (NoDatabase) InsertImpressions(impressions []Impression, ttl time.Duration) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) DeleteImpressions(timeLimit time.Time) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) GetImpressions(cursor string, n int, timeLimit *time.Time) (string, []Impression, error) {
+	return "", nil, NoDatabaseError
+}
+
+func (NoDatabase) InsertRule(rule Rule) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) DeleteRule(ruleId string) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) GetRules() ([]Rule, error) {
+	return nil, NoDatabaseError
+}
+
+func (NoDatabase) InsertTrial(trial Trial) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) GetTrials(n int) ([]Trial, error) {
+	return nil, NoDatabaseError
+}
+
+func (NoDatabase) InsertModelMeta(meta ModelMeta) error {
+	return NoDatabaseError
+}
+
+func (NoDatabase) GetModelMeta(version string) (ModelMeta, error) {
+	return ModelMeta{}, NoDatabaseError
+}
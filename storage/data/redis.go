@@ -17,7 +17,9 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-redis/redis/v8"
+	"github.com/scylladb/go-set/strset"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,8 +31,15 @@ const (
 	prefixUser     = "user/"     // prefix for users
 	prefixFeedback = "feedback/" // prefix for feedback
 	prefixMeasure  = "measure/"  // prefix for measurements
+	prefixRule     = "rule/"     // prefix for rules
+	prefixImpress  = "impress/"  // prefix for impressions
+	prefixTrial    = "trial/"    // prefix for trials
+	prefixModel    = "model/"    // prefix for model metadata
 )
 
+// errKeyNotExist is returned by redis if a key doesn't exist.
+var errKeyNotExist = redis.Nil
+
 type Redis struct {
 	client *redis.Client
 }
@@ -92,6 +101,178 @@ func (redis *Redis) GetMeasurements(name string, n int) ([]Measurement, error) {
 	return measurements, nil
 }
 
+// InsertImpressions inserts impressions which expire after the TTL.
+func (redis *Redis) InsertImpressions(impressions []Impression, ttl time.Duration) error {
+	var ctx = context.Background()
+	for _, impression := range impressions {
+		data, err := json.Marshal(impression)
+		if err != nil {
+			return err
+		}
+		if err = redis.client.SetNX(ctx, prefixImpress+impression.RequestId+"/"+impression.ItemId, data, ttl).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImpressions does nothing since impressions expire by the TTL.
+func (redis *Redis) DeleteImpressions(_ time.Time) error {
+	return nil
+}
+
+func (redis *Redis) GetImpressions(cursor string, n int, timeLimit *time.Time) (string, []Impression, error) {
+	var ctx = context.Background()
+	var err error
+	cursorNum := uint64(0)
+	if len(cursor) > 0 {
+		cursorNum, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	var keys []string
+	keys, cursorNum, err = redis.client.Scan(ctx, cursorNum, prefixImpress+"*", int64(n)).Result()
+	if err != nil {
+		return "", nil, err
+	}
+	impressions := make([]Impression, 0, len(keys))
+	for _, key := range keys {
+		val, err := redis.client.Get(ctx, key).Result()
+		if err != nil {
+			return "", nil, err
+		}
+		var impression Impression
+		if err = json.Unmarshal([]byte(val), &impression); err != nil {
+			return "", nil, err
+		}
+		// compare timestamp
+		if timeLimit != nil && impression.Timestamp.Before(*timeLimit) {
+			continue
+		}
+		impressions = append(impressions, impression)
+	}
+	if cursorNum == 0 {
+		cursor = ""
+	} else {
+		cursor = strconv.FormatUint(cursorNum, 10)
+	}
+	return cursor, impressions, nil
+}
+
+func (redis *Redis) InsertRule(rule Rule) error {
+	var ctx = context.Background()
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	return redis.client.Set(ctx, prefixRule+rule.RuleId, data, 0).Err()
+}
+
+func (redis *Redis) DeleteRule(ruleId string) error {
+	var ctx = context.Background()
+	return redis.client.Del(ctx, prefixRule+ruleId).Err()
+}
+
+func (redis *Redis) GetRules() ([]Rule, error) {
+	var ctx = context.Background()
+	rules := make([]Rule, 0)
+	var err error
+	var cursor uint64
+	var keys []string
+	for {
+		keys, cursor, err = redis.client.Scan(ctx, cursor, prefixRule+"*", 0).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			data, err := redis.client.Get(ctx, key).Result()
+			if err != nil {
+				return rules, err
+			}
+			var rule Rule
+			if err = json.Unmarshal([]byte(data), &rule); err != nil {
+				return rules, err
+			}
+			rules = append(rules, rule)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].RuleId < rules[j].RuleId
+	})
+	return rules, nil
+}
+
+func (redis *Redis) InsertTrial(trial Trial) error {
+	var ctx = context.Background()
+	data, err := json.Marshal(trial)
+	if err != nil {
+		return err
+	}
+	return redis.client.Set(ctx, prefixTrial+trial.TrialId, data, 0).Err()
+}
+
+func (redis *Redis) GetTrials(n int) ([]Trial, error) {
+	var ctx = context.Background()
+	trials := make([]Trial, 0)
+	var err error
+	var cursor uint64
+	var keys []string
+	for {
+		keys, cursor, err = redis.client.Scan(ctx, cursor, prefixTrial+"*", 0).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			data, err := redis.client.Get(ctx, key).Result()
+			if err != nil {
+				return trials, err
+			}
+			var trial Trial
+			if err = json.Unmarshal([]byte(data), &trial); err != nil {
+				return trials, err
+			}
+			trials = append(trials, trial)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	// sort trials by timestamp
+	sort.Slice(trials, func(i, j int) bool {
+		return trials[i].Timestamp.After(trials[j].Timestamp)
+	})
+	if len(trials) > n {
+		trials = trials[:n]
+	}
+	return trials, nil
+}
+
+func (redis *Redis) InsertModelMeta(meta ModelMeta) error {
+	var ctx = context.Background()
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return redis.client.Set(ctx, prefixModel+meta.Version, data, 0).Err()
+}
+
+func (redis *Redis) GetModelMeta(version string) (ModelMeta, error) {
+	var ctx = context.Background()
+	data, err := redis.client.Get(ctx, prefixModel+version).Result()
+	if err == errKeyNotExist {
+		return ModelMeta{}, errors.New(ErrModelNotExist)
+	} else if err != nil {
+		return ModelMeta{}, err
+	}
+	var meta ModelMeta
+	err = json.Unmarshal([]byte(data), &meta)
+	return meta, err
+}
+
 type sortMeasurements struct {
 	measurements []Measurement
 }
@@ -179,6 +360,33 @@ func (redis *Redis) GetItem(itemId string) (Item, error) {
 	return item, err
 }
 
+// BatchGetItems gets items by IDs. Items not found are skipped.
+func (redis *Redis) BatchGetItems(itemIds []string) ([]Item, error) {
+	var ctx = context.Background()
+	items := make([]Item, 0, len(itemIds))
+	if len(itemIds) == 0 {
+		return items, nil
+	}
+	keys := make([]string, len(itemIds))
+	for i, itemId := range itemIds {
+		keys[i] = prefixItem + itemId
+	}
+	values, err := redis.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if data, ok := value.(string); ok {
+			var item Item
+			if err = json.Unmarshal([]byte(data), &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
 func (redis *Redis) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var ctx = context.Background()
 	var err error
@@ -263,7 +471,9 @@ func (redis *Redis) DeleteUser(userId string) error {
 func (redis *Redis) GetUser(userId string) (User, error) {
 	var ctx = context.Background()
 	val, err := redis.client.Get(ctx, prefixUser+userId).Result()
-	if err != nil {
+	if err == errKeyNotExist {
+		return User{}, errors.New(ErrUserNotExist)
+	} else if err != nil {
 		return User{}, err
 	}
 	var user User
@@ -328,6 +538,29 @@ func (redis *Redis) GetUserFeedback(userId string, feedbackType *string) ([]Feed
 	return feedback, err
 }
 
+// BatchGetUserFeedback gets feedback of users with given types. Feedback of all types are
+// returned if no type is given.
+func (redis *Redis) BatchGetUserFeedback(userIds []string, feedbackTypes []string) ([]Feedback, error) {
+	var ctx = context.Background()
+	feedback := make([]Feedback, 0)
+	if len(userIds) == 0 {
+		return feedback, nil
+	}
+	userSet := strset.New(userIds...)
+	typeSet := strset.New(feedbackTypes...)
+	err := redis.ForFeedback(ctx, func(key, thisFeedbackType, thisUserId, thisItemId string) error {
+		if userSet.Has(thisUserId) && (typeSet.IsEmpty() || typeSet.Has(thisFeedbackType)) {
+			val, err := redis.getFeedback(key)
+			if err != nil {
+				return err
+			}
+			feedback = append(feedback, val)
+		}
+		return nil
+	})
+	return feedback, err
+}
+
 func (redis *Redis) getFeedback(key string) (Feedback, error) {
 	var ctx = context.Background()
 	// get feedback by feedbackKey
@@ -17,6 +17,7 @@ import (
 	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 type mockRedis struct {
@@ -87,3 +88,42 @@ func TestRedis_TimeLimit(t *testing.T) {
 	defer db.Close(t)
 	testTimeLimit(t, db.Database)
 }
+
+func TestRedis_Impressions(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestRedis_ImpressionTTL(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	err := db.InsertImpressions([]Impression{{RequestId: "0", UserId: "0", ItemId: "1", Timestamp: time.Now()}}, time.Hour)
+	assert.Nil(t, err)
+	_, ret, err := db.GetImpressions("", 100, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ret))
+	// impressions expire after the TTL
+	db.server.FastForward(time.Hour)
+	_, ret, err = db.GetImpressions("", 100, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, ret)
+}
+
+func TestRedis_Rules(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
+func TestRedis_Trials(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testTrials(t, db.Database)
+}
+
+func TestRedis_ModelMeta(t *testing.T) {
+	db := newMockRedis(t)
+	defer db.Close(t)
+	testModelMeta(t, db.Database)
+}
@@ -21,6 +21,7 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/zhenghaoz/gorse/base"
 	"go.uber.org/zap"
+	"strings"
 	"time"
 )
 
@@ -67,6 +68,42 @@ func (d *SQLDatabase) Init() error {
 		")"); err != nil {
 		return err
 	}
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS impressions (" +
+		"request_id varchar(256) NOT NULL," +
+		"user_id varchar(256) NOT NULL," +
+		"item_id varchar(256) NOT NULL," +
+		"position int NOT NULL," +
+		"source varchar(256) NOT NULL," +
+		"variant varchar(256) NOT NULL," +
+		"time_stamp timestamp NOT NULL," +
+		"PRIMARY KEY(request_id, item_id)," +
+		"INDEX(time_stamp)" +
+		")"); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS rules (" +
+		"rule_id varchar(256) NOT NULL," +
+		"rule json NOT NULL," +
+		"PRIMARY KEY(rule_id)" +
+		")"); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS trials (" +
+		"trial_id varchar(256) NOT NULL," +
+		"time_stamp timestamp NOT NULL," +
+		"trial json NOT NULL," +
+		"PRIMARY KEY(trial_id)" +
+		")"); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("CREATE TABLE IF NOT EXISTS models (" +
+		"version varchar(256) NOT NULL," +
+		"time_stamp timestamp NOT NULL," +
+		"meta json NOT NULL," +
+		"PRIMARY KEY(version)" +
+		")"); err != nil {
+		return err
+	}
 	// create index
 	if _, err := d.db.Exec("ALTER TABLE feedback ADD INDEX (user_id)"); err != nil {
 		return err
@@ -105,6 +142,170 @@ func (d *SQLDatabase) GetMeasurements(name string, n int) ([]Measurement, error)
 	return measurements, nil
 }
 
+// insertImpressionsBatchSize is the max number of rows inserted by a statement.
+const insertImpressionsBatchSize = 1000
+
+func (d *SQLDatabase) InsertImpressions(impressions []Impression, _ time.Duration) error {
+	for begin := 0; begin < len(impressions); begin += insertImpressionsBatchSize {
+		end := begin + insertImpressionsBatchSize
+		if end > len(impressions) {
+			end = len(impressions)
+		}
+		builder := strings.Builder{}
+		builder.WriteString("INSERT IGNORE impressions(request_id, user_id, item_id, position, source, variant, time_stamp) VALUES ")
+		args := make([]interface{}, 0, (end-begin)*7)
+		for i, impression := range impressions[begin:end] {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString("(?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, impression.RequestId, impression.UserId, impression.ItemId,
+				impression.Position, impression.Source, impression.Variant, impression.Timestamp)
+		}
+		if _, err := d.db.Exec(builder.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteImpressions deletes impressions before the time limit.
+func (d *SQLDatabase) DeleteImpressions(timeLimit time.Time) error {
+	_, err := d.db.Exec("DELETE FROM impressions WHERE time_stamp < ?", timeLimit)
+	return err
+}
+
+func (d *SQLDatabase) GetImpressions(cursor string, n int, timeLimit *time.Time) (string, []Impression, error) {
+	var cursorKey impressionKey
+	if cursor != "" {
+		if err := json.Unmarshal([]byte(cursor), &cursorKey); err != nil {
+			return "", nil, err
+		}
+	}
+	var result *sql.Rows
+	var err error
+	if timeLimit != nil {
+		result, err = d.db.Query("SELECT request_id, user_id, item_id, position, source, variant, time_stamp FROM impressions "+
+			"WHERE (request_id, item_id) > (?, ?) AND time_stamp >= ? ORDER BY request_id, item_id LIMIT ?",
+			cursorKey.RequestId, cursorKey.ItemId, *timeLimit, n)
+	} else {
+		result, err = d.db.Query("SELECT request_id, user_id, item_id, position, source, variant, time_stamp FROM impressions "+
+			"WHERE (request_id, item_id) > (?, ?) ORDER BY request_id, item_id LIMIT ?",
+			cursorKey.RequestId, cursorKey.ItemId, n)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	defer result.Close()
+	impressions := make([]Impression, 0)
+	for result.Next() {
+		var impression Impression
+		if err = result.Scan(&impression.RequestId, &impression.UserId, &impression.ItemId, &impression.Position,
+			&impression.Source, &impression.Variant, &impression.Timestamp); err != nil {
+			return "", nil, err
+		}
+		impressions = append(impressions, impression)
+	}
+	if len(impressions) == n {
+		last := impressions[n-1]
+		nextCursor, err := json.Marshal(impressionKey{last.RequestId, last.ItemId})
+		if err != nil {
+			return "", nil, err
+		}
+		return string(nextCursor), impressions, nil
+	}
+	return "", impressions, nil
+}
+
+func (d *SQLDatabase) InsertRule(rule Rule) error {
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("INSERT rules(rule_id, rule) VALUES (?, ?) ON DUPLICATE KEY UPDATE rule = ?",
+		rule.RuleId, data, data)
+	return err
+}
+
+func (d *SQLDatabase) DeleteRule(ruleId string) error {
+	_, err := d.db.Exec("DELETE FROM rules WHERE rule_id = ?", ruleId)
+	return err
+}
+
+func (d *SQLDatabase) GetRules() ([]Rule, error) {
+	rules := make([]Rule, 0)
+	result, err := d.db.Query("SELECT rule FROM rules ORDER BY rule_id")
+	if err != nil {
+		return rules, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var data string
+		if err = result.Scan(&data); err != nil {
+			return rules, err
+		}
+		var rule Rule
+		if err = json.Unmarshal([]byte(data), &rule); err != nil {
+			return rules, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (d *SQLDatabase) InsertTrial(trial Trial) error {
+	data, err := json.Marshal(trial)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("INSERT trials(trial_id, time_stamp, trial) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE trial = ?",
+		trial.TrialId, trial.Timestamp, data, data)
+	return err
+}
+
+func (d *SQLDatabase) GetTrials(n int) ([]Trial, error) {
+	trials := make([]Trial, 0)
+	result, err := d.db.Query("SELECT trial FROM trials ORDER BY time_stamp DESC LIMIT ?", n)
+	if err != nil {
+		return trials, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var data string
+		if err = result.Scan(&data); err != nil {
+			return trials, err
+		}
+		var trial Trial
+		if err = json.Unmarshal([]byte(data), &trial); err != nil {
+			return trials, err
+		}
+		trials = append(trials, trial)
+	}
+	return trials, nil
+}
+
+func (d *SQLDatabase) InsertModelMeta(meta ModelMeta) error {
+	_, err := d.db.Exec("INSERT models(version, time_stamp, meta) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE meta = ?",
+		meta.Version, meta.Timestamp, meta.Meta, meta.Meta)
+	return err
+}
+
+func (d *SQLDatabase) GetModelMeta(version string) (ModelMeta, error) {
+	result, err := d.db.Query("SELECT version, time_stamp, meta FROM models WHERE version = ?", version)
+	if err != nil {
+		return ModelMeta{}, err
+	}
+	defer result.Close()
+	if result.Next() {
+		var meta ModelMeta
+		if err = result.Scan(&meta.Version, &meta.Timestamp, &meta.Meta); err != nil {
+			return ModelMeta{}, err
+		}
+		return meta, nil
+	}
+	return ModelMeta{}, errors.New(ErrModelNotExist)
+}
+
 func (d *SQLDatabase) InsertItem(item Item) error {
 	startTime := time.Now()
 	labels, err := json.Marshal(item.Labels)
@@ -169,6 +370,44 @@ func (d *SQLDatabase) GetItem(itemId string) (Item, error) {
 	return Item{}, errors.New(ErrItemNotExist)
 }
 
+// BatchGetItems gets items by IDs. Items not found are skipped.
+func (d *SQLDatabase) BatchGetItems(itemIds []string) ([]Item, error) {
+	items := make([]Item, 0, len(itemIds))
+	if len(itemIds) == 0 {
+		return items, nil
+	}
+	builder := strings.Builder{}
+	builder.WriteString("SELECT item_id, time_stamp, labels, `comment` FROM items WHERE item_id IN (")
+	args := make([]interface{}, len(itemIds))
+	for i, itemId := range itemIds {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("?")
+		args[i] = itemId
+	}
+	builder.WriteString(")")
+	result, err := d.db.Query(builder.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var item Item
+		var labels *string
+		if err = result.Scan(&item.ItemId, &item.Timestamp, &labels, &item.Comment); err != nil {
+			return nil, err
+		}
+		if labels != nil {
+			if err = json.Unmarshal([]byte(*labels), &item.Labels); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
 func (d *SQLDatabase) GetItems(cursor string, n int, timeLimit *time.Time) (string, []Item, error) {
 	var result *sql.Rows
 	var err error
@@ -357,6 +596,50 @@ func (d *SQLDatabase) GetUserFeedback(userId string, feedbackType *string) ([]Fe
 	return feedbacks, nil
 }
 
+// BatchGetUserFeedback gets feedback of users with given types. Feedback of all types are
+// returned if no type is given.
+func (d *SQLDatabase) BatchGetUserFeedback(userIds []string, feedbackTypes []string) ([]Feedback, error) {
+	feedbacks := make([]Feedback, 0)
+	if len(userIds) == 0 {
+		return feedbacks, nil
+	}
+	builder := strings.Builder{}
+	builder.WriteString("SELECT feedback_type, user_id, item_id, time_stamp, `comment` FROM feedback WHERE user_id IN (")
+	args := make([]interface{}, 0, len(userIds)+len(feedbackTypes))
+	for i, userId := range userIds {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString("?")
+		args = append(args, userId)
+	}
+	builder.WriteString(")")
+	if len(feedbackTypes) > 0 {
+		builder.WriteString(" AND feedback_type IN (")
+		for i, feedbackType := range feedbackTypes {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString("?")
+			args = append(args, feedbackType)
+		}
+		builder.WriteString(")")
+	}
+	result, err := d.db.Query(builder.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+	for result.Next() {
+		var feedback Feedback
+		if err = result.Scan(&feedback.FeedbackType, &feedback.UserId, &feedback.ItemId, &feedback.Timestamp, &feedback.Comment); err != nil {
+			return nil, err
+		}
+		feedbacks = append(feedbacks, feedback)
+	}
+	return feedbacks, nil
+}
+
 func (d *SQLDatabase) InsertFeedback(feedback Feedback, insertUser, insertItem bool) error {
 	startTime := time.Now()
 	// insert users
@@ -122,3 +122,33 @@ func TestSQLDatabase_TimeLimit(t *testing.T) {
 	defer db.Close(t)
 	testTimeLimit(t, db.Database)
 }
+
+func TestSQLDatabase_Impressions(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Impressions")
+	defer db.Close(t)
+	testImpressions(t, db.Database)
+}
+
+func TestSQLDatabase_DeleteImpressions(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_DeleteImpressions")
+	defer db.Close(t)
+	testDeleteImpressions(t, db.Database)
+}
+
+func TestSQLDatabase_Rules(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Rules")
+	defer db.Close(t)
+	testRules(t, db.Database)
+}
+
+func TestSQLDatabase_Trials(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_Trials")
+	defer db.Close(t)
+	testTrials(t, db.Database)
+}
+
+func TestSQLDatabase_ModelMeta(t *testing.T) {
+	db := newTestSQLDatabase(t, "TestSQLDatabase_ModelMeta")
+	defer db.Close(t)
+	testModelMeta(t, db.Database)
+}
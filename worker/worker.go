@@ -28,6 +28,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/zhenghaoz/gorse/base"
@@ -67,6 +68,7 @@ type Worker struct {
 	latestPRVersion int64
 	prModelVersion  int64
 	prModel         pr.Model
+	prModelMutex    sync.RWMutex
 
 	// peers
 	peers []string
@@ -206,10 +208,13 @@ func (w *Worker) Pull() {
 				}, grpc.MaxCallRecvMsgSize(10e8)); err != nil {
 				base.Logger().Error("failed to pull personal ranking model", zap.Error(err))
 			} else {
-				w.prModel, err = pr.DecodeModel(mfResponse.Name, mfResponse.Model)
+				prModel, err := pr.DecodeModel(mfResponse.Name, mfResponse.Model)
 				if err != nil {
 					base.Logger().Error("failed to decode personal ranking model", zap.Error(err))
 				} else {
+					w.prModelMutex.Lock()
+					w.prModel = prModel
+					w.prModelMutex.Unlock()
 					w.prModelVersion = mfResponse.Version
 					base.Logger().Info("synced personal ranking model",
 						zap.String("version", base.Hex(w.prModelVersion)))
@@ -262,6 +267,7 @@ func (w *Worker) Serve() {
 	go w.Sync()
 	go w.Pull()
 	go w.ServeMetrics()
+	go w.Refresh()
 
 	loop := func() {
 		if w.userIndex == nil {
@@ -277,11 +283,14 @@ func (w *Worker) Serve() {
 			}
 
 			// offline recommendation
-			if w.prModel != nil {
-				w.Recommend(w.prModel, workingUsers)
+			if prModel := w.getPRModel(); prModel != nil {
+				w.Recommend(prModel, w.staleUsers(workingUsers))
 			} else {
 				base.Logger().Debug("local personal ranking model doesn't exist")
 			}
+
+			// subscription recommendation
+			w.Subscribe(workingUsers)
 		}
 	}
 
@@ -334,12 +343,25 @@ func (w *Worker) Recommend(m pr.Model, users []string) {
 		userId := users[jobId]
 		// convert to user index
 		var userIndex int
+		var userFactor []float32
 		if _, ok := m.(pr.MatrixFactorization); ok {
 			userIndex = userIndexer.ToNumber(userId)
-		}
-		// skip inactive users before max recommend period
-		if !w.checkRecommendCacheTimeout(userId) {
-			return nil
+			if userIndex == base.NotId {
+				// fold in a new user by feedback
+				if foldIn, ok := m.(pr.FoldIn); ok {
+					favoredItems, err := loadFeedbackItems(w.dataStore, userId, w.cfg.Database.PositiveFeedbackType...)
+					if err != nil {
+						base.Logger().Error("failed to pull user feedback",
+							zap.String("user_id", userId), zap.Error(err))
+						return err
+					}
+					userFactor = foldIn.FoldIn(toItemIndices(m.GetItemIndex(), favoredItems))
+				}
+				if userFactor == nil {
+					base.Logger().Debug("user not in model", zap.String("user_id", userId))
+					return nil
+				}
+			}
 		}
 		// Clear ignore items in cache. Since ignore items have been ignored
 		// in offline recommendation stage.
@@ -363,19 +385,18 @@ func (w *Worker) Recommend(m pr.Model, users []string) {
 					zap.String("user_id", userId), zap.Error(err))
 				return err
 			}
-			for _, itemId := range favoredItems {
-				itemIndex := m.GetItemIndex().ToNumber(itemId)
-				if itemIndex != base.NotId {
-					favoredItemIndices = append(favoredItemIndices, itemIndex)
-				}
-			}
+			favoredItemIndices = toItemIndices(m.GetItemIndex(), favoredItems)
 		}
 		recItems := base.NewTopKStringFilter(w.cfg.Database.CacheSize)
 		for itemIndex, itemId := range itemIds {
 			if !historySet.Has(itemId) {
 				switch m.(type) {
 				case pr.MatrixFactorization:
-					recItems.Push(itemId, m.(pr.MatrixFactorization).InternalPredict(userIndex, itemIndex))
+					if userFactor != nil {
+						recItems.Push(itemId, m.(pr.FoldIn).PredictByFactor(userFactor, itemIndex))
+					} else {
+						recItems.Push(itemId, m.(pr.MatrixFactorization).InternalPredict(userIndex, itemIndex))
+					}
 				case *pr.KNN:
 					recItems.Push(itemId, m.(*pr.KNN).InternalPredict(favoredItemIndices, itemIndex))
 				default:
@@ -399,100 +420,152 @@ func (w *Worker) Recommend(m pr.Model, users []string) {
 		zap.String("used_time", time.Since(startTime).String()))
 }
 
-// checkRecommendCacheTimeout checks if recommend cache stale.
-// 1. if active time > recommend time, stale.
-// 2. if recommend time + timeout < now, stale.
-func (w *Worker) checkRecommendCacheTimeout(userId string) bool {
-	var activeTime, recommendTime time.Time
-	// read active time
-	activeTimeLiteral, err := w.cacheStore.GetString(cache.LastActiveTime, userId)
-	if err != nil {
-		if err != cache.ErrObjectNotExist {
-			base.Logger().Error("failed to read meta", zap.Error(err))
+// getPRModel returns the personal ranking model pulled from the master.
+func (w *Worker) getPRModel() pr.Model {
+	w.prModelMutex.RLock()
+	defer w.prModelMutex.RUnlock()
+	return w.prModel
+}
+
+// Refresh recommendations for active users. Servers publish users to the queue of the worker
+// they are assigned to once feedback is inserted, so that recommendations are updated in seconds.
+func (w *Worker) Refresh() {
+	defer base.CheckPanic()
+	for {
+		prModel := w.getPRModel()
+		if prModel == nil || w.me == "" {
+			time.Sleep(time.Second)
+			continue
 		}
-	} else {
-		activeTime, err = dateparse.ParseAny(activeTimeLiteral)
+		users, err := w.popActiveUsers(maxActiveUsers)
+		if err != nil {
+			base.Logger().Error("failed to pop active users", zap.Error(err))
+		}
+		if len(users) > 0 {
+			w.Recommend(prModel, users)
+		} else {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// maxActiveUsers is the max number of active users refreshed in a batch.
+const maxActiveUsers = 1000
+
+// popActiveUsers pops at most n distinct users from the queue of active users of this worker.
+func (w *Worker) popActiveUsers(n int) ([]string, error) {
+	users := set.NewStringSet()
+	for users.Size() < n {
+		userId, err := w.cacheStore.PopQueue(cache.ActiveUsersQueue(w.me))
 		if err != nil {
-			base.Logger().Error("failed to time", zap.Error(err))
+			if err == cache.ErrObjectNotExist {
+				break
+			}
+			return users.List(), err
 		}
+		users.Add(userId)
 	}
+	return users.List(), nil
+}
+
+// staleUsers returns users whose recommend cache is stale.
+func (w *Worker) staleUsers(users []string) []string {
+	stale := make([]string, 0)
+	for _, userId := range users {
+		if w.checkRecommendCacheTimeout(userId) {
+			stale = append(stale, userId)
+		}
+	}
+	return stale
+}
+
+// checkRecommendCacheTimeout checks if recommend cache stale. Active users are refreshed
+// by events, so the recommend cache is stale only if recommend time + timeout < now.
+func (w *Worker) checkRecommendCacheTimeout(userId string) bool {
 	// read recommend time
 	recommendTimeLiteral, err := w.cacheStore.GetString(cache.LastUpdateRecommendTime, userId)
 	if err != nil {
 		if err != cache.ErrObjectNotExist {
 			base.Logger().Error("failed to read meta", zap.Error(err))
-		} else {
-			return true
-		}
-	} else {
-		recommendTime, err = dateparse.ParseAny(recommendTimeLiteral)
-		if err != nil {
-			base.Logger().Error("failed to time", zap.Error(err))
 		}
+		return true
 	}
-	// check time
-	if activeTime.Unix() < recommendTime.Unix() {
-		timeoutTime := recommendTime.Add(time.Hour * 24 * time.Duration(w.cfg.Recommend.MaxRecommendPeriod))
-		return timeoutTime.Unix() < time.Now().Unix()
+	recommendTime, err := dateparse.ParseAny(recommendTimeLiteral)
+	if err != nil {
+		base.Logger().Error("failed to time", zap.Error(err))
+		return true
 	}
-	return true
+	// check time
+	timeoutTime := recommendTime.Add(time.Hour * 24 * time.Duration(w.cfg.Recommend.MaxRecommendPeriod))
+	return timeoutTime.Unix() < time.Now().Unix()
 }
 
-//
-//func (w *Worker) Subscribe(users []string) {
-//	base.Logger().Info("subscribe",
-//		zap.Bool("implicit_subscribe", w.cfg.Subscribe.ImplicitSubscribe))
-//	completed := make(chan interface{})
-//	go func() {
-//		defer base.CheckPanic()
-//		completedCount := 0
-//		ticker := time.NewTicker(time.Second * 5)
-//		for {
-//			select {
-//			case _, ok := <-completed:
-//				if !ok {
-//					return
-//				}
-//				completedCount++
-//			case <-ticker.C:
-//				base.Logger().Info("subscribe",
-//					zap.Int("n_complete_users", completedCount),
-//					zap.Int("n_working_users", len(users)))
-//			}
-//		}
-//	}()
-//	_ = base.Parallel(len(users), w.FitJobs, func(workerId, jobId int) error {
-//		user := users[jobId]
-//		// collect items
-//		historySet := base.NewStringSet()
-//		for _, feedbackType := range w.cfg.Database.PositiveFeedbackType {
-//			historyFeedback, err := w.dataStore.GetUserFeedback(user, &feedbackType)
-//			if err != nil {
-//				base.Logger().Error("failed to pull user feedback",
-//					zap.String("user_id", user), zap.Error(err))
-//				return err
-//			}
-//			for _, feedback := range historyFeedback {
-//				historySet.Add(feedback.ItemId)
-//			}
-//		}
-//		// collect labels
-//		labelSet := make(map[string]int)
-//		for itemId, _ := range historySet {
-//			if item, err := w.dataStore.GetItem(itemId); err != nil {
-//				base.Logger().Error("failed to get item", zap.String("item_id", itemId), zap.Error(err))
-//			} else {
-//				for _, label := range item.Labels {
-//					labelSet[label] ++
-//				}
-//			}
-//		}
-//		base.Logger().Info("items", zap.Any("items", labelSet))
-//		completed <- nil
-//		return nil
-//	})
-//	close(completed)
-//}
+// Subscribe computes fresh items for users from their subscriptions. A subscription is an item
+// label (authors are labels of their items as well), and fresh items of subscribed labels are
+// merged by timestamps into the subscribe cache, except items the user has read.
+func (w *Worker) Subscribe(users []string) {
+	base.Logger().Info("subscription recommendation",
+		zap.Int("n_working_users", len(users)),
+		zap.Int("cache_size", w.cfg.Database.CacheSize))
+	startTime := time.Now()
+	_ = base.Parallel(len(users), w.Jobs, func(workerId, jobId int) error {
+		userId := users[jobId]
+		// 1. load subscriptions
+		user, err := w.dataStore.GetUser(userId)
+		if err != nil {
+			if err.Error() == data.ErrUserNotExist {
+				return nil
+			}
+			base.Logger().Error("failed to load user", zap.String("user_id", userId), zap.Error(err))
+			return err
+		}
+		if len(user.Subscribe) == 0 {
+			return nil
+		}
+		// 2. load history
+		historyItems, err := loadFeedbackItems(w.dataStore, userId)
+		if err != nil {
+			base.Logger().Error("failed to pull user feedback",
+				zap.String("user_id", userId), zap.Error(err))
+			return err
+		}
+		historySet := set.NewStringSet(historyItems...)
+		// 3. merge latest items of subscriptions
+		subscribeItems := base.NewTopKStringFilter(w.cfg.Database.CacheSize)
+		for _, label := range user.Subscribe {
+			latestItems, err := w.cacheStore.GetScores(cache.LatestItems, label, 0, w.cfg.Database.CacheSize)
+			if err != nil {
+				base.Logger().Error("failed to load latest items", zap.String("label", label), zap.Error(err))
+				return err
+			}
+			for _, item := range latestItems {
+				if !historySet.Has(item.ItemId) {
+					historySet.Add(item.ItemId)
+					subscribeItems.Push(item.ItemId, item.Score)
+				}
+			}
+		}
+		elems, scores := subscribeItems.PopAll()
+		if err = w.cacheStore.SetScores(cache.SubscribeItems, userId, cache.CreateScoredItems(elems, scores)); err != nil {
+			base.Logger().Error("failed to cache subscription recommendation", zap.Error(err))
+			return err
+		}
+		return nil
+	})
+	base.Logger().Info("complete subscription recommendation",
+		zap.String("used_time", time.Since(startTime).String()))
+}
+
+// toItemIndices converts item IDs to indices. Items not in the index are skipped.
+func toItemIndices(itemIndex base.Index, itemIds []string) []int {
+	indices := make([]int, 0, len(itemIds))
+	for _, itemId := range itemIds {
+		if index := itemIndex.ToNumber(itemId); index != base.NotId {
+			indices = append(indices, index)
+		}
+	}
+	return indices
+}
 
 func loadFeedbackItems(database data.Database, userId string, feedbackTypes ...string) ([]string, error) {
 	items := make([]string, 0)
@@ -518,6 +591,8 @@ func loadFeedbackItems(database data.Database, userId string, feedbackTypes ...s
 	return items, nil
 }
 
+// split users between workers by consistent hashing. Only users hashed to other workers
+// are moved when a worker joins or leaves the cluster.
 func split(userIndex base.Index, nodes []string, me string) ([]string, error) {
 	// locate me
 	pos := -1
@@ -530,10 +605,13 @@ func split(userIndex base.Index, nodes []string, me string) ([]string, error) {
 		return nil, fmt.Errorf("current node isn't in worker nodes")
 	}
 	// split users
+	ring := base.NewConsistentHash(nodes...)
 	users := userIndex.GetNames()
 	workingUsers := make([]string, 0)
-	for ; pos < len(users); pos += len(nodes) {
-		workingUsers = append(workingUsers, users[pos])
+	for _, user := range users {
+		if ring.Get(user) == me {
+			workingUsers = append(workingUsers, user)
+		}
 	}
 	base.Logger().Info("allocate working users",
 		zap.Int("n_working_users", len(workingUsers)),
@@ -12,3 +12,181 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 package worker
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/zhenghaoz/gorse/base"
+	"github.com/zhenghaoz/gorse/model"
+	"github.com/zhenghaoz/gorse/model/pr"
+	"github.com/zhenghaoz/gorse/storage/cache"
+	"github.com/zhenghaoz/gorse/storage/data"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type mockWorker struct {
+	dataStoreServer  *miniredis.Miniredis
+	cacheStoreServer *miniredis.Miniredis
+	*Worker
+}
+
+func newMockWorker(t *testing.T) *mockWorker {
+	w := new(mockWorker)
+	w.Worker = NewWorker("", 0, "", 0, 1)
+	// create mock redis server
+	var err error
+	w.dataStoreServer, err = miniredis.Run()
+	assert.Nil(t, err)
+	w.cacheStoreServer, err = miniredis.Run()
+	assert.Nil(t, err)
+	// open database
+	w.dataStore, err = data.Open("redis://" + w.dataStoreServer.Addr())
+	assert.Nil(t, err)
+	w.cacheStore, err = cache.Open("redis://" + w.cacheStoreServer.Addr())
+	assert.Nil(t, err)
+	return w
+}
+
+func (w *mockWorker) Close(t *testing.T) {
+	err := w.dataStore.Close()
+	assert.Nil(t, err)
+	err = w.cacheStore.Close()
+	assert.Nil(t, err)
+	w.dataStoreServer.Close()
+	w.cacheStoreServer.Close()
+}
+
+func TestSplit(t *testing.T) {
+	// create user index
+	userIndex := base.NewMapIndex()
+	for i := 0; i < 1000; i++ {
+		userIndex.Add(strconv.Itoa(i))
+	}
+	// node not in cluster
+	_, err := split(userIndex, []string{"1", "2"}, "3")
+	assert.NotNil(t, err)
+	// users are partitioned
+	nodes := []string{"1", "2", "3"}
+	owners := make(map[string]string)
+	for _, node := range nodes {
+		users, err := split(userIndex, nodes, node)
+		assert.Nil(t, err)
+		for _, user := range users {
+			_, exist := owners[user]
+			assert.False(t, exist)
+			owners[user] = node
+		}
+	}
+	assert.Equal(t, 1000, len(owners))
+	// existed workers keep their users after a new worker joins
+	nodes = append(nodes, "4")
+	users, err := split(userIndex, nodes, "4")
+	assert.Nil(t, err)
+	for _, node := range nodes[:3] {
+		users, err = split(userIndex, nodes, node)
+		assert.Nil(t, err)
+		for _, user := range users {
+			assert.Equal(t, node, owners[user])
+		}
+	}
+}
+
+func TestWorker_PopActiveUsers(t *testing.T) {
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.me = "worker_0"
+	err := w.cacheStore.PushQueue(cache.ActiveUsersQueue("worker_0"), 0, "1", "2", "1", "3", "4")
+	assert.Nil(t, err)
+	err = w.cacheStore.PushQueue(cache.ActiveUsersQueue("worker_1"), 0, "5")
+	assert.Nil(t, err)
+	// pop distinct users
+	users, err := w.popActiveUsers(3)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, users)
+	users, err = w.popActiveUsers(3)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"4"}, users)
+	// pop empty queue
+	users, err = w.popActiveUsers(3)
+	assert.Nil(t, err)
+	assert.Empty(t, users)
+}
+
+func TestWorker_CheckRecommendCacheTimeout(t *testing.T) {
+	w := newMockWorker(t)
+	defer w.Close(t)
+	// never recommended
+	assert.True(t, w.checkRecommendCacheTimeout("0"))
+	// recommended recently
+	err := w.cacheStore.SetString(cache.LastUpdateRecommendTime, "0", base.Now())
+	assert.Nil(t, err)
+	assert.False(t, w.checkRecommendCacheTimeout("0"))
+	// recommended before max recommend period
+	err = w.cacheStore.SetString(cache.LastUpdateRecommendTime, "0",
+		time.Now().Add(-time.Hour*24*time.Duration(w.cfg.Recommend.MaxRecommendPeriod+1)).Format("2006-01-02T15:04:05Z07:00"))
+	assert.Nil(t, err)
+	assert.True(t, w.checkRecommendCacheTimeout("0"))
+	assert.Equal(t, []string{"0", "1"}, w.staleUsers([]string{"0", "1"}))
+}
+
+func TestWorker_Subscribe(t *testing.T) {
+	w := newMockWorker(t)
+	defer w.Close(t)
+	// insert users
+	err := w.dataStore.InsertUser(data.User{UserId: "0", Subscribe: []string{"a", "author:b"}})
+	assert.Nil(t, err)
+	err = w.dataStore.InsertUser(data.User{UserId: "1"})
+	assert.Nil(t, err)
+	// insert latest items
+	err = w.cacheStore.SetScores(cache.LatestItems, "a",
+		[]cache.ScoredItem{{"1", 10}, {"2", 8}, {"3", 6}})
+	assert.Nil(t, err)
+	err = w.cacheStore.SetScores(cache.LatestItems, "author:b",
+		[]cache.ScoredItem{{"4", 9}, {"1", 10}})
+	assert.Nil(t, err)
+	// insert feedback
+	err = w.dataStore.BatchInsertFeedback([]data.Feedback{
+		{FeedbackKey: data.FeedbackKey{FeedbackType: "read", UserId: "0", ItemId: "2"}},
+	}, true, true)
+	assert.Nil(t, err)
+	// subscribe
+	w.Subscribe([]string{"0", "1", "2"})
+	items, err := w.cacheStore.GetScores(cache.SubscribeItems, "0", 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.ScoredItem{{"1", 10}, {"4", 9}, {"3", 6}}, items)
+	items, err = w.cacheStore.GetScores(cache.SubscribeItems, "1", 0, -1)
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+}
+
+func TestWorker_Recommend_FoldIn(t *testing.T) {
+	w := newMockWorker(t)
+	defer w.Close(t)
+	w.cfg.Database.PositiveFeedbackType = []string{"star"}
+	// create model without the new user
+	bpr := pr.NewBPR(model.Params{model.NFactors: 2})
+	bpr.UserIndex = base.NewMapIndex()
+	bpr.UserIndex.Add("0")
+	bpr.ItemIndex = base.NewMapIndex()
+	bpr.ItemIndex.Add("1")
+	bpr.ItemIndex.Add("2")
+	bpr.ItemIndex.Add("3")
+	bpr.UserFactor = [][]float32{{1, 2}}
+	bpr.ItemFactor = [][]float32{{1, 0}, {0, 1}, {1, 1}}
+	// insert feedback of the new user
+	err := w.dataStore.InsertFeedback(data.Feedback{
+		FeedbackKey: data.FeedbackKey{FeedbackType: "star", UserId: "1", ItemId: "3"},
+		Timestamp:   time.Now(),
+	}, true, true)
+	assert.Nil(t, err)
+	// recommend for the new user and a user without feedback
+	w.Recommend(bpr, []string{"1", "2"})
+	recommends, err := w.cacheStore.GetScores(cache.CollaborativeItems, "1", 0, -1)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"1", "2"}, cache.RemoveScores(recommends))
+	recommends, err = w.cacheStore.GetScores(cache.CollaborativeItems, "2", 0, -1)
+	assert.Nil(t, err)
+	assert.Empty(t, recommends)
+}